@@ -2,6 +2,7 @@ module tiny-cache
 
 go 1.18
 
-require github.com/golang/protobuf v1.5.2
-
-require google.golang.org/protobuf v1.26.0 // indirect
+require (
+	github.com/golang/protobuf v1.5.2
+	google.golang.org/protobuf v1.26.0
+)
@@ -3,16 +3,27 @@ package main
 /*
 $ curl http://localhost:8080/_cache/scores/Tom
 630
-$ curl http://localhost:8080/_cache/scores/kkk
-kkk not exist
+$ curl http://localhost:9999/api?key=kkk                # 30 秒之内重复查询不会访问 SlowDB
+kkk not exist: tinyCache: not found
+$ curl -X DELETE "http://localhost:9999/api?key=Tom"   # 删除 Tom 所在节点以及所有节点上的副本
+
+使用 gossip 发现节点，不需要固定的 addrMap：
+$ ./server -port=8001 -gossip=localhost:7001 &
+$ ./server -port=8002 -gossip=localhost:7002 -seeds=localhost:7001 &
+$ ./server -port=8003 -gossip=localhost:7003 -seeds=localhost:7001 -api=1 &
 */
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 	"tiny-cache/tinyCache"
+	"tiny-cache/tinyCache/gossip"
 )
 
 var db = map[string]string{
@@ -28,23 +39,47 @@ func createGroup() *tinyCache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, tinyCache.ErrNotFound)
+		}), tinyCache.WithBroadcast(), tinyCache.WithNegativeTTL(30*time.Second))
 }
 
-func startCacheServer(addr string, addrs []string, koo *tinyCache.Group) {
-	peers := tinyCache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+func startCacheServer(addr string, peers *tinyCache.HTTPPool, koo *tinyCache.Group) {
 	koo.RegisterPeers(peers)
 	log.Println("tinyCache is running at", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
 }
 
+// startGossip 使用 gossip 协议发现其他节点，代替固定的 addrMap
+func startGossip(addr string, gossipAddr string, seeds string, peers *tinyCache.HTTPPool) {
+	node, err := gossip.New(gossip.Config{Name: addr, BindAddr: gossipAddr})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if seeds != "" {
+		if err := node.Join(strings.Split(seeds, ",")...); err != nil {
+			log.Println("[gossip] join:", err)
+		}
+	}
+	go tinyCache.WatchGossip(context.Background(), node, peers)
+}
+
 func startAPIServer(apiAddr string, koo *tinyCache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := koo.Get(key)
+			if r.Method == http.MethodDelete {
+				if err := koo.Remove(key); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			view, err := koo.GetContext(r.Context(), key)
+			if errors.Is(err, tinyCache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -61,8 +96,11 @@ func startAPIServer(apiAddr string, koo *tinyCache.Group) {
 func main() {
 	var port int
 	var api bool
+	var gossipAddr, seeds string
 	flag.IntVar(&port, "port", 8001, "cache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&gossipAddr, "gossip", "", "gossip UDP address, e.g. localhost:7001")
+	flag.StringVar(&seeds, "seeds", "", "comma separated gossip addresses of existing nodes")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
@@ -81,7 +119,14 @@ func main() {
 	if api {
 		go startAPIServer(apiAddr, koo)
 	}
-	startCacheServer(addrMap[port], addrs, koo)
+	addr := fmt.Sprintf("http://localhost:%d", port)
+	peers := tinyCache.NewHTTPPool(addr)
+	if gossipAddr != "" {
+		startGossip(addr, gossipAddr, seeds, peers)
+	} else {
+		peers.Set(addrs...)
+	}
+	startCacheServer(addr, peers, koo)
 }
 
 // 							是
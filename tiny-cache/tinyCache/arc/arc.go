@@ -0,0 +1,240 @@
+package arc
+
+import (
+	"container/list"
+	"tiny-cache/tinyCache/policy"
+)
+
+/*
+
+ARC（Megiddo & Modha, 2003），按照字节计算容量
+
+	t1   只访问过一次的值，LRU
+	t2   访问过至少两次的值，LRU
+	b1   从 t1 淘汰的 key（ghost，只保存 key 和大小）
+	b2   从 t2 淘汰的 key
+
+p 是 t1 的目标大小：命中 b1 说明 t1 太小，增大 p；命中 b2 说明 t2 太小，减小 p
+这样 ARC 在 最近访问 和 频繁访问 之间自适应，不需要手动调整参数
+
+*/
+
+const (
+	t1 = iota
+	t2
+	b1
+	b2
+)
+
+// Cache is an ARC cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64
+	p        int64    // t1 的目标字节数
+	bytes    [4]int64 // 每个队列的字节数
+	lists    [4]*list.List
+	cache    map[string]*list.Element // 包括 ghost
+	// 在清除 item 的时候可以执行
+	OnEvicted func(key string, value policy.Value)
+}
+
+type entry struct {
+	key   string
+	value policy.Value // ghost 中为 nil
+	size  int64
+	where int
+}
+
+var _ policy.Policy = (*Cache)(nil)
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, policy.Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value policy.Value) {
+	size := policy.Size(key, value)
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		switch kv.where {
+		case t1, t2:
+			// 已经在缓存中，更新之后放到 t2
+			c.move(ele, t2)
+			c.bytes[t2] += size - kv.size
+			kv.value, kv.size = value, size
+			c.replace(false, 0)
+			return
+		case b1:
+			c.p = min64(c.maxBytes, c.p+max64(1, c.bytes[b2]/max64(1, c.bytes[b1]))*size)
+			c.replace(false, size)
+		case b2:
+			c.p = max64(0, c.p-max64(1, c.bytes[b1]/max64(1, c.bytes[b2]))*size)
+			c.replace(true, size)
+		}
+		// ghost 命中，放到 t2
+		c.bytes[kv.where] -= kv.size
+		c.move(ele, t2)
+		kv.value, kv.size = value, size
+		c.bytes[t2] += size
+		c.trimGhosts()
+		return
+	}
+
+	c.replace(false, size)
+	kv := &entry{key: key, value: value, size: size, where: t1}
+	c.cache[key] = c.lists[t1].PushFront(kv)
+	c.bytes[t1] += size
+	c.trimGhosts()
+}
+
+// Get look ups a key's value, 命中 t1 的值移动到 t2
+func (c *Cache) Get(key string) (value policy.Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	switch kv.where {
+	case t1:
+		c.bytes[t1] -= kv.size
+		c.move(ele, t2)
+		c.bytes[t2] += kv.size
+	case t2:
+		c.lists[t2].MoveToFront(ele)
+	default:
+		return nil, false
+	}
+	return kv.value, true
+}
+
+// replace 淘汰值直到可以放下 size 字节的新值
+// t1 超过目标大小 p 时淘汰 t1 的队尾到 b1，否则淘汰 t2 的队尾到 b2
+func (c *Cache) replace(inB2 bool, size int64) {
+	for c.maxBytes != 0 && c.bytes[t1]+c.bytes[t2]+size > c.maxBytes {
+		if c.lists[t1].Len() > 0 && (c.bytes[t1] > c.p || (inB2 && c.bytes[t1] == c.p) || c.lists[t2].Len() == 0) {
+			c.evict(c.lists[t1].Back(), b1)
+		} else if c.lists[t2].Len() > 0 {
+			c.evict(c.lists[t2].Back(), b2)
+		} else {
+			return
+		}
+	}
+}
+
+// trimGhosts 限制 ghost 的大小：t1 + b1 不超过 maxBytes，所有队列加起来不超过 2 * maxBytes
+func (c *Cache) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.bytes[t1]+c.bytes[b1] > c.maxBytes && c.lists[b1].Len() > 0 {
+		c.removeGhost(c.lists[b1].Back())
+	}
+	for c.bytes[t1]+c.bytes[t2]+c.bytes[b1]+c.bytes[b2] > 2*c.maxBytes && c.lists[b2].Len() > 0 {
+		c.removeGhost(c.lists[b2].Back())
+	}
+}
+
+// evict 将一个值淘汰到 ghost 队列
+func (c *Cache) evict(ele *list.Element, ghost int) {
+	kv := ele.Value.(*entry)
+	value := kv.value
+	c.bytes[kv.where] -= kv.size
+	c.move(ele, ghost)
+	c.bytes[ghost] += kv.size
+	kv.value = nil
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, value)
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.where].Remove(ele)
+	c.bytes[kv.where] -= kv.size
+	delete(c.cache, kv.key)
+}
+
+// move 将 ele 移动到 where 队列的队首
+func (c *Cache) move(ele *list.Element, where int) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.where].Remove(ele)
+	kv.where = where
+	c.cache[kv.key] = c.lists[where].PushFront(kv)
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	kv := ele.Value.(*entry)
+	if kv.where == b1 || kv.where == b2 {
+		return
+	}
+	c.lists[kv.where].Remove(ele)
+	c.bytes[kv.where] -= kv.size
+	delete(c.cache, key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	for _, where := range []int{t1, t2} {
+		for c.lists[where].Len() > 0 {
+			c.Remove(c.lists[where].Back().Value.(*entry).key)
+		}
+	}
+	for _, where := range []int{b1, b2} {
+		for c.lists[where].Len() > 0 {
+			c.removeGhost(c.lists[where].Back())
+		}
+	}
+	c.p = 0
+}
+
+// Range calls fn for each entry, t1 first.
+func (c *Cache) Range(fn func(key string, value policy.Value) bool) {
+	for _, where := range []int{t1, t2} {
+		for ele := c.lists[where].Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// Bytes the number of bytes used by cache entries
+func (c *Cache) Bytes() int64 {
+	return c.bytes[t1] + c.bytes[t2]
+}
+
+// Len the number of cache entries, ghost 不计算在内
+func (c *Cache) Len() int {
+	return c.lists[t1].Len() + c.lists[t2].Len()
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,85 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"tiny-cache/tinyCache/policy"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("1234"))
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	// 每个值 4 字节，最多 4 个值
+	arc := New(int64(16), nil)
+	for i := 0; i < 4; i++ {
+		arc.Add(fmt.Sprintf("k%d", i), String("vv"))
+	}
+	arc.Get("k0")
+	arc.Get("k1") // k0 k1 进入 t2
+	arc.Add("k4", String("vv"))
+	arc.Add("k5", String("vv")) // 淘汰 t1 中的 k2 k3 到 b1
+
+	if _, ok := arc.Get("k2"); ok {
+		t.Fatalf("k2 should be evicted")
+	}
+	if arc.lists[b1].Len() != 2 {
+		t.Fatalf("expect 2 keys in b1, got %d", arc.lists[b1].Len())
+	}
+	arc.Add("k2", String("vv")) // 命中 b1，增大 p
+	if arc.p == 0 || arc.cache["k2"].Value.(*entry).where != t2 {
+		t.Fatalf("ghost hit in b1 should grow p and move k2 to t2, p = %d", arc.p)
+	}
+	if total := arc.bytes[t1] + arc.bytes[t2]; total > 16 {
+		t.Fatalf("exceeds capacity: %d bytes", total)
+	}
+	if ghosts := arc.bytes[b1] + arc.bytes[b2]; arc.bytes[t1]+arc.bytes[t2]+ghosts > 32 {
+		t.Fatalf("too many ghosts: %d bytes", ghosts)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	arc := New(int64(40), nil)
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("h%d", i)
+		arc.Add(key, String("v"))
+		arc.Get(key)
+	}
+	for i := 0; i < 100; i++ {
+		arc.Add(fmt.Sprintf("s%02d", i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := arc.Get(fmt.Sprintf("h%d", i)); !ok {
+			t.Fatalf("scan should not evict frequently used h%d", i)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := 0
+	arc := New(int64(0), func(string, policy.Value) { evicted++ })
+	arc.Add("key1", String("1"))
+	arc.Add("key2", String("2"))
+	arc.Remove("key1")
+	if _, ok := arc.Get("key1"); ok || arc.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	arc.Clear()
+	if arc.Len() != 0 || arc.bytes != [4]int64{} || evicted != 2 {
+		t.Fatalf("Clear failed")
+	}
+}
@@ -0,0 +1,183 @@
+package tinyCache
+
+import (
+	"log"
+	"sync"
+	"time"
+	"tiny-cache/tinyCache/bloom"
+)
+
+// KeyEnumerator 列出数据源中所有的 key，用来构建 WithBloomFilter 的布隆过滤器
+type KeyEnumerator interface {
+	EnumerateKeys(add func(key string)) error
+}
+
+// A KeyEnumeratorFunc implements KeyEnumerator with a function.
+type KeyEnumeratorFunc func(add func(key string)) error
+
+// EnumerateKeys implements KeyEnumerator interface function
+func (f KeyEnumeratorFunc) EnumerateKeys(add func(key string)) error {
+	return f(add)
+}
+
+// defaultBloomKeys 和 defaultBloomFPRate 是 BloomOptions 的默认值，大约占用 1.2MB
+const (
+	defaultBloomKeys   = 1 << 20
+	defaultBloomFPRate = 0.01
+)
+
+// BloomOptions 是 WithBloomFilter 的配置，为 0 的字段使用默认值
+type BloomOptions struct {
+	// Keys 列出数据源中所有的 key，为 nil 时过滤器只能通过 Group.AddKey 增量添加，并且不会重建
+	Keys KeyEnumerator
+	// ExpectedKeys 是预计的 key 的数量，默认是 1<<20，重建时 key 的数量超过它会相应地扩大过滤器
+	ExpectedKeys uint64
+	// FalsePositiveRate 是目标误判率，默认是 0.01
+	FalsePositiveRate float64
+	// RebuildInterval 是重建过滤器的间隔，重建时数据源中删除的 key 会从过滤器中去掉，0 表示不定期重建
+	RebuildInterval time.Duration
+}
+
+// bloomGuard 在调用 Getter 之前过滤掉一定不存在的 key
+// 第一次构建完成之前 filter 为 nil，所有的 key 都放行
+type bloomGuard struct {
+	opts      BloomOptions
+	rebuildMu sync.Mutex // 同一时间只有一个重建
+
+	mu          sync.RWMutex  // guards following
+	filter      *bloom.Filter // 当前使用的过滤器
+	building    *bloom.Filter // 重建中的过滤器，AddKey 同时添加到这里，避免重建期间添加的 key 丢失
+	rebuilds    int64
+	lastRebuild time.Time
+}
+
+func newBloomGuard(opts BloomOptions) *bloomGuard {
+	if opts.ExpectedKeys == 0 {
+		opts.ExpectedKeys = defaultBloomKeys
+	}
+	if opts.FalsePositiveRate <= 0 || opts.FalsePositiveRate >= 1 {
+		opts.FalsePositiveRate = defaultBloomFPRate
+	}
+	b := &bloomGuard{opts: opts}
+	if opts.Keys == nil {
+		b.filter = bloom.New(opts.ExpectedKeys, opts.FalsePositiveRate)
+	}
+	return b
+}
+
+// mightContain 返回 false 时 key 一定不在数据源中
+func (b *bloomGuard) mightContain(key string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.filter == nil || b.filter.Test(key)
+}
+
+// active 返回过滤器是否已经在使用
+func (b *bloomGuard) active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.filter != nil
+}
+
+func (b *bloomGuard) add(key string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.filter != nil {
+		b.filter.Add(key)
+	}
+	if b.building != nil {
+		b.building.Add(key)
+	}
+}
+
+// rebuild 使用 KeyEnumerator 构建一个新的过滤器并替换当前的过滤器，失败时继续使用当前的过滤器
+func (b *bloomGuard) rebuild(now time.Time) error {
+	if b.opts.Keys == nil {
+		return nil
+	}
+	b.rebuildMu.Lock()
+	defer b.rebuildMu.Unlock()
+
+	// 上一次的 key 的数量加上 1/4 的余量，避免数据源增长之后误判率上升
+	n := b.opts.ExpectedKeys
+	b.mu.Lock()
+	if b.filter != nil {
+		if count := b.filter.Count(); count+count/4 > n {
+			n = count + count/4
+		}
+	}
+	next := bloom.New(n, b.opts.FalsePositiveRate)
+	b.building = next
+	b.mu.Unlock()
+
+	err := b.opts.Keys.EnumerateKeys(next.Add)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.building = nil
+	if err != nil {
+		return err
+	}
+	b.filter = next
+	b.rebuilds++
+	b.lastRebuild = now
+	return nil
+}
+
+func (b *bloomGuard) stats() BloomStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	s := BloomStats{Rebuilds: b.rebuilds, LastRebuild: b.lastRebuild}
+	if b.filter != nil {
+		s.Keys = b.filter.Count()
+		s.Bits, s.Hashes = b.filter.Cap()
+		s.FalsePositiveRate = b.filter.FalsePositiveRate()
+	}
+	return s
+}
+
+// bloomRebuilder 立即构建一次过滤器，之后每隔 RebuildInterval 重建一次，直到 group 被关闭
+func (g *Group) bloomRebuilder() {
+	if err := g.bloom.rebuild(g.now()); err != nil {
+		log.Printf("[kooCache] group %s: build bloom filter: %v", g.name, err)
+	}
+	if g.bloom.opts.RebuildInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(g.bloom.opts.RebuildInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.bloom.rebuild(g.now()); err != nil {
+				log.Printf("[kooCache] group %s: rebuild bloom filter: %v", g.name, err)
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// RebuildBloomFilter 立即使用 KeyEnumerator 重建布隆过滤器，没有使用 WithBloomFilter 时什么都不做
+func (g *Group) RebuildBloomFilter() error {
+	if g.bloom == nil {
+		return nil
+	}
+	return g.bloom.rebuild(g.now())
+}
+
+// AddKey 把数据源中新增的 key 添加到布隆过滤器，没有使用 WithBloomFilter 时什么都不做
+// 过滤器只能添加不能删除，数据源中删除的 key 在下一次重建之后才会被拒绝
+func (g *Group) AddKey(key string) {
+	if g.bloom != nil {
+		g.bloom.add(key)
+	}
+}
+
+// BloomStats returns stats about the bloom filter of the group.
+func (g *Group) BloomStats() BloomStats {
+	if g.bloom == nil {
+		return BloomStats{}
+	}
+	return g.bloom.stats()
+}
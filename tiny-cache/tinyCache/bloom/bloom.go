@@ -0,0 +1,115 @@
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync/atomic"
+)
+
+/*
+
+布隆过滤器，判断一个 key 一定不存在或者可能存在
+
+	m 位的位图和 k 个哈希函数，添加 key 时把 k 个位置设置为 1，查询时只要有一个位置是 0 就一定不存在
+	k 个哈希函数使用双重哈希 h1 + i*h2 得到（Kirsch-Mitzenmacher），只需要计算一次哈希
+	n 个 key、误判率 p 时 m = -n*ln(p)/ln(2)^2，k = m/n*ln(2)
+
+Add 和 Test 可以并发调用，位图使用原子操作读写
+
+*/
+
+// Filter 是一个并发安全的布隆过滤器
+type Filter struct {
+	bits  []uint64
+	m     uint64 // 位数
+	k     uint64 // 哈希函数的个数
+	seed  maphash.Seed
+	count uint64 // 添加的次数，atomic
+}
+
+// New 创建一个可以容纳 n 个 key、误判率为 p 的过滤器
+func New(n uint64, p float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return NewWithSize(m, k)
+}
+
+// NewWithSize 创建一个 m 位、k 个哈希函数的过滤器
+func NewWithSize(m, k uint64) *Filter {
+	if m < 64 {
+		m = 64
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+		seed: maphash.MakeSeed(),
+	}
+}
+
+// hash 返回双重哈希的 h1 和 h2，h2 是奇数，保证 k 个位置不会重复
+func (f *Filter) hash(key string) (uint64, uint64) {
+	var h maphash.Hash
+	h.SetSeed(f.seed)
+	h.WriteString(key)
+	h1 := h.Sum64()
+	h2 := bits.RotateLeft64(h1, 32)*0x9e3779b97f4a7c15 | 1
+	return h1, h2
+}
+
+// Add 添加一个 key
+func (f *Filter) Add(key string) {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		word, mask := &f.bits[pos/64], uint64(1)<<(pos%64)
+		for {
+			old := atomic.LoadUint64(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+				break
+			}
+		}
+	}
+	atomic.AddUint64(&f.count, 1)
+}
+
+// Test 返回 false 时 key 一定没有被添加过，返回 true 时 key 可能被添加过
+func (f *Filter) Test(key string) bool {
+	h1, h2 := f.hash(key)
+	for i := uint64(0); i < f.k; i++ {
+		pos := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.bits[pos/64])&(uint64(1)<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回添加的次数，重复添加的 key 会被计算多次
+func (f *Filter) Count() uint64 {
+	return atomic.LoadUint64(&f.count)
+}
+
+// Cap 返回位数和哈希函数的个数
+func (f *Filter) Cap() (m, k uint64) {
+	return f.m, f.k
+}
+
+// FalsePositiveRate 根据位图中 1 的比例估计当前的误判率 (ones/m)^k
+func (f *Filter) FalsePositiveRate() float64 {
+	var ones int
+	for i := range f.bits {
+		ones += bits.OnesCount64(atomic.LoadUint64(&f.bits[i]))
+	}
+	return math.Pow(float64(ones)/float64(f.m), float64(f.k))
+}
@@ -0,0 +1,74 @@
+package bloom
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(1000, 0.01)
+	if m, k := f.Cap(); m != 9586 || k != 7 {
+		t.Fatalf("expect m=9586 k=7, got m=%d k=%d", m, k)
+	}
+	for i := 0; i < 1000; i++ {
+		f.Add("key" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.Test("key" + strconv.Itoa(i)) {
+			t.Fatalf("added key%d should never be rejected", i)
+		}
+	}
+	if f.Count() != 1000 {
+		t.Fatalf("expect count 1000, got %d", f.Count())
+	}
+
+	// 实际的误判率和估计的误判率都应该接近 1%
+	fp := 0
+	const trials = 100000
+	for i := 0; i < trials; i++ {
+		if f.Test("absent" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	observed, estimated := float64(fp)/trials, f.FalsePositiveRate()
+	if observed > 0.02 || math.Abs(estimated-0.01) > 0.005 {
+		t.Fatalf("expect false positive rate about 1%%, observed %.4f, estimated %.4f", observed, estimated)
+	}
+}
+
+func TestFilterConcurrent(t *testing.T) {
+	f := New(10000, 0.01)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(g*1000 + i)
+				f.Add(key)
+				if !f.Test(key) {
+					t.Errorf("key %s should be found right after Add", key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for i := 0; i < 8000; i++ {
+		if !f.Test(strconv.Itoa(i)) {
+			t.Fatalf("key %d lost by a concurrent Add", i)
+		}
+	}
+}
+
+func BenchmarkTest(b *testing.B) {
+	f := New(1000000, 0.01)
+	for i := 0; i < 1000000; i++ {
+		f.Add(strconv.Itoa(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Test(strconv.Itoa(i))
+	}
+}
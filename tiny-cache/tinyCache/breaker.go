@@ -0,0 +1,201 @@
+package tinyCache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+)
+
+// ErrCircuitOpen is returned when requests to a peer are short-circuited.
+var ErrCircuitOpen = errors.New("tinyCache: circuit breaker is open")
+
+// PeerError 是访问远程节点失败时返回的错误
+//
+// Unavailable 为 true 表示没有得到远程节点的响应：连接失败、超时、连接中断或者网关错误，
+// 这类错误会被重试，并且计入熔断器。否则远程节点正常响应了一个错误，Code 是它返回的错误码，
+// 例如 INTERNAL 表示远程节点调用 Getter 失败，这类错误不会被重试
+type PeerError struct {
+	Peer        string
+	Code        pb.Code
+	Unavailable bool
+	Err         error
+}
+
+func (e *PeerError) Error() string {
+	if e.Unavailable {
+		return fmt.Sprintf("peer %s unavailable: %v", e.Peer, e.Err)
+	}
+	return fmt.Sprintf("peer %s returned %v: %v", e.Peer, e.Code, e.Err)
+}
+
+func (e *PeerError) Unwrap() error {
+	return e.Err
+}
+
+// responseError 将远程节点返回的错误码转换成错误
+// DEADLINE_EXCEEDED 说明调用者的剩余时间已经用完，转换成 context.DeadlineExceeded，和调用者自己超时相同
+func responseError(peer string, res *pb.Response) error {
+	if res.GetCode() == pb.Code_DEADLINE_EXCEEDED {
+		return fmt.Errorf("peer %s: %w", peer, context.DeadlineExceeded)
+	}
+	return &PeerError{Peer: peer, Code: res.GetCode(), Err: errors.New(res.GetError())}
+}
+
+// breakerState 是熔断器的状态
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // 正常，请求都会发送
+	breakerOpen                         // 连续失败次数达到阈值，请求直接失败
+	breakerHalfOpen                     // 打开 timeout 之后，只放行一个试探请求
+)
+
+// circuitBreaker 是一个远程节点的熔断器
+// 连续 threshold 次 Unavailable 的失败之后打开，timeout 之后放行一个试探请求，成功时关闭，失败时重新打开
+type circuitBreaker struct {
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex // guards following
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, timeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, timeout: timeout, now: time.Now}
+}
+
+// available 返回现在是否可以发送请求，不改变状态，PickPeer 使用它跳过熔断的节点
+func (b *circuitBreaker) available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return b.now().Sub(b.openedAt) >= b.timeout
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// allow 在发送请求之前调用，打开 timeout 之后第一个调用者成为试探请求
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.timeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record 记录请求的结果，只有 Unavailable 的错误算作失败
+func (b *circuitBreaker) record(err error) {
+	var perr *PeerError
+	failed := errors.As(err, &perr) && perr.Unavailable
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// abort 在请求被调用者取消时调用，不计入成功或者失败，被取消的试探请求让下一个请求重新试探
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+const (
+	defaultMaxRetries       = 2
+	defaultRetryBackoff     = 20 * time.Millisecond
+	defaultBreakerThreshold = 5
+	defaultBreakerTimeout   = 5 * time.Second
+)
+
+// peerPolicy 是访问一个远程节点时的重试和熔断，httpGetter 和 rpcGetter 共用
+type peerPolicy struct {
+	retries int             // 远程节点不可用时的最多重试次数
+	backoff time.Duration   // 第一次重试之前等待的时间
+	breaker *circuitBreaker // nil 表示不使用熔断器
+}
+
+// newPeerPolicy 创建一个远程节点的 peerPolicy，参数的含义和默认值见 HTTPPoolOptions
+// 每一个远程节点需要单独的 peerPolicy，熔断器按照节点统计失败次数
+func newPeerPolicy(maxRetries int, backoff time.Duration, breakerThreshold int, breakerTimeout time.Duration) peerPolicy {
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	if breakerThreshold == 0 {
+		breakerThreshold = defaultBreakerThreshold
+	}
+	if breakerTimeout <= 0 {
+		breakerTimeout = defaultBreakerTimeout
+	}
+	p := peerPolicy{retries: maxRetries, backoff: backoff}
+	if breakerThreshold > 0 {
+		p.breaker = newCircuitBreaker(breakerThreshold, breakerTimeout)
+	}
+	return p
+}
+
+// available 熔断器打开时返回 false，PickPeer 不会选择这个节点
+func (p *peerPolicy) available() bool {
+	return p.breaker == nil || p.breaker.available()
+}
+
+// retry 调用 fn，远程节点不可用时等待 backoff 之后重试，每次等待的时间翻倍
+// 每一次调用之前询问熔断器，调用之后把结果告诉熔断器。ctx 结束时直接返回，调用者的取消不算作远程节点的失败
+func (p *peerPolicy) retry(ctx context.Context, peer string, fn func() error) error {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		if p.breaker != nil && !p.breaker.allow() {
+			return &PeerError{Peer: peer, Unavailable: true, Err: ErrCircuitOpen}
+		}
+		err := fn()
+		if err != nil && ctx.Err() != nil {
+			if p.breaker != nil {
+				p.breaker.abort()
+			}
+			return fmt.Errorf("peer %s: %w", peer, ctx.Err())
+		}
+		if p.breaker != nil {
+			p.breaker.record(err)
+		}
+		var perr *PeerError
+		if err == nil || attempt >= p.retries || !errors.As(err, &perr) || !perr.Unavailable {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("peer %s: %w", peer, ctx.Err())
+		}
+		backoff *= 2
+	}
+}
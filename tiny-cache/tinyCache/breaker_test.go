@@ -0,0 +1,52 @@
+package tinyCache
+
+import (
+	"errors"
+	"testing"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newCircuitBreaker(3, time.Second)
+	b.now = func() time.Time { return now }
+	down := &PeerError{Peer: "p", Unavailable: true, Err: errors.New("connection refused")}
+
+	// 远程节点正常返回的错误不算失败，并且会清零连续失败的次数
+	b.record(down)
+	b.record(down)
+	b.record(&PeerError{Peer: "p", Code: pb.Code_INTERNAL, Err: errors.New("not exist")})
+	b.record(down)
+	b.record(down)
+	if !b.available() || !b.allow() {
+		t.Fatalf("breaker should stay closed below the threshold")
+	}
+
+	b.record(down)
+	if b.available() || b.allow() {
+		t.Fatalf("breaker should open after 3 consecutive failures")
+	}
+
+	// timeout 之后只放行一个试探请求
+	now = now.Add(time.Second)
+	if !b.available() || !b.allow() {
+		t.Fatalf("breaker should let a probe through after timeout")
+	}
+	if b.available() || b.allow() {
+		t.Fatalf("only one probe should be let through")
+	}
+	b.record(down)
+	if b.allow() {
+		t.Fatalf("failed probe should reopen the breaker")
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatalf("breaker should let a probe through after timeout")
+	}
+	b.record(nil)
+	if !b.allow() || !b.allow() {
+		t.Fatalf("successful probe should close the breaker")
+	}
+}
@@ -1,10 +1,14 @@
 package tinyCache
 
+import "time"
+
 // byteView 表示缓存值 缓存值的抽象和封装
 
 // A ByteView holds an immutable view of bytes.
 type ByteView struct {
-	b []byte
+	b       []byte
+	e       time.Time // 过期时间，零值表示永不过期
+	missing bool      // key 在数据源中不存在，b 是 Getter 返回的错误信息
 }
 
 // Len returns the view's length
@@ -22,6 +26,15 @@ func (v ByteView) String() string {
 	return string(v.b)
 }
 
+// Expire returns the time the view expires, or the zero time if it never expires.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -1,38 +1,132 @@
 package tinyCache
 
-// cache use mutex to protect lru entries
-// 操作 lru 的时候加锁 并发控制
+// cache use mutex to protect policy entries
+// 操作 policy 的时候加锁 并发控制
 
 import (
 	"sync"
-	"tiny-cache/tinyCache/lru"
+	"time"
+	"tiny-cache/tinyCache/policy"
 )
 
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	policy     policy.Policy
+	newPolicy  PolicyFactory // 为 nil 时使用 LRU
 	cacheBytes int64
+	now        func() time.Time // 为 nil 时使用 time.Now
+	removing   bool             // 正在执行 remove、clear 或者删除过期的值，删除的值不计入 nevict
+	nget, nhit int64
+	nevict     int64 // 为了腾出空间淘汰的值
+	nexpire    int64 // 过期之后删除的值
 }
 
-func (c *cache) add(key string, value ByteView) {
+func (c *cache) lazyInit() {
+	if c.policy == nil {
+		if c.newPolicy == nil {
+			c.newPolicy = LRU
+		}
+		c.policy = c.newPolicy(c.cacheBytes, func(string, policy.Value) {
+			if !c.removing {
+				c.nevict++
+			}
+		})
+	}
+}
+
+func (c *cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *cache) stats() CacheStats {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	stats := CacheStats{Gets: c.nget, Hits: c.nhit, Evictions: c.nevict, Expirations: c.nexpire}
+	if c.policy != nil {
+		stats.Bytes = c.policy.Bytes()
+		stats.Items = int64(c.policy.Len())
 	}
-	c.lru.Add(key, value)
+	return stats
 }
 
+// add 添加一个缓存值，value.Expire() 不为零时到期之后过期
+func (c *cache) add(key string, value ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lazyInit()
+	c.policy.Add(key, value)
+}
+
+// get 返回没有过期的缓存值，过期的值在访问的时候删除
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	c.nget++
+	if c.policy == nil {
 		return
 	}
 
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+	if v, ok := c.policy.Get(key); ok {
+		value = v.(ByteView)
+		if value.expired(c.clock()) {
+			c.expire(key)
+			return ByteView{}, false
+		}
+		c.nhit++
+		return value, true
 	}
 
 	return
 }
+
+// removeExpired 删除所有过期的缓存值
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return 0
+	}
+	now := c.clock()
+	var expired []string
+	c.policy.Range(func(key string, value policy.Value) bool {
+		if value.(ByteView).expired(now) {
+			expired = append(expired, key)
+		}
+		return true
+	})
+	for _, key := range expired {
+		c.expire(key)
+	}
+	return len(expired)
+}
+
+// expire 删除一个过期的值，计入 nexpire 而不是 nevict，调用者需要持有 c.mu
+func (c *cache) expire(key string) {
+	c.removing = true
+	c.policy.Remove(key)
+	c.removing = false
+	c.nexpire++
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy != nil {
+		c.removing = true
+		c.policy.Remove(key)
+		c.removing = false
+	}
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy != nil {
+		c.removing = true
+		c.policy.Clear()
+		c.removing = false
+	}
+}
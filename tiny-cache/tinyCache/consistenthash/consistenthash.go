@@ -10,10 +10,11 @@ type Hash func(data []byte) uint32 // 将 byte 数组转换为 uint32 的函数
 
 // Map 存储 hash 所有的 key
 type Map struct {
-	hash     Hash           // 允许用户替换成自定义的 hash 函数
-	replicas int            // 代表虚拟节点的倍数
-	keys     []int          // sorted keys
-	hashMap  map[int]string // 虚拟节点和 真实节点的映射表，键是虚拟节点的 hashValue key 是真实节点的名称
+	hash     Hash            // 允许用户替换成自定义的 hash 函数
+	replicas int             // 代表虚拟节点的倍数
+	keys     []int           // sorted keys
+	hashMap  map[int]string  // 虚拟节点和 真实节点的映射表，键是虚拟节点的 hashValue key 是真实节点的名称
+	nodes    map[string]bool // 已经添加的真实节点，重复添加时跳过
 }
 
 // New 函数允许自定义虚拟节点的倍数和 hash 函数
@@ -22,6 +23,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		nodes:    make(map[string]bool),
 	}
 
 	if m.hash == nil {
@@ -30,18 +32,47 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// Add 添加一个真实节点
+// Add 添加一个真实节点，已经存在的节点会被忽略
 func (m *Map) Add(keys ...string) { // 允许传入 0 或多个 真实节点的名称
 	for _, key := range keys { // 对于每一个真实节点 key 创建 m.replicas 个虚拟节点
+		if m.nodes[key] {
+			continue
+		}
+		m.nodes[key] = true
 		for i := 0; i < m.replicas; i++ {
 			hashValue := int(m.hash([]byte(strconv.Itoa(i) + key))) // 虚拟节点的名称，使用 m.hash 计算出具体的 hashValue
-			m.keys = append(m.keys, hashValue)
+			if _, ok := m.hashMap[hashValue]; !ok {                 // 冲突的虚拟节点只在环上出现一次
+				m.keys = append(m.keys, hashValue)
+			}
 			m.hashMap[hashValue] = key
 		}
 	}
 	sort.Ints(m.keys) // 将环上面的 hashValue 进行排序
 }
 
+// Remove 删除真实节点以及它所有的虚拟节点，其他节点上的 key 不会移动
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		if !m.nodes[key] {
+			continue
+		}
+		delete(m.nodes, key)
+		for i := 0; i < m.replicas; i++ {
+			hashValue := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			if m.hashMap[hashValue] == key { // 发生冲突时虚拟节点可能已经属于其他节点
+				delete(m.hashMap, hashValue)
+			}
+		}
+	}
+	kept := m.keys[:0]
+	for _, hashValue := range m.keys {
+		if _, ok := m.hashMap[hashValue]; ok {
+			kept = append(kept, hashValue)
+		}
+	}
+	m.keys = kept
+}
+
 // Get 根据给定的 key 得到具体使用的 node
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
@@ -56,3 +87,27 @@ func (m *Map) Get(key string) string {
 
 	return m.hashMap[m.keys[idx%len(m.keys)]] // 在数组上面取余数就可以成环
 }
+
+// GetN 返回从 key 的位置开始顺时针遇到的 n 个不同的真实节点，第一个节点和 Get 的结果相同
+// 真实节点不足 n 个时返回所有的真实节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -41,3 +42,115 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2", "8")
+	hash.Remove("8")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	if len(hash.keys) != 9 || len(hash.hashMap) != 9 {
+		t.Fatalf("expect 9 virtual nodes left, got %d", len(hash.keys))
+	}
+
+	hash.Remove("6", "4", "2")
+	if hash.Get("2") != "" {
+		t.Fatalf("empty ring should yield nothing")
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4")
+	hash.Add("6")
+	if len(hash.keys) != 6 || len(hash.hashMap) != 6 {
+		t.Fatalf("re-adding a node should not duplicate virtual nodes, got %d", len(hash.keys))
+	}
+	hash.Remove("6")
+	if len(hash.keys) != 3 || hash.Get("6") != "4" {
+		t.Fatalf("expect only the virtual nodes of 4 left, got %v", hash.keys)
+	}
+}
+
+// TestRebalance 检查加入第 N 个节点时只有大约 1/N 的 key 移动，并且都移动到新的节点上
+func TestRebalance(t *testing.T) {
+	const keys = 10000
+	hash := New(50, nil)
+	hash.Add("node1", "node2", "node3", "node4", "node5")
+	before := make([]string, keys)
+	for i := range before {
+		before[i] = hash.Get("key" + strconv.Itoa(i))
+	}
+
+	hash.Add("node6")
+	moved := 0
+	for i := range before {
+		node := hash.Get("key" + strconv.Itoa(i))
+		if node != before[i] {
+			moved++
+			if node != "node6" {
+				t.Fatalf("key%d moved from %s to %s instead of node6", i, before[i], node)
+			}
+		}
+	}
+	if ratio := float64(moved) / keys; ratio < 1.0/6/2 || ratio > 1.0/6*2 {
+		t.Fatalf("expect about 1/6 of keys to move, %.3f moved", ratio)
+	}
+
+	hash.Remove("node6")
+	for i := range before {
+		if node := hash.Get("key" + strconv.Itoa(i)); node != before[i] {
+			t.Fatalf("key%d should move back to %s after removing node6, got %s", i, before[i], node)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string][]string{
+		"2":  {"2", "4", "6"},
+		"11": {"2", "4", "6"},
+		"15": {"6", "2", "4"},
+		"27": {"2", "4", "6"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 3); !reflect.DeepEqual(got, v) {
+			t.Errorf("Asking for %s, should have yielded %v, got %v", k, v, got)
+		}
+		if got := hash.GetN(k, 1); got[0] != hash.Get(k) {
+			t.Errorf("GetN(%s, 1) should be the same as Get, got %v", k, got)
+		}
+	}
+
+	if got := hash.GetN("15", 2); !reflect.DeepEqual(got, []string{"6", "2"}) {
+		t.Errorf("expect [6 2], got %v", got)
+	}
+	if got := hash.GetN("15", 5); len(got) != 3 {
+		t.Errorf("expect all 3 nodes, got %v", got)
+	}
+	if got := New(3, nil).GetN("15", 2); got != nil {
+		t.Errorf("empty ring should yield nothing, got %v", got)
+	}
+}
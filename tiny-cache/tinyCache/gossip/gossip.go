@@ -0,0 +1,618 @@
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+
+SWIM 风格的集群成员管理和故障检测，节点之间使用 UDP 通信
+
+	故障检测   每一个 ProbeInterval 依次 ping 一个成员，ProbeTimeout 内没有收到 ack 时，
+	           请 IndirectChecks 个其他成员代为 ping（ping-req），仍然没有 ack 时把它标记为 suspect
+	疑似故障   suspect 的成员在 SuspectTimeout 之后被标记为 dead，在这之前它可以增加 incarnation 反驳
+	传播       成员状态的变化捎带在 ping / ack / ping-req 消息上传播，每一条变化被捎带
+	           RetransmitMult * ceil(log10(n+1)) 次
+	加入       新节点向种子节点发送 join，种子节点返回自己知道的所有成员
+
+	node, _ := gossip.New(gossip.Config{Name: "http://localhost:8001", BindAddr: "localhost:7001"})
+	node.Join("localhost:7002")
+	for _, m := range node.Members() { ... }
+
+*/
+
+// State 是成员的状态
+type State uint8
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	}
+	return fmt.Sprintf("State(%d)", uint8(s))
+}
+
+// Member 是集群中的一个成员
+type Member struct {
+	Name        string `json:"name"` // 成员的名称，tinyCache 中是节点的缓存地址
+	Addr        string `json:"addr"` // gossip 使用的 UDP 地址
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"inc"` // 只有成员自己可以增加，用于反驳 suspect
+}
+
+// Config 是节点的配置，零值的字段使用默认值
+type Config struct {
+	Name           string        // 节点的名称，在集群中唯一
+	BindAddr       string        // 监听的 UDP 地址，例如 "localhost:7001"
+	AdvertiseAddr  string        // 其他成员使用的地址，默认是实际监听的地址
+	ProbeInterval  time.Duration // 默认 1s
+	ProbeTimeout   time.Duration // 默认 ProbeInterval / 3
+	SuspectTimeout time.Duration // 默认 5 * ProbeInterval
+	IndirectChecks int           // 默认 3
+	RetransmitMult int           // 默认 4
+}
+
+const (
+	defaultProbeInterval  = time.Second
+	defaultIndirectChecks = 3
+	defaultRetransmitMult = 4
+	maxPiggyback          = 8 // 每一条消息最多捎带的状态变化
+	maxPacketSize         = 64 << 10
+)
+
+// ErrClosed is returned after the node is closed.
+var ErrClosed = errors.New("gossip: node closed")
+
+type msgType uint8
+
+const (
+	msgPing msgType = iota + 1
+	msgAck
+	msgPingReq
+	msgJoin
+	msgSync
+	msgLeave
+)
+
+type message struct {
+	Type       msgType  `json:"t"`
+	Seq        uint64   `json:"seq,omitempty"`
+	Target     string   `json:"target,omitempty"`      // ping-req 中需要代为 ping 的地址
+	TargetName string   `json:"target_name,omitempty"` // ping 的对象，地址被新的节点复用时对方不会回复
+	Members    []Member `json:"members,omitempty"`     // 捎带的状态变化，join 和 sync 中是完整的成员列表
+}
+
+// broadcast 是一条等待捎带的状态变化
+type broadcast struct {
+	member    Member
+	transmits int
+}
+
+// Node 是集群中的一个节点
+type Node struct {
+	cfg  Config
+	conn *net.UDPConn
+	self string
+	addr string
+
+	mu         sync.Mutex // guards following
+	members    map[string]*Member
+	timers     map[string]*time.Timer // suspect 成员的超时
+	queue      []*broadcast
+	seq        uint64
+	acks       map[uint64]func()
+	probeOrder []string
+	changed    chan struct{}          // 成员变化时关闭并替换
+	drop       func(addr string) bool // 测试用，返回 true 时不发送
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New 创建节点并开始监听和探测，节点需要调用 Join 加入集群
+func New(cfg Config) (*Node, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("gossip: node name is required")
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 || cfg.ProbeTimeout >= cfg.ProbeInterval {
+		cfg.ProbeTimeout = cfg.ProbeInterval / 3
+	}
+	if cfg.SuspectTimeout <= 0 {
+		cfg.SuspectTimeout = 5 * cfg.ProbeInterval
+	}
+	if cfg.IndirectChecks <= 0 {
+		cfg.IndirectChecks = defaultIndirectChecks
+	}
+	if cfg.RetransmitMult <= 0 {
+		cfg.RetransmitMult = defaultRetransmitMult
+	}
+	laddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.AdvertiseAddr
+	if addr == "" {
+		addr = conn.LocalAddr().String()
+	}
+
+	n := &Node{
+		cfg:     cfg,
+		conn:    conn,
+		self:    cfg.Name,
+		addr:    addr,
+		members: map[string]*Member{cfg.Name: {Name: cfg.Name, Addr: addr, State: StateAlive}},
+		timers:  make(map[string]*time.Timer),
+		acks:    make(map[uint64]func()),
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	n.wg.Add(2)
+	go n.readLoop()
+	go n.probeLoop()
+	return n, nil
+}
+
+// Addr 返回其他成员访问这个节点使用的 UDP 地址
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Join 通过种子节点加入集群，至少一个种子节点回复时返回 nil
+func (n *Node) Join(seeds ...string) error {
+	n.mu.Lock()
+	self := *n.members[n.self]
+	n.mu.Unlock()
+
+	joined := make(chan struct{}, 1)
+	var seqs []uint64
+	for _, seed := range seeds {
+		if seed == n.addr {
+			continue
+		}
+		seq := n.expectAck(func() {
+			select {
+			case joined <- struct{}{}:
+			default:
+			}
+		})
+		seqs = append(seqs, seq)
+		n.send(seed, &message{Type: msgJoin, Seq: seq, Members: []Member{self}})
+	}
+	defer func() {
+		for _, seq := range seqs {
+			n.cancelAck(seq)
+		}
+	}()
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	select {
+	case <-joined:
+		return nil
+	case <-time.After(n.cfg.ProbeInterval):
+		return fmt.Errorf("gossip: no seed responded: %v", seeds)
+	case <-n.done:
+		return ErrClosed
+	}
+}
+
+// Members 返回所有已知的成员，包括自己和 dead 的成员，按照名称排列
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.membersLocked()
+}
+
+func (n *Node) membersLocked() []Member {
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// Watch 先调用一次 update，之后在成员变化时再次调用，直到 ctx 被取消或者节点被关闭
+func (n *Node) Watch(ctx context.Context, update func(members []Member)) error {
+	for {
+		n.mu.Lock()
+		changed, members := n.changed, n.membersLocked()
+		n.mu.Unlock()
+		update(members)
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-n.done:
+			return ErrClosed
+		}
+	}
+}
+
+// Leave 通知其他成员自己离开集群，然后关闭节点
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	self := n.members[n.self]
+	self.Incarnation++
+	self.State = StateDead
+	var targets []string
+	for _, m := range n.members {
+		if m.Name != n.self && m.State != StateDead {
+			targets = append(targets, m.Addr)
+		}
+	}
+	leave := *self
+	n.mu.Unlock()
+
+	for _, addr := range targets {
+		n.send(addr, &message{Type: msgLeave, Members: []Member{leave}})
+	}
+	return n.Close()
+}
+
+// Close 停止节点，不通知其他成员，可以重复以及并发调用，返回第一次关闭的结果
+func (n *Node) Close() error {
+	n.closeOnce.Do(func() {
+		close(n.done)
+		n.closeErr = n.conn.Close()
+		n.wg.Wait()
+
+		n.mu.Lock()
+		for name, t := range n.timers {
+			t.Stop()
+			delete(n.timers, name)
+		}
+		n.mu.Unlock()
+	})
+	return n.closeErr
+}
+
+// probeLoop 每一个 ProbeInterval 探测一个成员
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.probe()
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// probe 直接 ping 下一个成员，超时之后请其他成员代为 ping，仍然没有回复时把它标记为 suspect
+func (n *Node) probe() {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+	acked := make(chan struct{}, 1)
+	seq := n.expectAck(func() {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	})
+	defer n.cancelAck(seq)
+
+	n.send(target.Addr, &message{Type: msgPing, Seq: seq, TargetName: target.Name})
+	select {
+	case <-acked:
+		return
+	case <-time.After(n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	for _, m := range n.randomMembers(n.cfg.IndirectChecks, target.Name) {
+		n.send(m.Addr, &message{Type: msgPingReq, Seq: seq, Target: target.Addr, TargetName: target.Name})
+	}
+	select {
+	case <-acked:
+		return
+	case <-time.After(n.cfg.ProbeInterval - n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if m, ok := n.members[target.Name]; ok && m.State == StateAlive {
+		log.Printf("[gossip %s] suspect %s", n.self, target.Name)
+		n.applyLocked(Member{Name: m.Name, Addr: m.Addr, State: StateSuspect, Incarnation: m.Incarnation})
+	}
+}
+
+// nextTarget 按照随机打乱的顺序轮流选择没有 dead 的成员
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for {
+		if len(n.probeOrder) == 0 {
+			for name, m := range n.members {
+				if name != n.self && m.State != StateDead {
+					n.probeOrder = append(n.probeOrder, name)
+				}
+			}
+			if len(n.probeOrder) == 0 {
+				return Member{}, false
+			}
+			rand.Shuffle(len(n.probeOrder), func(i, j int) {
+				n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+			})
+		}
+		name := n.probeOrder[0]
+		n.probeOrder = n.probeOrder[1:]
+		if m, ok := n.members[name]; ok && m.State != StateDead {
+			return *m, true
+		}
+	}
+}
+
+// randomMembers 随机选择最多 k 个 alive 的成员，不包括自己和 exclude
+func (n *Node) randomMembers(k int, exclude string) []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var candidates []Member
+	for name, m := range n.members {
+		if name != n.self && name != exclude && m.State == StateAlive {
+			candidates = append(candidates, *m)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// expectAck 分配一个 seq，收到这个 seq 的 ack 时调用 fn
+func (n *Node) expectAck(fn func()) uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.seq++
+	n.acks[n.seq] = fn
+	return n.seq
+}
+
+func (n *Node) cancelAck(seq uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.acks, seq)
+}
+
+func (n *Node) readLoop() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			log.Printf("[gossip %s] read: %v", n.self, err)
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:size], &msg); err != nil {
+			log.Printf("[gossip %s] decode message from %v: %v", n.self, from, err)
+			continue
+		}
+		n.handle(from.String(), &msg)
+	}
+}
+
+// handle 处理一条消息，from 是发送方的地址
+func (n *Node) handle(from string, msg *message) {
+	if msg.Type != msgJoin && msg.Type != msgSync {
+		n.mu.Lock()
+		for _, m := range msg.Members {
+			n.applyLocked(m)
+		}
+		n.mu.Unlock()
+	}
+
+	switch msg.Type {
+	case msgPing:
+		if msg.TargetName == "" || msg.TargetName == n.self {
+			n.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		}
+	case msgAck:
+		n.mu.Lock()
+		fn := n.acks[msg.Seq]
+		n.mu.Unlock()
+		if fn != nil && msg.Seq != 0 {
+			fn()
+		}
+	case msgPingReq:
+		// 代为 ping，收到 ack 时使用原来的 seq 回复请求方
+		seq := n.expectAck(func() {
+			n.send(from, &message{Type: msgAck, Seq: msg.Seq})
+		})
+		time.AfterFunc(n.cfg.ProbeTimeout, func() { n.cancelAck(seq) })
+		n.send(msg.Target, &message{Type: msgPing, Seq: seq, TargetName: msg.TargetName})
+	case msgJoin:
+		n.mu.Lock()
+		for _, m := range msg.Members {
+			n.applyLocked(m)
+		}
+		members := n.membersLocked()
+		n.mu.Unlock()
+		n.send(from, &message{Type: msgSync, Seq: msg.Seq, Members: members})
+	case msgSync:
+		n.mu.Lock()
+		for _, m := range msg.Members {
+			n.applyLocked(m)
+		}
+		fn := n.acks[msg.Seq]
+		n.mu.Unlock()
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// applyLocked 合并一条成员状态，状态发生变化时继续传播
+//
+//	alive   incarnation 更大时覆盖 alive 和 suspect
+//	suspect incarnation 不小于 alive，或者大于 suspect 时覆盖
+//	dead    incarnation 不小于当前时覆盖 alive 和 suspect
+//
+// 关于自己的 suspect 和 dead 通过增加 incarnation 反驳
+func (n *Node) applyLocked(u Member) {
+	if u.Name == n.self {
+		self := n.members[n.self]
+		if self.State == StateAlive && u.State != StateAlive && u.Incarnation >= self.Incarnation {
+			self.Incarnation = u.Incarnation + 1
+			log.Printf("[gossip %s] refute %v, incarnation %d", n.self, u.State, self.Incarnation)
+			n.enqueueLocked(*self)
+		}
+		return
+	}
+
+	cur, ok := n.members[u.Name]
+	if ok {
+		switch u.State {
+		case StateAlive:
+			if u.Incarnation <= cur.Incarnation {
+				return
+			}
+		case StateSuspect:
+			if cur.State == StateDead || u.Incarnation < cur.Incarnation ||
+				(cur.State == StateSuspect && u.Incarnation == cur.Incarnation) {
+				return
+			}
+		case StateDead:
+			if cur.State == StateDead || u.Incarnation < cur.Incarnation {
+				return
+			}
+		}
+	}
+
+	m := u
+	n.members[u.Name] = &m
+	if t, ok := n.timers[u.Name]; ok {
+		t.Stop()
+		delete(n.timers, u.Name)
+	}
+	if u.State == StateSuspect {
+		n.timers[u.Name] = time.AfterFunc(n.cfg.SuspectTimeout, func() { n.suspectTimeout(u) })
+	}
+	if !ok || cur.State != u.State {
+		log.Printf("[gossip %s] %s is %v", n.self, u.Name, u.State)
+	}
+	n.enqueueLocked(u)
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// suspectTimeout 在 SuspectTimeout 之内没有被反驳的 suspect 成员被标记为 dead
+func (n *Node) suspectTimeout(u Member) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if m, ok := n.members[u.Name]; ok && m.State == StateSuspect && m.Incarnation == u.Incarnation {
+		n.applyLocked(Member{Name: u.Name, Addr: u.Addr, State: StateDead, Incarnation: u.Incarnation})
+	}
+}
+
+// enqueueLocked 把状态变化放入捎带队列，替换同一个成员之前的状态
+func (n *Node) enqueueLocked(m Member) {
+	for i, b := range n.queue {
+		if b.member.Name == m.Name {
+			n.queue = append(n.queue[:i], n.queue[i+1:]...)
+			break
+		}
+	}
+	n.queue = append(n.queue, &broadcast{member: m})
+}
+
+// piggybackLocked 取出最多 maxPiggyback 条发送次数最少的状态变化
+func (n *Node) piggybackLocked() []Member {
+	if len(n.queue) == 0 {
+		return nil
+	}
+	limit := n.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+1))))
+	sort.SliceStable(n.queue, func(i, j int) bool { return n.queue[i].transmits < n.queue[j].transmits })
+	var members []Member
+	for _, b := range n.queue {
+		if len(members) == maxPiggyback {
+			break
+		}
+		members = append(members, b.member)
+		b.transmits++
+	}
+	kept := n.queue[:0]
+	for _, b := range n.queue {
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	n.queue = kept
+	return members
+}
+
+// send 发送一条消息，ping / ack / ping-req 会捎带状态变化
+func (n *Node) send(addr string, msg *message) {
+	n.mu.Lock()
+	if n.drop != nil && n.drop(addr) {
+		n.mu.Unlock()
+		return
+	}
+	if msg.Type == msgPing || msg.Type == msgAck || msg.Type == msgPingReq {
+		msg.Members = append(msg.Members, n.piggybackLocked()...)
+	}
+	n.mu.Unlock()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[gossip %s] encode message: %v", n.self, err)
+		return
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err == nil {
+		_, err = n.conn.WriteToUDP(data, raddr)
+	}
+	if err != nil {
+		select {
+		case <-n.done:
+		default:
+			log.Printf("[gossip %s] send to %s: %v", n.self, addr, err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// newCluster 启动 size 个节点，除了第一个节点之外都通过第一个节点加入集群
+func newCluster(t *testing.T, size int) []*Node {
+	t.Helper()
+	nodes := make([]*Node, size)
+	for i := range nodes {
+		n, err := New(Config{
+			Name:           fmt.Sprintf("node%d", i),
+			BindAddr:       "localhost:0",
+			ProbeInterval:  30 * time.Millisecond,
+			ProbeTimeout:   10 * time.Millisecond,
+			SuspectTimeout: 150 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { n.Close() })
+		nodes[i] = n
+		if i > 0 {
+			if err := n.Join(nodes[0].Addr()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return nodes
+}
+
+// states 返回 n 看到的每一个成员的状态
+func states(n *Node) map[string]State {
+	states := make(map[string]State)
+	for _, m := range n.Members() {
+		states[m.Name] = m.State
+	}
+	return states
+}
+
+// eventually 在 timeout 之内等待 cond 成立
+func eventually(t *testing.T, timeout time.Duration, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func allAlive(n *Node, size int) bool {
+	s := states(n)
+	if len(s) != size {
+		return false
+	}
+	for _, state := range s {
+		if state != StateAlive {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJoin(t *testing.T) {
+	nodes := newCluster(t, 4)
+	for _, n := range nodes {
+		eventually(t, 2*time.Second, func() bool { return allAlive(n, 4) },
+			"%s should see 4 alive members, got %v", n.self, states(n))
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes {
+		eventually(t, 2*time.Second, func() bool { return allAlive(n, 3) }, "cluster did not converge")
+	}
+
+	nodes[2].Close()
+	for _, n := range nodes[:2] {
+		eventually(t, 2*time.Second, func() bool { return states(n)["node2"] == StateSuspect || states(n)["node2"] == StateDead },
+			"%s should suspect node2, got %v", n.self, states(n))
+		eventually(t, 2*time.Second, func() bool { return states(n)["node2"] == StateDead },
+			"%s should declare node2 dead, got %v", n.self, states(n))
+	}
+}
+
+// TestIndirectProbe node0 和 node2 之间的网络不通，但是 node1 可以代为 ping，所以 node2 不会被怀疑
+func TestIndirectProbe(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes {
+		eventually(t, 2*time.Second, func() bool { return allAlive(n, 3) }, "cluster did not converge")
+	}
+
+	block := func(n *Node, addr string) {
+		n.mu.Lock()
+		n.drop = func(to string) bool { return to == addr }
+		n.mu.Unlock()
+	}
+	block(nodes[0], nodes[2].Addr())
+	block(nodes[2], nodes[0].Addr())
+
+	var watched []map[string]State
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	nodes[0].Watch(ctx, func(members []Member) {
+		s := make(map[string]State)
+		for _, m := range members {
+			s[m.Name] = m.State
+		}
+		watched = append(watched, s)
+	})
+	for _, s := range watched {
+		if s["node2"] != StateAlive {
+			t.Fatalf("node2 should never be suspected, got %v", s)
+		}
+	}
+	if !allAlive(nodes[0], 3) {
+		t.Fatalf("node2 should stay alive, got %v", states(nodes[0]))
+	}
+}
+
+// TestRefute 被错误怀疑的节点增加 incarnation 反驳
+func TestRefute(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes {
+		eventually(t, 2*time.Second, func() bool { return allAlive(n, 3) }, "cluster did not converge")
+	}
+
+	n := nodes[0]
+	n.mu.Lock()
+	m := *n.members["node1"]
+	m.State = StateSuspect
+	n.applyLocked(m)
+	n.mu.Unlock()
+
+	eventually(t, time.Second, func() bool {
+		for _, m := range n.Members() {
+			if m.Name == "node1" {
+				return m.State == StateAlive && m.Incarnation > 0
+			}
+		}
+		return false
+	}, "node1 should refute the suspicion, got %v", n.Members())
+}
+
+func TestLeave(t *testing.T) {
+	nodes := newCluster(t, 3)
+	for _, n := range nodes {
+		eventually(t, 2*time.Second, func() bool { return allAlive(n, 3) }, "cluster did not converge")
+	}
+
+	if err := nodes[1].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{nodes[0], nodes[2]} {
+		// 离开的节点直接被标记为 dead，不经过 suspect
+		eventually(t, 100*time.Millisecond, func() bool { return states(n)["node1"] == StateDead },
+			"%s should see node1 leave, got %v", n.self, states(n))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	nodes := newCluster(t, 1)
+	updates := make(chan []Member, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- nodes[0].Watch(ctx, func(members []Member) { updates <- members }) }()
+
+	if members := <-updates; len(members) != 1 || members[0].Name != "node0" {
+		t.Fatalf("first update should contain only node0, got %v", members)
+	}
+	other, err := New(Config{Name: "other", BindAddr: "localhost:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Join(nodes[0].Addr()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case members := <-updates:
+		if len(members) != 2 {
+			t.Fatalf("expect 2 members after join, got %v", members)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect an update after join")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	nodes := newCluster(t, 1)
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- nodes[0].Close() }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Close returned %v", err)
+		}
+	}
+	if err := nodes[0].Leave(); err != nil {
+		t.Fatalf("Leave after Close returned %v", err)
+	}
+}
@@ -1,35 +1,139 @@
 package tinyCache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-	"sync"
-	"tiny-cache/tinyCache/consistenthash"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+	"tiny-cache/tinyCache/placement"
+
+	"github.com/golang/protobuf/proto"
 )
 
 const defaultBasePath = "/_cache"
 const defaultReplicas = 50
 
+/*
+
+节点之间的协议版本
+
+	v1  GET 返回值的原始字节，出错时返回 http.Error 的文本
+	v2  GET 返回 protobuf 编码的 cachepb.Response，包括值剩余的有效时间和错误类型
+	    PUT / DELETE 成功时返回 204，出错时同样返回 cachepb.Response
+
+客户端在 protocolHeader 中带上自己支持的版本，服务端按照两者中较小的版本响应，
+并且在响应的 protocolHeader 中返回这个版本，没有这个响应头说明对方是 v1 的节点，
+所以新旧版本的节点可以混合部署
+
+*/
+
+const (
+	protocolHeader  = "X-Cache-Protocol"
+	protocolVersion = 2
+	timeoutHeader   = "X-Cache-Timeout" // GET 请求中调用者剩余的毫秒数，和 Request.timeout_ms 相同
+)
+
+// ErrWriteUnsupported 表示远程节点是 v1 的节点，它不支持写操作，会把 PUT / DELETE 当成 GET 处理并且返回 200
+var ErrWriteUnsupported = errors.New("tinyCache: peer does not support writes")
+
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
-	self        string
-	basePath    string
-	mu          sync.Mutex             // guards peers and httpGetters
-	peers       *consistenthash.Map    // 类型是一致性哈希算法中的 map 用来根据具体的 key 选择节点
-	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
-	// 用来映射远程节点和对应的 httpGetter 每一个远程节点对应一个 httpGetter 因为 httpGetter 和远程节点的地址 baseUrl 相关
+	self     string
+	basePath string
+	// 一致性哈希环以及每一个远程节点对应的 httpGetter，keyed by e.g. "http://10.0.0.2:8008"
+	// 每一个远程节点对应一个 httpGetter 因为 httpGetter 和远程节点的地址 baseUrl 相关
+	peers peerRing
+}
+
+// HTTPPoolOptions are the configurations of a HTTPPool.
+// 零值的字段使用默认值
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve tinyCache requests.
+	// If blank, it defaults to "/_cache".
+	BasePath string
+
+	// Placement 是选择节点的算法，默认是 50 个虚拟节点、CRC32 的 consistenthash.Map
+	// 一个 Placement 只能给一个 pool 使用
+	Placement placement.Placement
+
+	// Client 是访问远程节点使用的客户端，设置之后 ConnectTimeout 和 RequestTimeout 不再生效
+	Client *http.Client
+	// ConnectTimeout 是建立连接的超时时间，默认 1s
+	ConnectTimeout time.Duration
+	// RequestTimeout 是每一次请求（包括读取响应）的超时时间，默认 3s
+	RequestTimeout time.Duration
+
+	// MaxRetries 是远程节点不可用时的最多重试次数，默认 2 次，小于 0 时不重试
+	// 远程节点正常返回的错误（例如 Getter 失败）不会重试
+	MaxRetries int
+	// RetryBackoff 是第一次重试之前等待的时间，之后每次翻倍，默认 20ms
+	RetryBackoff time.Duration
+
+	// BreakerThreshold 是熔断器打开之前连续失败的次数，默认 5 次，小于 0 时不使用熔断器
+	BreakerThreshold int
+	// BreakerTimeout 是熔断器打开之后到放行试探请求的时间，默认 5s
+	BreakerTimeout time.Duration
 }
 
-// NewHTTPPool initializes an HTTP pool of peers.
+const defaultRequestTimeout = 3 * time.Second
+
+// NewHTTPPool initializes an HTTP pool of peers with the default options.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	var opts HTTPPoolOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.BasePath == "" {
+		opts.BasePath = defaultBasePath
+	}
+	client := opts.Client
+	if client == nil {
+		client = newHTTPClient(opts.ConnectTimeout, opts.RequestTimeout)
+	}
+
+	p := &HTTPPool{
 		self:     self,
-		basePath: defaultBasePath,
+		basePath: opts.BasePath,
 	}
+	p.peers = peerRing{self: self, ring: opts.Placement, newGetter: func(peer string) PeerGetter {
+		return &httpGetter{
+			peer:       peer,
+			baseURL:    peer + p.basePath,
+			client:     client,
+			peerPolicy: newPeerPolicy(opts.MaxRetries, opts.RetryBackoff, opts.BreakerThreshold, opts.BreakerTimeout),
+		}
+	}}
+	return p
+}
+
+// newHTTPClient 创建一个带有连接超时和请求超时的客户端，所有节点共用它的连接池
+func newHTTPClient(connectTimeout, requestTimeout time.Duration) *http.Client {
+	if connectTimeout <= 0 {
+		connectTimeout = defaultDialTimeout
+	}
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	return &http.Client{Transport: transport, Timeout: requestTimeout}
 }
 
 // Log info with server name
@@ -38,104 +142,323 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 }
 
 // ServeHTTP handle all http requests
+//
+//	GET    /<basePath>/<groupName>/<key>   读取
+//	PUT    /<basePath>/<groupName>/<key>   写入，body 是 protobuf 编码的 cachepb.SetRequest
+//	DELETE /<basePath>/<groupName>/<key>   删除
+//	DELETE /<basePath>/<groupName>         清空 group
+//
+// 写操作只修改本机的缓存，不会再转发给其他节点
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-
-	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path + "\n")
+	// 不在 basePath 下的路径返回 404，HTTPPool 可能和其他 handler 挂在同一个 mux 上
+	if !strings.HasPrefix(r.URL.Path, p.basePath+"/") {
+		http.NotFound(w, r)
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
 
-	// /<basePath>/<groupName>/<key> required
-	parts := strings.SplitN(r.URL.Path[len(p.basePath)+1:], "/", 2)
-	// parts := strings.SplitN(r.URL.Path, "/", 2)
-
-	// fmt.Println()
-	// fmt.Println(parts)
-	// fmt.Println()
-	// for debug
+	version := 1
+	if v, err := strconv.Atoi(r.Header.Get(protocolHeader)); err == nil && v > 1 {
+		version = protocolVersion
+	}
 
-	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	parts := strings.SplitN(r.URL.Path[len(p.basePath)+1:], "/", 2)
+	groupName := parts[0]
+	if groupName == "" { // /_cache/ 或者 /_cache//key
+		writeError(w, version, pb.Code_BAD_REQUEST, "bad request: missing group name")
 		return
 	}
+	if len(parts) != 2 || parts[1] == "" {
+		if r.Method != http.MethodDelete {
+			writeError(w, version, pb.Code_BAD_REQUEST, "bad request")
+			return
+		}
+		writeResult(w, version, serveClear(&pb.Request{Group: groupName}))
+		return
+	}
+	in := &pb.Request{Group: groupName, Key: parts[1]}
 
-	groupName := parts[0]
-	key := parts[1]
+	switch r.Method {
+	case http.MethodGet:
+		if ms, err := strconv.ParseInt(r.Header.Get(timeoutHeader), 10, 64); err == nil && ms > 0 {
+			in.TimeoutMs = ms
+		}
+		res := serveGet(r.Context(), in)
+		if version == 1 && res.GetCode() == pb.Code_OK {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(res.GetValue())
+			return
+		}
+		if version == 1 {
+			writeError(w, version, res.GetCode(), res.GetError())
+			return
+		}
+		writeResponse(w, codeStatus[res.GetCode()], res) // NOT_FOUND 的响应中有可以缓存的时间
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, version, pb.Code_BAD_REQUEST, err.Error())
+			return
+		}
+		req := &pb.SetRequest{}
+		if err = proto.Unmarshal(body, req); err != nil {
+			writeError(w, version, pb.Code_BAD_REQUEST, "decoding request body: "+err.Error())
+			return
+		}
+		req.Group, req.Key = in.Group, in.Key
+		writeResult(w, version, serveSet(req))
+	case http.MethodDelete:
+		writeResult(w, version, serveRemove(in))
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-	group := GetGroup(groupName)
-	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+// writeResult 返回写操作的结果，成功时返回 204
+func writeResult(w http.ResponseWriter, version int, res *pb.Response) {
+	if res.GetCode() != pb.Code_OK {
+		writeError(w, version, res.GetCode(), res.GetError())
 		return
 	}
+	if version > 1 {
+		w.Header().Set(protocolHeader, strconv.Itoa(protocolVersion))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	view, err := group.Get(key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+var codeStatus = map[pb.Code]int{
+	pb.Code_OK:            http.StatusOK,
+	pb.Code_INTERNAL:      http.StatusInternalServerError,
+	pb.Code_NO_SUCH_GROUP: http.StatusNotFound,
+	pb.Code_BAD_REQUEST:   http.StatusBadRequest,
+	pb.Code_NOT_FOUND:     http.StatusNotFound,
+
+	pb.Code_DEADLINE_EXCEEDED: http.StatusGatewayTimeout,
+}
+
+// writeError 按照协议版本返回错误，v1 使用纯文本，v2 使用 cachepb.Response
+func writeError(w http.ResponseWriter, version int, code pb.Code, msg string) {
+	if version == 1 {
+		http.Error(w, msg, codeStatus[code])
 		return
 	}
+	writeResponse(w, codeStatus[code], &pb.Response{Code: code, Error: msg})
+}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	_, err = w.Write(view.ByteSlice())
+func writeResponse(w http.ResponseWriter, status int, res *pb.Response) {
+	body, err := proto.Marshal(res)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set(protocolHeader, strconv.Itoa(protocolVersion))
+	w.WriteHeader(status)
+	w.Write(body)
 }
 
-// Set 实例化一致性哈希算法，并且添加了传入的节点
-// 并且为每一个节点创建了一个 http 客户端 httpGetter
+// Set 将节点设置为 peers，并且为每一个新的节点创建一个 http 客户端 httpGetter
+// 已经存在的节点保持不变，所以重复调用 Set 只会移动新增和删除的节点上的 key
 func (p *HTTPPool) Set(peers ...string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	p.peers.set(peers...)
+}
 
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
-	}
+// AddPeer 在运行时添加节点
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.peers.add(peers...)
+}
+
+// RemovePeer 在运行时删除节点
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.peers.remove(peers...)
+}
+
+// SetSuspect 设置疑似故障的节点，PickPeer 不会选择这些节点，它们的 key 回退到本机加载
+func (p *HTTPPool) SetSuspect(peers ...string) {
+	p.peers.setSuspect(peers...)
+}
+
+// Peers 返回当前所有节点的地址，包括本机
+func (p *HTTPPool) Peers() []string {
+	return p.peers.names()
 }
 
 // PickPeer 包装了一致性哈希算法的 Get() 方法，根据具体的 key，选择节点，返回节点对应的 HTTP 客户端。
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	if peer, getter, ok := p.peers.pick(key); ok {
 		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+		return getter, true
 	}
 	return nil, false
 }
 
+// PickReplicas 按照顺序返回 key 所在的 n 个节点，本机用 nil 表示
+func (p *HTTPPool) PickReplicas(key string, n int) []PeerGetter {
+	return p.peers.pickN(key, n)
+}
+
+// ListPeers 返回除了本机之外所有节点的 httpGetter
+func (p *HTTPPool) ListPeers() []PeerGetter {
+	return p.peers.list()
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ PeerLister = (*HTTPPool)(nil)
+var _ ReplicaPicker = (*HTTPPool)(nil)
 
 type httpGetter struct {
-	baseURL string
-}
-
-// Get 方法获取返回值，并且转换为 byte 类型
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
-	u := fmt.Sprintf(
-		"%v%v/%v",
-		h.baseURL,
-		url.QueryEscape(group),
-		url.QueryEscape(key),
-	)
-	res, err := http.Get(u)
+	peerPolicy // 重试和熔断
+	peer       string
+	baseURL    string
+	client     *http.Client
+}
+
+// url 返回 group 或者 group 中 key 对应的地址
+func (h *httpGetter) url(group string, key ...string) string {
+	u := h.baseURL + "/" + url.QueryEscape(group)
+	if len(key) > 0 {
+		u += "/" + url.QueryEscape(key[0])
+	}
+	return u
+}
+
+// Get 方法从远程节点获取值，填充到 out 中
+// 对方是 v1 的节点时只有 out.Value
+func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return h.GetContext(context.Background(), in, out)
+}
+
+// GetContext 和 Get 相同，ctx 的剩余时间通过 X-Cache-Timeout 发送给远程节点
+func (h *httpGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.retry(ctx, h.peer, func() error {
+		out.Reset()
+		return h.get(ctx, in, out)
+	})
+}
+
+func (h *httpGetter) get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(protocolHeader, strconv.Itoa(protocolVersion))
+	if ms := timeoutMs(ctx); ms > 0 {
+		req.Header.Set(timeoutHeader, strconv.FormatInt(ms, 10))
+	}
+	res, err := h.client.Do(req)
 	if err != nil {
-		return nil, err
+		return h.unavailable(err)
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return h.unavailable(fmt.Errorf("reading response body: %v", err))
+	}
+
+	if res.Header.Get(protocolHeader) == "" {
+		if res.StatusCode != http.StatusOK {
+			return h.statusError(res)
+		}
+		out.Value = bytes
+		return nil
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	if err = proto.Unmarshal(bytes, out); err != nil {
+		return &PeerError{Peer: h.peer, Code: pb.Code_INTERNAL, Err: fmt.Errorf("decoding response body: %v", err)}
+	}
+	if out.GetCode() != pb.Code_OK {
+		return responseError(h.peer, out)
+	}
+	return nil
+}
+
+// Set 将值写入远程节点
+func (h *httpGetter) Set(group string, key string, value []byte, ttl time.Duration) error {
+	body, err := proto.Marshal(&pb.SetRequest{
+		Group: group,
+		Key:   key,
+		Value: value,
+		TtlMs: ttl.Milliseconds(),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("reading response body: %v", err)
+		return fmt.Errorf("encoding request body: %v", err)
 	}
+	return h.do(http.MethodPut, h.url(group, key), body)
+}
 
-	return bytes, nil
+// Remove 删除远程节点上的值
+func (h *httpGetter) Remove(group string, key string) error {
+	return h.do(http.MethodDelete, h.url(group, key), nil)
+}
+
+// Clear 清空远程节点上的 group
+func (h *httpGetter) Clear(group string) error {
+	return h.do(http.MethodDelete, h.url(group), nil)
+}
+
+// do 发送写请求，写操作都是幂等的，所以同样可以重试
+// 只有 204 或者带有 protocolHeader 的响应说明对方处理了写操作，v1 的节点对任何请求都按照 GET 处理，
+// 它返回的 200 不代表写入成功，返回 ErrWriteUnsupported
+func (h *httpGetter) do(method, u string, body []byte) error {
+	return h.retry(context.Background(), h.peer, func() error {
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set(protocolHeader, strconv.Itoa(protocolVersion))
+		res, err := h.client.Do(req)
+		if err != nil {
+			return h.unavailable(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		if res.Header.Get(protocolHeader) == "" {
+			if res.StatusCode == http.StatusOK {
+				return &PeerError{Peer: h.peer, Code: pb.Code_BAD_REQUEST, Err: ErrWriteUnsupported}
+			}
+			return h.statusError(res)
+		}
+
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return h.unavailable(fmt.Errorf("reading response body: %v", err))
+		}
+		out := &pb.Response{}
+		if err = proto.Unmarshal(data, out); err != nil {
+			return &PeerError{Peer: h.peer, Code: pb.Code_INTERNAL, Err: fmt.Errorf("decoding response body: %v", err)}
+		}
+		if out.GetCode() != pb.Code_OK {
+			return responseError(h.peer, out)
+		}
+		return nil
+	})
+}
+
+func (h *httpGetter) unavailable(err error) error {
+	return &PeerError{Peer: h.peer, Unavailable: true, Err: err}
+}
+
+// statusError 将没有使用 v2 协议的错误响应转换成 PeerError，网关错误说明远程节点不可用
+func (h *httpGetter) statusError(res *http.Response) error {
+	err := fmt.Errorf("server returned: %v", res.Status)
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return h.unavailable(err)
+	}
+	switch res.StatusCode {
+	case http.StatusNotFound: // v1 的节点只在没有这个 group 时返回 404
+		return &PeerError{Peer: h.peer, Code: pb.Code_NO_SUCH_GROUP, Err: err}
+	case http.StatusBadRequest:
+		return &PeerError{Peer: h.peer, Code: pb.Code_BAD_REQUEST, Err: err}
+	}
+	return &PeerError{Peer: h.peer, Code: pb.Code_INTERNAL, Err: err}
 }
 
 var _ PeerGetter = (*httpGetter)(nil)
+var _ PeerGetterCtx = (*httpGetter)(nil)
+var _ PeerWriter = (*httpGetter)(nil)
@@ -0,0 +1,581 @@
+package tinyCache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+)
+
+func TestHTTPPoolWrite(t *testing.T) {
+	g := NewGroup("http-write", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("origin"), nil }))
+	pool := NewHTTPPool("self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+
+	if err := getter.Set(g.name, "a/b", []byte("set"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: g.name, Key: "a/b"}, res); err != nil || string(res.Value) != "set" {
+		t.Fatalf("expect set, got %s %v", res.Value, err)
+	}
+	if res.TtlMs <= 0 || res.TtlMs > time.Minute.Milliseconds() {
+		t.Fatalf("expect ttl within a minute, got %dms", res.TtlMs)
+	}
+	if v, ok := g.mainCache.get("a/b"); !ok || v.Expire().IsZero() {
+		t.Fatalf("value set by peer should be cached with ttl")
+	}
+
+	if err := getter.Remove(g.name, "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("a/b"); ok {
+		t.Fatalf("value removed by peer should not be cached")
+	}
+
+	g.Get("k1")
+	g.Get("k2")
+	if err := getter.Clear(g.name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("k1"); ok {
+		t.Fatalf("group cleared by peer should be empty")
+	}
+
+	if err := getter.Clear("no-such-group"); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
+
+func TestHTTPPoolBadPath(t *testing.T) {
+	pool := NewHTTPPool("self")
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/_cache", http.StatusNotFound},
+		{http.MethodGet, "/other/g/k", http.StatusNotFound},
+		{http.MethodGet, "/_cachex/g/k", http.StatusNotFound},
+		{http.MethodGet, "/_cache/", http.StatusBadRequest},
+		{http.MethodDelete, "/_cache/", http.StatusBadRequest},
+		{http.MethodGet, "/_cache//k", http.StatusBadRequest},
+		{http.MethodGet, "/_cache/g", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: expect %d, got %d", tt.method, tt.path, tt.status, w.Code)
+		}
+	}
+}
+
+func TestHTTPPoolProtocol(t *testing.T) {
+	now := time.Unix(0, 0)
+	NewGroup("protocol", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			if key == "missing" {
+				return nil, 0, fmt.Errorf("%s not exist", key)
+			}
+			return []byte("v"), 3 * time.Second, nil
+		}), WithClock(func() time.Time { return now }))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+
+	// v1 的客户端得到原始的值
+	res, err := http.Get(srv.URL + "/_cache/protocol/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "v" || res.Header.Get(protocolHeader) != "" {
+		t.Fatalf("v1 client expect raw value, got %q", body)
+	}
+
+	out := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "protocol", Key: "key"}, out); err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Value) != "v" || out.TtlMs != 3000 {
+		t.Fatalf("expect v with 3000ms ttl, got %q %dms", out.Value, out.TtlMs)
+	}
+
+	err = getter.Get(&pb.Request{Group: "protocol", Key: "missing"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "missing not exist") {
+		t.Fatalf("expect error from origin, got %v", err)
+	}
+	out = &pb.Response{}
+	getter.Get(&pb.Request{Group: "no-such-group", Key: "key"}, out)
+	if out.Code != pb.Code_NO_SUCH_GROUP {
+		t.Fatalf("expect NO_SUCH_GROUP, got %v", out.Code)
+	}
+
+	// v1 的服务端
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("old"))
+	}))
+	defer v1.Close()
+	out = &pb.Response{}
+	if err := (&httpGetter{baseURL: v1.URL, client: http.DefaultClient}).Get(&pb.Request{Group: "g", Key: "k"}, out); err != nil || string(out.Value) != "old" {
+		t.Fatalf("expect value from v1 server, got %q %v", out.Value, err)
+	}
+}
+
+func TestHTTPGetterWriteProtocol(t *testing.T) {
+	// v1 的服务端把所有请求都当成 GET，对写操作同样返回 200
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("old"))
+	}))
+	defer v1.Close()
+	getter := &httpGetter{peer: v1.URL, baseURL: v1.URL, client: http.DefaultClient}
+	if err := getter.Set("g", "k", []byte("v"), 0); !errors.Is(err, ErrWriteUnsupported) {
+		t.Fatalf("Set on v1 peer: expect ErrWriteUnsupported, got %v", err)
+	}
+	if err := getter.Remove("g", "k"); !errors.Is(err, ErrWriteUnsupported) {
+		t.Fatalf("Remove on v1 peer: expect ErrWriteUnsupported, got %v", err)
+	}
+	if err := getter.Clear("g"); !errors.Is(err, ErrWriteUnsupported) {
+		t.Fatalf("Clear on v1 peer: expect ErrWriteUnsupported, got %v", err)
+	}
+
+	// v2 的服务端成功时返回带有协议头的 204，出错时返回 cachepb.Response
+	NewGroup("write-protocol", 2<<10, GetterFunc(func(key string) ([]byte, error) { return nil, ErrNotFound }))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter = &httpGetter{peer: srv.URL, baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+	if err := getter.Set("write-protocol", "k", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	err := getter.Set("no-such-group", "k", []byte("v"), 0)
+	var perr *PeerError
+	if !errors.As(err, &perr) || perr.Code != pb.Code_NO_SUCH_GROUP {
+		t.Fatalf("expect NO_SUCH_GROUP, got %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/_cache/write-protocol/k", nil)
+	req.Header.Set(protocolHeader, "2")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent || res.Header.Get(protocolHeader) != "2" {
+		t.Fatalf("expect 204 with protocol header, got %d %q", res.StatusCode, res.Header.Get(protocolHeader))
+	}
+}
+
+// fakePeer 记录收到的写操作
+type fakePeer struct {
+	name string
+	ops  *[]string
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Value = []byte(p.name)
+	return nil
+}
+
+func (p *fakePeer) Set(group string, key string, value []byte, ttl time.Duration) error {
+	*p.ops = append(*p.ops, p.name+" set "+key)
+	return nil
+}
+
+func (p *fakePeer) Remove(group string, key string) error {
+	*p.ops = append(*p.ops, p.name+" remove "+key)
+	return nil
+}
+
+func (p *fakePeer) Clear(group string) error {
+	*p.ops = append(*p.ops, p.name+" clear")
+	return nil
+}
+
+// fakePicker 把 remote 开头的 key 分配给第一个节点，其余的 key 在本机
+type fakePicker struct {
+	peers []PeerGetter
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.peers[0], true
+	}
+	return nil, false
+}
+
+func (p *fakePicker) ListPeers() []PeerGetter {
+	return p.peers
+}
+
+func TestGroupWrite(t *testing.T) {
+	var ops []string
+	picker := &fakePicker{peers: []PeerGetter{&fakePeer{"p1", &ops}, &fakePeer{"p2", &ops}}}
+	g := NewGroup("write", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("origin"), nil }), WithBroadcast())
+	g.RegisterPeers(picker)
+
+	g.Set("local", []byte("v"), 0)
+	if v, err := g.Get("local"); err != nil || v.String() != "v" {
+		t.Fatalf("expect v, got %s %v", v, err)
+	}
+	g.Set("remote", []byte("v"), 0)
+	if _, ok := g.mainCache.get("remote"); ok {
+		t.Fatalf("value owned by peer should not be cached locally")
+	}
+	g.Remove("local")
+	if v, _ := g.Get("local"); v.String() != "origin" {
+		t.Fatalf("removed key should be loaded again, got %s", v)
+	}
+	g.Remove("remote")
+	g.Clear()
+
+	expect := []string{
+		"p1 remove local", "p2 remove local",
+		"p1 set remote", "p2 remove remote",
+		"p1 remove local", "p2 remove local",
+		"p1 remove remote", "p2 remove remote",
+		"p1 clear", "p2 clear",
+	}
+	if !reflect.DeepEqual(expect, ops) {
+		t.Fatalf("expect %q, got %q", expect, ops)
+	}
+}
+
+func TestHTTPGetterRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1, 2:
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{RetryBackoff: time.Millisecond})
+	pool.Set(srv.URL)
+	getter := pool.peers.getters[srv.URL]
+
+	out := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "g", Key: "k"}, out); err != nil || string(out.Value) != "ok" {
+		t.Fatalf("expect ok after retries, got %q %v", out.Value, err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expect 3 calls, got %d", calls)
+	}
+
+	// 重试的次数有上限
+	atomic.StoreInt32(&calls, 0)
+	pool = NewHTTPPoolOpts("self", &HTTPPoolOptions{RetryBackoff: time.Millisecond, MaxRetries: 1})
+	pool.Set(srv.URL)
+	err := pool.peers.getters[srv.URL].Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+	var perr *PeerError
+	if !errors.As(err, &perr) || !perr.Unavailable || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expect unavailable error after 2 calls, got %v after %d calls", err, calls)
+	}
+}
+
+func TestHTTPGetterOriginError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeError(w, protocolVersion, pb.Code_INTERNAL, "k not exist")
+	}))
+	defer srv.Close()
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{RetryBackoff: time.Millisecond, BreakerThreshold: 1})
+	pool.Set(srv.URL)
+
+	// 远程节点正常返回的错误既不重试，也不会让熔断器打开
+	for i := 0; i < 3; i++ {
+		err := pool.peers.getters[srv.URL].Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+		var perr *PeerError
+		if !errors.As(err, &perr) || perr.Unavailable || perr.Code != pb.Code_INTERNAL || perr.Peer != srv.URL {
+			t.Fatalf("expect INTERNAL from peer, got %#v", err)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expect no retries, got %d calls", calls)
+	}
+	if _, ok := pool.PickPeer("k"); !ok {
+		t.Fatalf("peer returning origin errors should still be picked")
+	}
+}
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{RequestTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	pool.Set(srv.URL)
+
+	start := time.Now()
+	err := pool.peers.getters[srv.URL].Get(&pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+	var perr *PeerError
+	if !errors.As(err, &perr) || !perr.Unavailable {
+		t.Fatalf("expect unavailable error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request should time out after 50ms, took %v", elapsed)
+	}
+}
+
+func TestHTTPPoolCircuitBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.URL
+	srv.Close() // 连接被拒绝
+
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{MaxRetries: -1, BreakerThreshold: 2, BreakerTimeout: time.Hour})
+	pool.Set("self", addr)
+	key := ""
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		peer, ok := pool.PickPeer(key)
+		if !ok {
+			t.Fatalf("peer should be picked before the breaker opens")
+		}
+		if err := peer.Get(&pb.Request{Group: "g", Key: key}, &pb.Response{}); err == nil {
+			t.Fatalf("expect error from a closed server")
+		}
+	}
+	if _, ok := pool.PickPeer(key); ok {
+		t.Fatalf("peer with an open breaker should not be picked")
+	}
+	err := pool.peers.getters[addr].(PeerWriter).Remove("g", key)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+}
+
+// failPeer 总是返回不可用的错误
+type failPeer struct{}
+
+func (failPeer) Get(in *pb.Request, out *pb.Response) error {
+	return &PeerError{Peer: "fail", Unavailable: true, Err: errors.New("connection refused")}
+}
+
+// fakeReplicaPicker 对所有的 key 返回同样的副本节点，nil 表示本机
+type fakeReplicaPicker struct {
+	replicas []PeerGetter
+}
+
+func (p *fakeReplicaPicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.replicas[0], p.replicas[0] != nil
+}
+
+func (p *fakeReplicaPicker) PickReplicas(key string, n int) []PeerGetter {
+	if n > len(p.replicas) {
+		n = len(p.replicas)
+	}
+	return p.replicas[:n]
+}
+
+func (p *fakeReplicaPicker) ListPeers() []PeerGetter {
+	var peers []PeerGetter
+	for _, peer := range p.replicas {
+		if peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func TestReplicas(t *testing.T) {
+	var ops []string
+	p1, p2 := &fakePeer{"p1", &ops}, &fakePeer{"p2", &ops}
+	origin := GetterFunc(func(key string) ([]byte, error) { return []byte("origin"), nil })
+
+	testCases := []struct {
+		name     string
+		replicas []PeerGetter
+		value    string
+		cached   bool // 值是否放入本机的 mainCache
+	}{
+		{"primary", []PeerGetter{p1, p2}, "p1", false},
+		{"failover", []PeerGetter{failPeer{}, p2}, "p2", false},
+		{"all-fail", []PeerGetter{failPeer{}, failPeer{}}, "origin", true},
+		{"self-replica", []PeerGetter{failPeer{}, nil, p2}, "origin", true},
+		{"from-primary", []PeerGetter{p1, nil}, "p1", true},
+	}
+	for _, tc := range testCases {
+		g := NewGroup("replicas-"+tc.name, 2<<10, origin, WithReplicas(3), WithHotCache(0, 0))
+		g.RegisterPeers(&fakeReplicaPicker{replicas: tc.replicas})
+		if v, err := g.Get("k"); err != nil || v.String() != tc.value {
+			t.Fatalf("%s: expect %s, got %s %v", tc.name, tc.value, v, err)
+		}
+		if _, ok := g.mainCache.get("k"); ok != tc.cached {
+			t.Fatalf("%s: expect cached %v, got %v", tc.name, tc.cached, ok)
+		}
+	}
+
+	// 没有 WithReplicas 时只访问主节点
+	g := NewGroup("replicas-off", 2<<10, origin)
+	g.RegisterPeers(&fakeReplicaPicker{replicas: []PeerGetter{failPeer{}, p2}})
+	if v, _ := g.Get("k"); v.String() != "origin" {
+		t.Fatalf("expect origin without replicas, got %s", v)
+	}
+}
+
+func TestReplicatedWrites(t *testing.T) {
+	var ops []string
+	p1, p2, p3 := &fakePeer{"p1", &ops}, &fakePeer{"p2", &ops}, &fakePeer{"p3", &ops}
+	origin := GetterFunc(func(key string) ([]byte, error) { return []byte("origin"), nil })
+
+	g := NewGroup("replicated-writes", 2<<10, origin, WithReplicas(3), WithReplicatedWrites(), WithBroadcast())
+	g.RegisterPeers(&fakeReplicaPicker{replicas: []PeerGetter{p1, nil, p2, p3}})
+	g.Set("k", []byte("v"), 0)
+	if v, ok := g.mainCache.get("k"); !ok || v.String() != "v" {
+		t.Fatalf("replica should keep the written value, got %s", v)
+	}
+	g.Remove("k")
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatalf("replica should drop the removed value")
+	}
+
+	// 只写主节点，其余节点通过广播删除
+	g = NewGroup("primary-writes", 2<<10, origin, WithReplicas(3), WithBroadcast())
+	g.RegisterPeers(&fakeReplicaPicker{replicas: []PeerGetter{p1, nil, p2, p3}})
+	g.Set("k", []byte("v"), 0)
+
+	expect := []string{
+		"p1 set k", "p2 set k", "p3 remove k",
+		"p1 remove k", "p2 remove k", "p3 remove k",
+		"p1 set k", "p2 remove k", "p3 remove k",
+	}
+	if !reflect.DeepEqual(expect, ops) {
+		t.Fatalf("expect %q, got %q", expect, ops)
+	}
+}
+
+func TestHTTPPoolNotFound(t *testing.T) {
+	now := time.Unix(0, 0)
+	NewGroup("not-found", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+	}), WithNegativeTTL(5*time.Second), WithClock(func() time.Time { return now }))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	getter := &httpGetter{peer: srv.URL, baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}
+
+	for i := 0; i < 2; i++ { // 第二次来自远程节点的负缓存
+		out := &pb.Response{}
+		err := getter.Get(&pb.Request{Group: "not-found", Key: "kkk"}, out)
+		var perr *PeerError
+		if !errors.As(err, &perr) || perr.Code != pb.Code_NOT_FOUND || out.TtlMs != 5000 {
+			t.Fatalf("expect NOT_FOUND with 5000ms ttl, got %v %dms", err, out.TtlMs)
+		}
+		if !strings.Contains(out.Error, "kkk not exist") {
+			t.Fatalf("expect the getter's message, got %q", out.Error)
+		}
+	}
+
+	// v1 的客户端得到 404
+	res, err := http.Get(srv.URL + "/_cache/not-found/kkk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect 404, got %v", res.Status)
+	}
+}
+
+// notFoundPeer 对所有的 key 返回 NOT_FOUND
+type notFoundPeer struct {
+	ttlMs int64
+}
+
+func (p notFoundPeer) Get(in *pb.Request, out *pb.Response) error {
+	out.Code, out.Error, out.TtlMs = pb.Code_NOT_FOUND, in.Key+" not exist", p.ttlMs
+	return &PeerError{Peer: "p", Code: pb.Code_NOT_FOUND, Err: errors.New(out.Error)}
+}
+
+func TestGroupPeerNotFound(t *testing.T) {
+	now := time.Unix(0, 0)
+	loads := 0
+	origin := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("origin"), nil
+	})
+
+	// 远程节点返回的不存在是确定的结果，不回退到本地加载；hotCache 的采样率是 1，结果一定被缓存
+	g := NewGroup("peer-not-found", 2<<10, origin, WithNegativeTTL(time.Minute), WithHotCache(1<<10, 1),
+		WithClock(func() time.Time { return now }))
+	g.RegisterPeers(&fakePicker{peers: []PeerGetter{notFoundPeer{ttlMs: 1000}}})
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get("remote"); !errors.Is(err, ErrNotFound) || err.Error() != "remote not exist" {
+			t.Fatalf("expect ErrNotFound from peer, got %v", err)
+		}
+	}
+	if loads != 0 || g.Stats.PeerLoads.Get() != 1 || g.Stats.NegativeHits.Get() != 1 {
+		t.Fatalf("expect 1 peer load cached for the peer's ttl, got %d peer loads, %d local loads",
+			g.Stats.PeerLoads.Get(), loads)
+	}
+	now = now.Add(time.Second)
+	g.Get("remote")
+	if g.Stats.PeerLoads.Get() != 2 {
+		t.Fatalf("negative result should expire after the peer's ttl")
+	}
+
+	// 远程节点不允许缓存时每一次都询问远程节点
+	g = NewGroup("peer-not-found-uncached", 2<<10, origin, WithNegativeTTL(time.Minute), WithHotCache(1<<10, 1))
+	g.RegisterPeers(&fakePicker{peers: []PeerGetter{notFoundPeer{}}})
+	g.Get("remote")
+	g.Get("remote")
+	if loads != 0 || g.Stats.PeerLoads.Get() != 2 {
+		t.Fatalf("expect 2 peer loads, got %d", g.Stats.PeerLoads.Get())
+	}
+}
+
+// TestHTTPGetterCancel 调用者取消的请求不重试，也不计入熔断器
+func TestHTTPGetterCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{BreakerThreshold: 2, BreakerTimeout: time.Hour})
+	pool.Set(srv.URL)
+	getter := pool.peers.getters[srv.URL].(*httpGetter)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		err := getter.GetContext(ctx, &pb.Request{Group: "g", Key: "k"}, &pb.Response{})
+		cancel()
+		var perr *PeerError
+		if !errors.Is(err, context.DeadlineExceeded) || errors.As(err, &perr) {
+			t.Fatalf("expect context.DeadlineExceeded rather than a PeerError, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("canceled request should not be retried, took %v", elapsed)
+		}
+	}
+	if !getter.available() {
+		t.Fatalf("canceled requests should not open the circuit breaker")
+	}
+}
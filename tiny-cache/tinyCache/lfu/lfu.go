@@ -0,0 +1,157 @@
+package lfu
+
+import (
+	"container/heap"
+	"tiny-cache/tinyCache/policy"
+)
+
+// Cache is a LFU cache, 访问次数最少的值最先被淘汰，次数相同时淘汰最久没有访问的
+// It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64
+	nowBytes int64
+	tick     uint64 // 每一次访问加一，用来比较访问的先后
+	queue    entryHeap
+	cache    map[string]*entry
+	// 在清除 item 的时候可以执行
+	OnEvicted func(key string, value policy.Value)
+}
+
+type entry struct {
+	key   string
+	value policy.Value
+	freq  uint64 // 访问次数
+	tick  uint64 // 最后一次访问的时间
+	index int    // 在 heap 中的位置
+}
+
+var _ policy.Policy = (*Cache)(nil)
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, policy.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Add adds a value to the cache, 更新已有的值也算作一次访问
+// 新的值在淘汰之后再加入，否则访问次数为 1 的新值总是会被立即淘汰
+func (c *Cache) Add(key string, value policy.Value) {
+	c.tick++
+	if e, ok := c.cache[key]; ok {
+		c.nowBytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		c.touch(e)
+	} else {
+		size := policy.Size(key, value)
+		for c.maxBytes != 0 && len(c.queue) > 0 && c.maxBytes < c.nowBytes+size {
+			c.RemoveLeastFrequent()
+		}
+		e := &entry{key: key, value: value, freq: 1, tick: c.tick}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nowBytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nowBytes {
+		c.RemoveLeastFrequent()
+	}
+}
+
+// Get look ups a key's value and increases its frequency
+func (c *Cache) Get(key string) (value policy.Value, ok bool) {
+	c.tick++
+	if e, ok := c.cache[key]; ok {
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+func (c *Cache) touch(e *entry) {
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.queue, e.index)
+}
+
+// RemoveLeastFrequent removes the least frequently used item
+func (c *Cache) RemoveLeastFrequent() {
+	if len(c.queue) > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	for len(c.queue) > 0 {
+		c.RemoveLeastFrequent()
+	}
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nowBytes -= policy.Size(e.key, e.value)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Range calls fn for each entry in no particular order.
+func (c *Cache) Range(fn func(key string, value policy.Value) bool) {
+	for _, e := range c.queue {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Bytes the number of bytes used by cache entries
+func (c *Cache) Bytes() int64 {
+	return c.nowBytes
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.queue)
+}
+
+// entryHeap 是按照 (freq, tick) 排序的最小堆
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
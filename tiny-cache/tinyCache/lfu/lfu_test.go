@@ -0,0 +1,64 @@
+package lfu
+
+import (
+	"reflect"
+	"testing"
+	"tiny-cache/tinyCache/policy"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	var keys []string
+	lfu := New(int64(8), func(key string, value policy.Value) {
+		keys = append(keys, key)
+	})
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k2")
+	lfu.Add("k3", String("v3")) // k2 的访问次数比 k1 少
+	lfu.Add("k4", String("v4")) // k3 和 k4 的次数相同，淘汰更早访问的 k3
+
+	if expect := []string{"k2", "k3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %s, got %s", expect, keys)
+	}
+	if _, ok := lfu.Get("k1"); !ok || lfu.Len() != 2 {
+		t.Fatalf("frequently used k1 should stay in cache")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1"))
+	lfu.Add("key2", String("22"))
+	lfu.Add("key1", String("111"))
+	if lfu.nowBytes != int64(len("key1key2")+5) {
+		t.Fatalf("expect %d bytes, got %d", len("key1key2")+5, lfu.nowBytes)
+	}
+
+	lfu.Remove("key1")
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	lfu.Clear()
+	if lfu.Len() != 0 || lfu.nowBytes != 0 {
+		t.Fatalf("Clear failed")
+	}
+}
@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"tiny-cache/tinyCache/policy"
+)
 
 // Cache is a LRU cache. It is not safe for concurrent access.
 type Cache struct {
@@ -12,15 +15,16 @@ type Cache struct {
 	OnEvicted func(key string, value Value)
 }
 
+// 过期时间保存在 value（tinyCache 的 ByteView）中，由 tinyCache 的 cache 在读取时判断，所有的淘汰策略共用同一套逻辑
 type entry struct {
 	key   string
 	value Value
 }
 
 // Value use Len to count how many bytes it takes
-type Value interface {
-	Len() int
-}
+type Value = policy.Value
+
+var _ policy.Policy = (*Cache)(nil)
 
 // New is the Constructor of Cache
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
@@ -63,16 +67,49 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
+		c.removeElement(ele)
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	for c.ll.Len() > 0 {
+		c.RemoveOldest()
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nowBytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Range calls fn for each entry from the most to the least recently used.
+func (c *Cache) Range(fn func(key string, value Value) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
 		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nowBytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		if !fn(kv.key, kv.value) {
+			return
 		}
 	}
 }
 
+// Bytes the number of bytes used by cache entries
+func (c *Cache) Bytes() int64 {
+	return c.nowBytes
+}
+
 // Len the number of cache entries
 func (c *Cache) Len() int {
 	return c.ll.Len()
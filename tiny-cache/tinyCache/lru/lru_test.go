@@ -63,3 +63,48 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nowBytes)
 	}
 }
+
+func TestRange(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.Add("key3", String("3"))
+	lru.Get("key1")
+
+	keys := make([]string, 0)
+	lru.Range(func(key string, value Value) bool {
+		keys = append(keys, key)
+		return key != "key3"
+	})
+	if expect := []string{"key1", "key3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect range keys %s, got %s", expect, keys)
+	}
+
+	lru.Remove("key3")
+	lru.Remove("missing")
+	if _, ok := lru.Get("key3"); ok || lru.Len() != 2 || lru.nowBytes != int64(len("key1")+len("key2")+2) {
+		t.Fatalf("Remove key3 failed, %d entries and %d bytes left", lru.Len(), lru.nowBytes)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value) {
+		keys = append(keys, key)
+	})
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.Add("key3", String("3"))
+
+	lru.Remove("key2")
+	if _, ok := lru.Get("key2"); ok || lru.Len() != 2 {
+		t.Fatalf("Remove key2 failed")
+	}
+	lru.Clear()
+	if lru.Len() != 0 || lru.nowBytes != 0 {
+		t.Fatalf("Clear failed, %d entries and %d bytes left", lru.Len(), lru.nowBytes)
+	}
+	if expect := []string{"key2", "key1", "key3"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("expect evicted keys %s, got %s", expect, keys)
+	}
+}
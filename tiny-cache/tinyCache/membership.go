@@ -0,0 +1,202 @@
+package tinyCache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"tiny-cache/tinyCache/gossip"
+)
+
+/*
+
+节点列表的来源，Watch 在节点列表变化时调用 update，HTTPPool.Set 和 RPCPool.Set 可以直接作为 update
+
+	StaticMembership     固定的节点列表
+	FileMembership       定期读取文件，每一行一个节点，# 之后是注释
+	RegistryMembership   定期从 koorpc 的注册中心获取存活的节点（响应头 X-koorpc-Servers）
+	WatchGossip          使用 gossip 包的 SWIM 协议发现节点和检测故障，疑似故障的节点不会被选中
+
+	peers := tinyCache.NewHTTPPool("http://localhost:8001")
+	m := &tinyCache.FileMembership{Path: "peers.txt"}
+	go m.Watch(ctx, peers.Set)
+
+Set 只添加新的节点、删除不再存在的节点，所以节点列表变化时只有大约 1/N 的 key 会移动
+
+*/
+
+const (
+	defaultMembershipInterval = 10 * time.Second
+	defaultRegistryPath       = "/_koorpc_/registry"
+	registryServersHeader     = "X-koorpc-Servers"
+)
+
+// Membership 是节点列表的来源
+type Membership interface {
+	// Watch 先调用一次 update，之后在节点列表变化时再次调用，直到 ctx 被取消
+	Watch(ctx context.Context, update func(peers ...string)) error
+}
+
+// PeerUpdater 是节点列表的使用者，HTTPPool 和 RPCPool 实现了这个接口
+type PeerUpdater interface {
+	Set(peers ...string)
+	SetSuspect(peers ...string)
+}
+
+// WatchGossip 把 gossip 节点看到的成员同步到 pool，直到 ctx 被取消或者 node 被关闭
+// alive 和 suspect 的成员在哈希环上，suspect 的成员不会被 PickPeer 选中，dead 的成员从哈希环上删除
+func WatchGossip(ctx context.Context, node *gossip.Node, pool PeerUpdater) error {
+	return node.Watch(ctx, func(members []gossip.Member) {
+		var peers, suspect []string
+		for _, m := range members {
+			switch m.State {
+			case gossip.StateAlive:
+				peers = append(peers, m.Name)
+			case gossip.StateSuspect:
+				peers = append(peers, m.Name)
+				suspect = append(suspect, m.Name)
+			}
+		}
+		pool.SetSuspect(suspect...)
+		pool.Set(peers...)
+	})
+}
+
+// StaticMembership 是固定的节点列表
+type StaticMembership []string
+
+// Watch implements Membership interface function
+func (m StaticMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	update(m...)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// FileMembership 定期读取 Path 指向的文件，每一行一个节点，空行和 # 之后的内容会被忽略
+type FileMembership struct {
+	Path     string
+	Interval time.Duration // 读取文件的间隔，默认 10s
+}
+
+// Watch implements Membership interface function
+func (m *FileMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	return pollMembership(ctx, m.Interval, m.read, update)
+}
+
+func (m *FileMembership) read() ([]string, error) {
+	data, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			peers = append(peers, line)
+		}
+	}
+	return peers, scanner.Err()
+}
+
+// RegistryMembership 定期从 koorpc 的注册中心获取存活的节点
+// 节点需要使用 registry.Heartbeat 把自己的地址（例如 "http://localhost:8001"）注册到注册中心
+type RegistryMembership struct {
+	Registry string        // 注册中心的地址，例如 "http://localhost:9999/_koorpc_/registry"，没有路径时使用默认的路径
+	Interval time.Duration // 请求注册中心的间隔，默认 10s
+	Client   *http.Client  // 默认是 http.DefaultClient
+}
+
+// Watch implements Membership interface function
+func (m *RegistryMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	return pollMembership(ctx, m.Interval, func() ([]string, error) {
+		return m.fetch(ctx)
+	}, update)
+}
+
+func (m *RegistryMembership) fetch(ctx context.Context) ([]string, error) {
+	u, err := url.Parse(m.Registry)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = defaultRegistryPath
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned: %v", res.Status)
+	}
+	var peers []string
+	for _, peer := range strings.Split(res.Header.Get(registryServersHeader), ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, nil
+}
+
+// pollMembership 每隔 interval 调用一次 fetch，节点列表变化时调用 update
+// fetch 失败时保留当前的节点列表，等待下一次
+func pollMembership(ctx context.Context, interval time.Duration, fetch func() ([]string, error), update func(peers ...string)) error {
+	if interval <= 0 {
+		interval = defaultMembershipInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current []string
+	first := true
+	for {
+		if peers, err := fetch(); err != nil {
+			if ctx.Err() == nil {
+				log.Println("[Cache] Failed to fetch peers:", err)
+			}
+		} else {
+			sort.Strings(peers)
+			if first || !equalPeers(peers, current) {
+				current, first = peers, false
+				update(peers...)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func equalPeers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
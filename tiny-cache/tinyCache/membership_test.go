@@ -0,0 +1,271 @@
+package tinyCache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"tiny-cache/tinyCache/gossip"
+	"tiny-cache/tinyCache/placement"
+)
+
+func TestPoolAddRemovePeer(t *testing.T) {
+	pool := NewHTTPPool("http://a")
+	pool.Set("http://a", "http://b", "http://c")
+
+	owners := make(map[string]PeerGetter)
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		owners[key], _ = pool.PickPeer(key)
+	}
+	c := pool.peers.getters["http://c"]
+
+	pool.RemovePeer("http://b")
+	if peers := pool.Peers(); !reflect.DeepEqual(peers, []string{"http://a", "http://c"}) {
+		t.Fatalf("unexpected peers %v", peers)
+	}
+	for key, before := range owners {
+		after, _ := pool.PickPeer(key)
+		if before == c && after != c {
+			t.Fatalf("%s should stay on http://c", key)
+		}
+		if after != nil && after != c {
+			t.Fatalf("%s picked a removed peer", key)
+		}
+	}
+
+	// Set 只修改变化的节点，已经存在的节点继续使用原来的客户端
+	pool.Set("http://a", "http://c", "http://d")
+	if pool.peers.getters["http://c"] != c {
+		t.Fatalf("Set should keep the getter of an existing peer")
+	}
+	pool.AddPeer("http://d", "http://e")
+	if peers := pool.Peers(); !reflect.DeepEqual(peers, []string{"http://a", "http://c", "http://d", "http://e"}) {
+		t.Fatalf("unexpected peers %v", peers)
+	}
+}
+
+func TestPoolSuspect(t *testing.T) {
+	pool := NewHTTPPool("http://a")
+	pool.Set("http://a", "http://b")
+	key := ""
+	for i := 0; key == ""; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+
+	pool.SetSuspect("http://b")
+	if _, ok := pool.PickPeer(key); ok {
+		t.Fatalf("suspected peer should not be picked")
+	}
+	if peers := pool.Peers(); len(peers) != 2 {
+		t.Fatalf("suspected peer should stay on the ring, got %v", peers)
+	}
+	pool.SetSuspect()
+	if _, ok := pool.PickPeer(key); !ok {
+		t.Fatalf("peer should be picked again")
+	}
+}
+
+func TestPoolPickReplicas(t *testing.T) {
+	pool := NewHTTPPool("http://a")
+	pool.Set("http://a", "http://b", "http://c")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		replicas := pool.PickReplicas(key, 3)
+		if len(replicas) != 3 {
+			t.Fatalf("expect 3 replicas, got %d", len(replicas))
+		}
+		self := 0
+		for _, r := range replicas {
+			if r == nil {
+				self++
+			}
+		}
+		if self != 1 {
+			t.Fatalf("self should appear once in %v", replicas)
+		}
+		if peer, ok := pool.PickPeer(key); ok && replicas[0] != peer || !ok && replicas[0] != nil {
+			t.Fatalf("first replica of %s should be the primary", key)
+		}
+	}
+
+	pool.SetSuspect("http://b")
+	if replicas := pool.PickReplicas("key", 3); len(replicas) != 2 {
+		t.Fatalf("suspected peer should be skipped, got %d replicas", len(replicas))
+	}
+}
+
+func TestPoolPlacement(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://a", &HTTPPoolOptions{Placement: placement.NewRendezvous(nil)})
+	pool.Set("http://a", "http://b", "http://c")
+	ref := placement.NewRendezvous(nil)
+	ref.Add("http://a", "http://b", "http://c")
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		for j, peer := range ref.GetN(key, 3) {
+			want := pool.peers.getters[peer]
+			if peer == "http://a" {
+				want = nil
+			}
+			if got := pool.PickReplicas(key, 3)[j]; got != want {
+				t.Fatalf("replica %d of %s should be %s", j, key, peer)
+			}
+		}
+	}
+}
+
+func TestWatchGossip(t *testing.T) {
+	newNode := func(name string) *gossip.Node {
+		n, err := gossip.New(gossip.Config{
+			Name:           name,
+			BindAddr:       "localhost:0",
+			ProbeInterval:  30 * time.Millisecond,
+			ProbeTimeout:   10 * time.Millisecond,
+			SuspectTimeout: 300 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	a, b := newNode("http://a"), newNode("http://b")
+	defer a.Close()
+	defer b.Close()
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewHTTPPool("http://a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchGossip(ctx, a, pool)
+
+	picked := func() bool {
+		for i := 0; i < 100; i++ {
+			if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor(t, func() bool { return len(pool.Peers()) == 2 && picked() }, "http://b should join the ring")
+
+	// http://b 停止响应之后先被怀疑，不再被选中，SuspectTimeout 之后从哈希环上删除
+	b.Close()
+	waitFor(t, func() bool { return !picked() }, "suspected http://b should not be picked")
+	waitFor(t, func() bool { return len(pool.Peers()) == 1 }, "dead http://b should leave the ring")
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRPCPoolRemovePeerCloses(t *testing.T) {
+	addr, stop := startRPC(t)
+	defer stop()
+	pool := NewRPCPool("self")
+	pool.Set("self", addr)
+	getter := pool.peers.getters[addr].(*rpcGetter)
+	if _, err := getter.getConn(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn := getter.conn
+
+	pool.RemovePeer(addr)
+	if !conn.closed() {
+		t.Fatalf("RemovePeer should close the connection")
+	}
+	if _, ok := pool.PickPeer("any"); ok {
+		t.Fatalf("no remote peer is left")
+	}
+}
+
+// watch 在后台运行 m.Watch，返回接收每一次更新的 channel
+func watch(m Membership) (<-chan []string, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []string, 8)
+	go m.Watch(ctx, func(peers ...string) { updates <- peers })
+	return updates, cancel
+}
+
+func expectPeers(t *testing.T, updates <-chan []string, want ...string) {
+	t.Helper()
+	select {
+	case peers := <-updates:
+		if !reflect.DeepEqual(peers, want) {
+			t.Fatalf("expect %v, got %v", want, peers)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect %v, got no update", want)
+	}
+}
+
+func TestStaticMembership(t *testing.T) {
+	updates, cancel := watch(StaticMembership{"http://a", "http://b"})
+	defer cancel()
+	expectPeers(t, updates, "http://a", "http://b")
+}
+
+func TestFileMembership(t *testing.T) {
+	dir, err := ioutil.TempDir("", "membership")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "peers.txt")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# cache nodes\nhttp://b\n\nhttp://a  # self\n")
+
+	updates, cancel := watch(&FileMembership{Path: path, Interval: 5 * time.Millisecond})
+	defer cancel()
+	expectPeers(t, updates, "http://a", "http://b")
+
+	write("http://a\nhttp://c\n")
+	expectPeers(t, updates, "http://a", "http://c")
+
+	// 文件暂时不可读时保留当前的节点列表
+	os.Remove(path)
+	time.Sleep(20 * time.Millisecond)
+	write("http://c\nhttp://a\n")
+	select {
+	case peers := <-updates:
+		t.Fatalf("unchanged peers should not trigger an update, got %v", peers)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestRegistryMembership(t *testing.T) {
+	// 没有路径时请求 koorpc 注册中心默认的路径
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultRegistryPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-koorpc-Servers", "http://b, http://a")
+	}))
+	defer srv.Close()
+
+	updates, cancel := watch(&RegistryMembership{Registry: srv.URL, Interval: 5 * time.Millisecond})
+	defer cancel()
+	expectPeers(t, updates, "http://a", "http://b")
+}
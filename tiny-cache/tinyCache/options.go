@@ -0,0 +1,139 @@
+package tinyCache
+
+import (
+	"time"
+	"tiny-cache/tinyCache/arc"
+	"tiny-cache/tinyCache/lfu"
+	"tiny-cache/tinyCache/lru"
+	"tiny-cache/tinyCache/policy"
+	"tiny-cache/tinyCache/tinylfu"
+	"tiny-cache/tinyCache/twoq"
+)
+
+// GroupOption 用来配置 NewGroup 创建的 Group
+type GroupOption func(*Group)
+
+// WithTTL 设置 group 默认的过期时间，Getter 没有返回过期时间的值使用这个时间，0 表示永不过期
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithTTLJitter 为每一个过期时间加上 [0, jitter) 的随机时间，避免大量 key 在同一时刻过期造成缓存雪崩
+func WithTTLJitter(jitter time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttlJitter = jitter
+	}
+}
+
+// WithJanitor 启动一个后台 goroutine，每隔 interval 删除一次过期的缓存值，Group.Close 停止它
+// 没有 janitor 时过期的值只在访问的时候删除
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithClock 替换 group 使用的时钟，用于测试
+func WithClock(now func() time.Time) GroupOption {
+	return func(g *Group) {
+		g.now = now
+	}
+}
+
+// WithBroadcast 让 Set 和 Remove 在修改 key 所在的节点之后，通知其余所有节点删除它们持有的副本
+func WithBroadcast() GroupOption {
+	return func(g *Group) {
+		g.broadcast = true
+	}
+}
+
+// WithNegativeTTL 缓存 Getter 返回 ErrNotFound 的结果 ttl 的时间，防止缓存穿透
+// ttl 通常比 WithTTL 短，这样数据源中新增的 key 很快可以被读到。远程节点返回的不存在的结果同样会被缓存
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// WithBloomFilter 在 Getter 前面放置一个布隆过滤器，一定不在数据源中的 key 直接返回 ErrNotFound，不会调用 Getter，
+// 也不会访问远程节点，防止大量随机的 key 穿透缓存。过滤器在后台构建，构建完成之前所有的 key 都放行
+//
+//	tinyCache.NewGroup("scores", 2<<10, getter, tinyCache.WithBloomFilter(tinyCache.BloomOptions{
+//		Keys:            tinyCache.KeyEnumeratorFunc(db.ScanKeys),
+//		RebuildInterval: 10 * time.Minute,
+//	}))
+func WithBloomFilter(opts BloomOptions) GroupOption {
+	return func(g *Group) {
+		g.bloom = newBloomGuard(opts)
+	}
+}
+
+// WithReplicas 让每一个 key 保存在一致性哈希环上顺时针的 n 个节点上
+// 读取时主节点失败（或者疑似故障、熔断）之后依次尝试副本节点，副本节点从主节点获取的值放入自己的 mainCache，
+// 所以主节点重启时它负责的 key 不会一起变冷。需要 PeerPicker 实现 ReplicaPicker 接口
+func WithReplicas(n int) GroupOption {
+	return func(g *Group) {
+		if n > 1 {
+			g.replicas = n
+		}
+	}
+}
+
+// WithReplicatedWrites 让 Set 和 Remove 修改所有 WithReplicas 个副本节点，而不只是主节点
+// 没有这个选项时副本节点上的旧值只能通过 WithBroadcast 或者过期时间失效
+func WithReplicatedWrites() GroupOption {
+	return func(g *Group) {
+		g.replicatedWrites = true
+	}
+}
+
+// defaultHotSampleRate 是从远程节点获取的值放入 hotCache 的默认比例
+const defaultHotSampleRate = 0.1
+
+// WithHotCache 设置 hotCache 的容量和采样比例，默认容量是 mainCache 的 1/8，比例是 1/10
+// maxBytes 为 0 时不使用 hotCache
+func WithHotCache(maxBytes int64, sampleRate float64) GroupOption {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = maxBytes
+		g.hotSampleRate = sampleRate
+	}
+}
+
+// PolicyFactory 创建 group 缓存使用的淘汰策略
+type PolicyFactory func(maxBytes int64, onEvicted func(key string, value policy.Value)) policy.Policy
+
+// WithPolicy 设置 group 的淘汰策略，默认是 LRU
+//
+//	tinyCache.NewGroup("scores", 2<<10, getter, tinyCache.WithPolicy(tinyCache.TinyLFU))
+func WithPolicy(factory PolicyFactory) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newPolicy = factory
+	}
+}
+
+// LRU 淘汰最久没有访问的值
+func LRU(maxBytes int64, onEvicted func(string, policy.Value)) policy.Policy {
+	return lru.New(maxBytes, onEvicted)
+}
+
+// LFU 淘汰访问次数最少的值
+func LFU(maxBytes int64, onEvicted func(string, policy.Value)) policy.Policy {
+	return lfu.New(maxBytes, onEvicted)
+}
+
+// TwoQueue 是 2Q 策略，只访问一次的值不会进入主队列
+func TwoQueue(maxBytes int64, onEvicted func(string, policy.Value)) policy.Policy {
+	return twoq.New(maxBytes, onEvicted)
+}
+
+// ARC 在最近访问和频繁访问之间自适应
+func ARC(maxBytes int64, onEvicted func(string, policy.Value)) policy.Policy {
+	return arc.New(maxBytes, onEvicted)
+}
+
+// TinyLFU 是 W-TinyLFU 策略，使用 count-min sketch 决定是否接纳新的值
+func TinyLFU(maxBytes int64, onEvicted func(string, policy.Value)) policy.Policy {
+	return tinylfu.New(maxBytes, onEvicted)
+}
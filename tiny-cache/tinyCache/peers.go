@@ -1,11 +1,206 @@
 package tinyCache
 
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+	"tiny-cache/tinyCache/consistenthash"
+	"tiny-cache/tinyCache/placement"
+)
+
 // PeerPicker 接口拥有 PickPeer 方法， 用于根据传入的 key 选择相应节点 PeerPicker
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+// ReplicaPicker 接口按照顺序返回 key 所在的 n 个节点，本机用 nil 表示，第一个节点和 PickPeer 选择的节点相同
+// PeerPicker 同时实现了这个接口并且开启了 WithReplicas 时，Group 在主节点失败时依次尝试副本节点
+type ReplicaPicker interface {
+	PickReplicas(key string, n int) []PeerGetter
+}
+
 // PeerGetter 接口的 Get 方法用于从对应的 group 中查找缓存 value ， PeerGetter 对应于 http 客户端
+// out 中除了值之外还有值剩余的有效时间
 type PeerGetter interface {
-	Get(group string, key string) ([]byte, error)
+	Get(in *pb.Request, out *pb.Response) error
+}
+
+// PeerGetterCtx 是可以取消的 PeerGetter，PeerGetter 同时实现了这个接口时 Group.GetContext 使用它
+// ctx 的剩余时间作为 Request.timeout_ms 发送给远程节点，调用者离开之后不再等待响应
+type PeerGetterCtx interface {
+	GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// timeoutMs 返回 ctx 剩余的毫秒数，至少 1 毫秒，没有 deadline 时返回 0
+func timeoutMs(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if ms := time.Until(deadline).Milliseconds(); ms > 1 {
+		return ms
+	}
+	return 1
+}
+
+// PeerWriter 接口用于修改远程节点上的缓存，PeerGetter 同时实现了这个接口时，Group 的写操作会发送到 key 所在的节点
+type PeerWriter interface {
+	Set(group string, key string, value []byte, ttl time.Duration) error
+	Remove(group string, key string) error
+	Clear(group string) error
+}
+
+// PeerLister 接口返回除了本机之外的所有节点，PeerPicker 同时实现了这个接口时，Group 可以向所有节点广播删除
+type PeerLister interface {
+	ListPeers() []PeerGetter
+}
+
+// peerRing 使用一致性哈希选择节点，并且为每一个节点保存一个客户端，HTTPPool 和 RPCPool 共用
+type peerRing struct {
+	self      string
+	newGetter func(peer string) PeerGetter // 为远程节点创建客户端
+
+	mu      sync.Mutex          // guards ring, getters and suspect
+	ring    placement.Placement // 用来根据具体的 key 选择节点，默认是一致性哈希算法中的 map
+	getters map[string]PeerGetter
+	suspect map[string]bool // 疑似故障的节点仍然在哈希环上，但是不会被选中
+}
+
+// set 将节点设置为 peers，只添加新的节点、删除不再存在的节点，其余节点的客户端和连接保持不变
+func (r *peerRing) set(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keep := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		keep[peer] = true
+	}
+	var removed []string
+	for peer := range r.getters {
+		if !keep[peer] {
+			removed = append(removed, peer)
+		}
+	}
+	r.removeLocked(removed...)
+	r.addLocked(peers...)
+}
+
+// add 添加节点，已经存在的节点会被忽略
+func (r *peerRing) add(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addLocked(peers...)
+}
+
+// remove 删除节点，并且关闭节点的客户端
+func (r *peerRing) remove(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(peers...)
+}
+
+func (r *peerRing) addLocked(peers ...string) {
+	if r.ring == nil {
+		r.ring = consistenthash.New(defaultReplicas, nil)
+	}
+	if r.getters == nil {
+		r.getters = make(map[string]PeerGetter, len(peers))
+	}
+	for _, peer := range peers {
+		if _, ok := r.getters[peer]; ok || peer == "" {
+			continue
+		}
+		r.ring.Add(peer)
+		r.getters[peer] = r.newGetter(peer)
+	}
+}
+
+func (r *peerRing) removeLocked(peers ...string) {
+	for _, peer := range peers {
+		getter, ok := r.getters[peer]
+		if !ok {
+			continue
+		}
+		r.ring.Remove(peer)
+		delete(r.getters, peer)
+		if c, ok := getter.(interface{ close() }); ok {
+			c.close()
+		}
+	}
+}
+
+// setSuspect 将疑似故障的节点设置为 peers
+func (r *peerRing) setSuspect(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.suspect = make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		r.suspect[peer] = true
+	}
+}
+
+// names 返回所有节点的地址，包括本机，按照字典序排列
+func (r *peerRing) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.getters))
+	for peer := range r.getters {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pick 返回 key 所在的远程节点，key 在本机、所在的节点疑似故障或者熔断时 ok 为 false
+func (r *peerRing) pick(key string) (peer string, getter PeerGetter, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ring == nil {
+		return "", nil, false
+	}
+	if peer = r.ring.Get(key); peer != "" && peer != r.self && !r.suspect[peer] {
+		getter = r.getters[peer]
+		if a, ok := getter.(interface{ available() bool }); ok && !a.available() {
+			return "", nil, false
+		}
+		return peer, getter, true
+	}
+	return "", nil, false
+}
+
+// pickN 按照顺序返回 key 所在的 n 个节点，本机用 nil 表示，疑似故障和熔断的节点被跳过
+func (r *peerRing) pickN(key string, n int) []PeerGetter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ring == nil {
+		return nil
+	}
+	var peers []PeerGetter
+	for _, peer := range r.ring.GetN(key, n) {
+		if peer == r.self {
+			peers = append(peers, nil)
+			continue
+		}
+		getter := r.getters[peer]
+		if a, ok := getter.(interface{ available() bool }); r.suspect[peer] || ok && !a.available() {
+			continue
+		}
+		peers = append(peers, getter)
+	}
+	return peers
+}
+
+// list 返回除了本机之外所有节点的客户端
+func (r *peerRing) list() []PeerGetter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(r.getters))
+	for peer, getter := range r.getters {
+		if peer != r.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
 }
@@ -0,0 +1,119 @@
+package placement
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// report 是一个算法的分布和节点变化时移动的 key 的比例
+type report struct {
+	stddev  float64 // 每一个节点上的 key 数的标准差 / 平均值
+	maxLoad float64 // 最多的节点上的 key 数 / 平均值
+	added   float64 // 加入一个节点时移动的 key 的比例
+	removed float64 // 再删除这个节点时移动的 key 的比例
+}
+
+func (r report) String() string {
+	return fmt.Sprintf("stddev %5.1f%%  max/mean %.3f  moved on add %5.2f%%  moved on remove %5.2f%%",
+		r.stddev*100, r.maxLoad, r.added*100, r.removed*100)
+}
+
+// analyze 将 keys 个 key 分配到 nodes 个节点上，然后加入一个节点再删除它，统计分布和移动
+func analyze(p Placement, nodes, keys int) report {
+	for i := 0; i < nodes; i++ {
+		p.Add("node" + strconv.Itoa(i))
+	}
+	get := p.Get
+	if b, ok := p.(*Bounded); ok {
+		get = b.Acquire // Bounded 只有记录了负载才会把 key 分散到其他节点
+	}
+	assign := func() []string {
+		owners := make([]string, keys)
+		for i := range owners {
+			owners[i] = get("key" + strconv.Itoa(i))
+		}
+		return owners
+	}
+	moved := func(a, b []string) float64 {
+		n := 0
+		for i := range a {
+			if a[i] != b[i] {
+				n++
+			}
+		}
+		return float64(n) / float64(len(a))
+	}
+
+	before := assign()
+	counts := make(map[string]int)
+	for _, node := range before {
+		counts[node]++
+	}
+	mean := float64(keys) / float64(nodes)
+	var variance, max float64
+	for i := 0; i < nodes; i++ {
+		c := float64(counts["node"+strconv.Itoa(i)])
+		variance += (c - mean) * (c - mean)
+		max = math.Max(max, c)
+	}
+
+	extra := "node" + strconv.Itoa(nodes)
+	p.Add(extra)
+	added := assign()
+	p.Remove(extra)
+	removed := assign()
+
+	return report{
+		stddev:  math.Sqrt(variance/float64(nodes)) / mean,
+		maxLoad: max / mean,
+		added:   moved(before, added),
+		removed: moved(added, removed),
+	}
+}
+
+// TestDistribution 比较各个算法，go test -v -run TestDistribution 输出报告
+func TestDistribution(t *testing.T) {
+	const nodes, keys = 10, 100000
+	bounds := map[string]float64{ // max/mean 的上限
+		"ring-xxhash": 1.3,
+		"bounded":     1.26,
+		"rendezvous":  1.05,
+		"jump":        1.05,
+		"maglev":      1.05,
+	}
+
+	var names []string
+	for name := range algorithms() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r := analyze(algorithms()[name](), nodes, keys)
+		t.Logf("%-15s %v", name, r)
+
+		if bound, ok := bounds[name]; ok && r.maxLoad > bound {
+			t.Errorf("%s: max/mean %.3f exceeds %.2f", name, r.maxLoad, bound)
+		}
+		// 理想情况下加入第 N+1 个节点时移动 1/(N+1) 的 key，Bounded 的负载变化会额外移动一些 key
+		if limit := 2.0 / (nodes + 1); name != "bounded" && (r.added > limit || r.removed > limit) {
+			t.Errorf("%s: too many keys moved: %v", name, r)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for name, newPlacement := range algorithms() {
+		p := newPlacement()
+		for i := 0; i < 10; i++ {
+			p.Add("node" + strconv.Itoa(i))
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p.Get("key" + strconv.Itoa(i&1023))
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package placement
+
+import "math"
+
+const (
+	defaultBoundedFactor = 1.25
+	boundedDecayWindow   = 1 << 16
+)
+
+// Bounded 是有界负载的一致性哈希（Consistent Hashing with Bounded Loads）
+//
+// 节点的负载上限是 ceil(c * 平均负载)，key 顺时针遇到的第一个没有达到上限的节点负责它。
+// Get 只读取负载，不会修改它，负载只通过 Acquire 记录：Acquire 返回 Get 的结果并且把它算作这个节点的一个单位的负载。
+// 热点 key 让节点超载时，后面的 key 会溢出到下一个节点，所以记录了负载之后同一个 key 可能被分配到不同的节点。
+// 总负载达到 boundedDecayWindow 时所有节点的负载减半，让负载反映最近的访问
+//
+// 负载只保存在本地，各个节点看到的负载不同，对 key 的归属不会达成一致，
+// 所以 Bounded 适合在本地选择后端做负载均衡，作为 HTTPPool / RPCPool 的 Placement 时不能调用 Acquire，
+// 此时它的结果和 Ring 相同
+type Bounded struct {
+	ring  *Ring
+	c     float64
+	loads map[string]int64
+	total int64
+}
+
+// NewBounded 创建一个有界负载的一致性哈希，c 不大于 1 时使用 1.25
+func NewBounded(replicas int, c float64, hash Hash) *Bounded {
+	if c <= 1 {
+		c = defaultBoundedFactor
+	}
+	return &Bounded{
+		ring:  NewRing(replicas, hash),
+		c:     c,
+		loads: make(map[string]int64),
+	}
+}
+
+// Add 添加节点
+func (b *Bounded) Add(nodes ...string) {
+	b.ring.Add(nodes...)
+}
+
+// Remove 删除节点以及它的负载
+func (b *Bounded) Remove(nodes ...string) {
+	b.ring.Remove(nodes...)
+	for _, node := range nodes {
+		b.total -= b.loads[node]
+		delete(b.loads, node)
+	}
+}
+
+// Get 返回 key 顺时针遇到的第一个再增加一个单位的负载也不会超载的节点，不修改负载
+func (b *Bounded) Get(key string) string {
+	if len(b.ring.points) == 0 {
+		return ""
+	}
+	capacity := int64(math.Ceil(b.c * float64(b.total+1) / float64(len(b.ring.nodes))))
+	nodes := b.ring.walk(b.ring.search(key), 1, func(node string) bool {
+		return b.loads[node]+1 > capacity
+	})
+	return nodes[0]
+}
+
+// Acquire 返回 Get 的结果，并且增加它的负载
+func (b *Bounded) Acquire(key string) string {
+	node := b.Get(key)
+	if node == "" {
+		return ""
+	}
+	b.loads[node]++
+	b.total++
+	if b.total >= boundedDecayWindow {
+		b.total = 0
+		for n, load := range b.loads {
+			b.loads[n] = load / 2
+			b.total += load / 2
+		}
+	}
+	return node
+}
+
+// GetN 第一个节点是 Get 的结果，其余的是 key 顺时针遇到的其他节点
+func (b *Bounded) GetN(key string, n int) []string {
+	if len(b.ring.points) == 0 || n <= 0 {
+		return nil
+	}
+	first := b.Get(key)
+	nodes := []string{first}
+	for _, node := range b.ring.walk(b.ring.search(key), n, nil) {
+		if node != first && len(nodes) < n {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Loads 返回每一个节点当前的负载
+func (b *Bounded) Loads() map[string]int64 {
+	loads := make(map[string]int64, len(b.loads))
+	for node, load := range b.loads {
+		loads[node] = load
+	}
+	return loads
+}
+
+var _ Placement = (*Bounded)(nil)
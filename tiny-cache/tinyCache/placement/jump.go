@@ -0,0 +1,84 @@
+package placement
+
+// Jump 是 jump consistent hash（Lamping & Veach），节点按照加入的顺序编号为桶
+//
+// 在末尾增加或者删除节点时只有 1/N 的 key 移动，删除中间的节点时最后一个节点会移动到它的位置，
+// 所以这个节点和最后一个节点的 key 都会移动。适合节点列表只在末尾变化的场景
+type Jump struct {
+	hash  Hash
+	nodes []string
+}
+
+// NewJump 创建一个 jump consistent hash，hash 为 nil 时使用 XXHash
+func NewJump(hash Hash) *Jump {
+	if hash == nil {
+		hash = XXHash
+	}
+	return &Jump{hash: hash}
+}
+
+// Add 在末尾添加节点
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if j.index(node) < 0 {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+}
+
+// Remove 删除节点，最后一个节点移动到被删除的节点的位置
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := j.index(node); i >= 0 {
+			last := len(j.nodes) - 1
+			j.nodes[i] = j.nodes[last]
+			j.nodes = j.nodes[:last]
+		}
+	}
+}
+
+func (j *Jump) index(node string) int {
+	for i, n := range j.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get 返回 key 所在的桶对应的节点
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(j.hash([]byte(key)), len(j.nodes))]
+}
+
+// GetN 第一个节点是 Get 的结果，其余的是编号紧随其后的节点
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	b := jumpHash(j.hash([]byte(key)), len(j.nodes))
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.nodes[(b+i)%len(j.nodes)]
+	}
+	return nodes
+}
+
+// jumpHash 将 key 映射到 [0, buckets) 中的一个桶
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+var _ Placement = (*Jump)(nil)
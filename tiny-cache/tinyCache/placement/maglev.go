@@ -0,0 +1,118 @@
+package placement
+
+import "sort"
+
+// defaultMaglevSize 是查找表的默认大小，必须是质数，并且远大于节点数
+const defaultMaglevSize = 65537
+
+// Maglev 是 Google Maglev 负载均衡器使用的一致性哈希
+//
+// 每一个节点根据 offset 和 skip 生成一个 [0, M) 的排列，节点轮流按照自己的排列填充查找表中的空位，
+// 所以每一个节点在查找表中的位置数最多相差 1。节点变化时重建查找表，大部分位置保持不变
+type Maglev struct {
+	hash   Hash
+	size   uint64
+	nodes  []string // sorted
+	lookup []int    // 查找表，值是 nodes 的下标
+}
+
+// NewMaglev 创建一个 Maglev 哈希，size 为 0 时使用 65537，hash 为 nil 时使用 XXHash
+func NewMaglev(size uint64, hash Hash) *Maglev {
+	if size == 0 {
+		size = defaultMaglevSize
+	}
+	if hash == nil {
+		hash = XXHash
+	}
+	return &Maglev{hash: hash, size: size}
+}
+
+// Add 添加节点并重建查找表
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(m.nodes, node)
+		if i < len(m.nodes) && m.nodes[i] == node {
+			continue
+		}
+		m.nodes = append(m.nodes, "")
+		copy(m.nodes[i+1:], m.nodes[i:])
+		m.nodes[i] = node
+	}
+	m.populate()
+}
+
+// Remove 删除节点并重建查找表
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		i := sort.SearchStrings(m.nodes, node)
+		if i < len(m.nodes) && m.nodes[i] == node {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+		}
+	}
+	m.populate()
+}
+
+// populate 按照论文中的算法填充查找表
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.lookup = nil
+		return
+	}
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		offsets[i] = xxhash64([]byte(node), 0xdeadbeef) % m.size
+		skips[i] = xxhash64([]byte(node), 0xcafebabe)%(m.size-1) + 1
+	}
+
+	lookup := make([]int, m.size)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+	next := make([]uint64, len(m.nodes))
+	for filled := uint64(0); ; {
+		for i := range m.nodes {
+			c := (offsets[i] + next[i]*skips[i]) % m.size
+			for lookup[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			lookup[c] = i
+			next[i]++
+			if filled++; filled == m.size {
+				m.lookup = lookup
+				return
+			}
+		}
+	}
+}
+
+// Get 返回查找表中 key 对应的节点
+func (m *Maglev) Get(key string) string {
+	if len(m.lookup) == 0 {
+		return ""
+	}
+	return m.nodes[m.lookup[m.hash([]byte(key))%m.size]]
+}
+
+// GetN 从 key 在查找表中的位置开始依次收集 n 个不同的节点
+func (m *Maglev) GetN(key string, n int) []string {
+	if len(m.lookup) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	start := m.hash([]byte(key)) % m.size
+	nodes := make([]string, 0, n)
+	seen := make(map[int]bool, n)
+	for i := uint64(0); i < m.size && len(nodes) < n; i++ {
+		if idx := m.lookup[(start+i)%m.size]; !seen[idx] {
+			seen[idx] = true
+			nodes = append(nodes, m.nodes[idx])
+		}
+	}
+	return nodes
+}
+
+var _ Placement = (*Maglev)(nil)
@@ -0,0 +1,74 @@
+package placement
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+	"tiny-cache/tinyCache/consistenthash"
+)
+
+/*
+
+节点选择算法，决定每一个 key 由哪些节点负责
+
+	Ring         一致性哈希，虚拟节点放在哈希环上，可以选择哈希函数
+	Bounded      有界负载的一致性哈希，节点的负载超过平均值的 c 倍时顺时针交给下一个节点
+	Rendezvous   最高随机权重（HRW），每一个 key 选择 hash(node, key) 最大的节点，不需要虚拟节点
+	Jump         jump consistent hash，没有额外的内存，但是只能高效地在末尾增删节点
+	Maglev       Google Maglev 的查找表，分布最均匀，查找是 O(1)
+
+consistenthash.Map 同样实现了 Placement 接口，是 HTTPPool 和 RPCPool 默认使用的算法
+
+	peers := tinyCache.NewHTTPPoolOpts(self, &tinyCache.HTTPPoolOptions{
+		Placement: placement.NewMaglev(0, placement.XXHash),
+	})
+
+各个算法的分布和节点变化时移动的 key 的比例可以运行 go test -v -run TestDistribution 查看
+
+*/
+
+// Placement 决定每一个 key 由哪些节点负责，实现不需要是并发安全的
+type Placement interface {
+	// Add 添加节点，已经存在的节点会被忽略
+	Add(nodes ...string)
+	// Remove 删除节点
+	Remove(nodes ...string)
+	// Get 返回 key 所在的节点，没有节点时返回 ""
+	Get(key string) string
+	// GetN 按照顺序返回 key 所在的 n 个不同的节点，第一个节点和 Get 的结果相同
+	GetN(key string, n int) []string
+}
+
+// Hash 将 byte 数组转换为 uint64 的函数
+type Hash func(data []byte) uint64
+
+// FNV 返回 data 的 64 位 FNV-1a 哈希值
+// FNV 的高位对短的、只有结尾不同的输入（例如虚拟节点的名称）混合得不充分，在 Ring 中分布比 XXHash 差很多
+func FNV(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// CRC32 返回 data 的 CRC32 校验和，和 consistenthash 默认使用的哈希函数相同
+func CRC32(data []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(data))
+}
+
+// Hash32 将 Hash 转换成 consistenthash 使用的 32 位哈希函数
+//
+//	consistenthash.New(50, placement.Hash32(placement.XXHash))
+func Hash32(hash Hash) consistenthash.Hash {
+	return func(data []byte) uint32 {
+		return uint32(hash(data))
+	}
+}
+
+// mix 是 splitmix64 的最后一步，把两个哈希值混合成一个均匀分布的值
+func mix(a, b uint64) uint64 {
+	z := a ^ (b + 0x9e3779b97f4a7c15 + (a << 6) + (a >> 2))
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+var _ Placement = (*consistenthash.Map)(nil)
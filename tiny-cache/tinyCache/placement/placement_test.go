@@ -0,0 +1,139 @@
+package placement
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"tiny-cache/tinyCache/consistenthash"
+)
+
+// algorithms 返回所有算法的新实例，用于比较
+func algorithms() map[string]func() Placement {
+	return map[string]func() Placement{
+		"consistenthash": func() Placement { return consistenthash.New(50, nil) },
+		"ring-crc32":     func() Placement { return NewRing(50, CRC32) },
+		"ring-fnv":       func() Placement { return NewRing(50, FNV) },
+		"ring-xxhash":    func() Placement { return NewRing(160, XXHash) },
+		"bounded":        func() Placement { return NewBounded(160, 1.25, nil) },
+		"rendezvous":     func() Placement { return NewRendezvous(nil) },
+		"jump":           func() Placement { return NewJump(nil) },
+		"maglev":         func() Placement { return NewMaglev(0, nil) },
+	}
+}
+
+func TestXXHash(t *testing.T) {
+	testCases := map[string]uint64{
+		"":     0xef46db3751d8e999,
+		"a":    0xd24ec4f1a98c6e5b,
+		"abc":  0x44bc2cf5ad770999,
+		"asdf": 0x415872f599cea71e,
+		"Call me Ishmael. Some years ago--never mind how long precisely-": 0x02a2e85470d6fd96,
+	}
+	for s, want := range testCases {
+		if got := XXHash([]byte(s)); got != want {
+			t.Errorf("XXHash(%q) = %x, want %x", s, got, want)
+		}
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	for name, newPlacement := range algorithms() {
+		p := newPlacement()
+		if p.Get("key") != "" || p.GetN("key", 2) != nil {
+			t.Fatalf("%s: empty placement should yield nothing", name)
+		}
+		p.Add("a", "b", "c", "d")
+		p.Add("a") // 重复添加被忽略
+		for i := 0; i < 100; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := p.GetN(key, 3)
+			if len(nodes) != 3 || nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+				t.Fatalf("%s: expect 3 distinct nodes for %s, got %v", name, key, nodes)
+			}
+			if p.Get(key) != nodes[0] {
+				t.Fatalf("%s: GetN(%s)[0] should be the same as Get", name, key)
+			}
+		}
+		if nodes := p.GetN("key", 10); len(nodes) != 4 {
+			t.Fatalf("%s: expect all 4 nodes, got %v", name, nodes)
+		}
+
+		p.Remove("b")
+		for i := 0; i < 100; i++ {
+			if node := p.Get("key" + strconv.Itoa(i)); node == "b" || node == "" {
+				t.Fatalf("%s: removed node should not be picked, got %q", name, node)
+			}
+		}
+		p.Remove("a", "c", "d")
+		if p.Get("key") != "" {
+			t.Fatalf("%s: empty placement should yield nothing", name)
+		}
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	b := NewBounded(50, 1.25, nil)
+	b.Add("a", "b", "c", "d")
+	// 一个热点 key 的负载被分散到多个节点上
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		counts[b.Acquire("hot")]++
+	}
+	for node, n := range counts {
+		if n > 1000*125/100/4+1 {
+			t.Fatalf("%s exceeds the load bound: %v", node, counts)
+		}
+	}
+	var total int64
+	for _, load := range b.Loads() {
+		total += load
+	}
+	if total != 1000 {
+		t.Fatalf("expect total load 1000, got %d", total)
+	}
+
+	// Get 不修改负载，没有 Acquire 时结果稳定
+	owner := b.Get("hot")
+	for i := 0; i < 100; i++ {
+		if b.Get("hot") != owner {
+			t.Fatalf("Get should not change the owner of a key")
+		}
+	}
+	if b.Loads()[owner] != int64(counts[owner]) {
+		t.Fatalf("Get should not record load")
+	}
+
+	b.Remove("a")
+	if _, ok := b.Loads()["a"]; ok {
+		t.Fatalf("load of removed node should be dropped")
+	}
+}
+
+func TestJumpRemoveLast(t *testing.T) {
+	j := NewJump(nil)
+	j.Add("a", "b", "c", "d")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = j.Get(key)
+	}
+	j.Remove("d")
+	for key, node := range before {
+		if after := j.Get(key); node != "d" && after != node {
+			t.Fatalf("%s should stay on %s after removing the last node, got %s", key, node, after)
+		}
+	}
+}
+
+func TestMaglevTable(t *testing.T) {
+	m := NewMaglev(101, nil)
+	m.Add("a", "b", "c")
+	counts := make(map[int]int)
+	for _, idx := range m.lookup {
+		counts[idx]++
+	}
+	// 每一个节点在查找表中的位置数最多相差 1
+	if !reflect.DeepEqual(counts, map[int]int{0: 34, 1: 34, 2: 33}) {
+		t.Fatalf("unexpected table counts %v", counts)
+	}
+}
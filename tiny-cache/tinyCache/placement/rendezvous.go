@@ -0,0 +1,88 @@
+package placement
+
+import "sort"
+
+// Rendezvous 是最高随机权重（HRW）哈希，key 由 mix(hash(key), hash(node)) 最大的节点负责
+// 删除节点时只有这个节点的 key 移动，并且均匀地分给其余的节点，代价是 Get 需要遍历所有节点
+type Rendezvous struct {
+	hash  Hash
+	nodes []string
+	seeds []uint64 // hash(node)
+}
+
+// NewRendezvous 创建一个 HRW 哈希，hash 为 nil 时使用 XXHash
+func NewRendezvous(hash Hash) *Rendezvous {
+	if hash == nil {
+		hash = XXHash
+	}
+	return &Rendezvous{hash: hash}
+}
+
+func (r *Rendezvous) index(node string) int {
+	for i, n := range r.nodes {
+		if n == node {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add 添加节点
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if r.index(node) >= 0 {
+			continue
+		}
+		r.nodes = append(r.nodes, node)
+		r.seeds = append(r.seeds, r.hash([]byte(node)))
+	}
+}
+
+// Remove 删除节点
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if i := r.index(node); i >= 0 {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			r.seeds = append(r.seeds[:i], r.seeds[i+1:]...)
+		}
+	}
+}
+
+// Get 返回权重最大的节点
+func (r *Rendezvous) Get(key string) string {
+	if len(r.nodes) == 0 {
+		return ""
+	}
+	h := r.hash([]byte(key))
+	best, bestScore := 0, uint64(0)
+	for i, seed := range r.seeds {
+		if score := mix(h, seed); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return r.nodes[best]
+}
+
+// GetN 返回权重最大的 n 个节点，按照权重从大到小排列
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	h := r.hash([]byte(key))
+	idx := make([]int, len(r.nodes))
+	scores := make([]uint64, len(r.nodes))
+	for i, seed := range r.seeds {
+		idx[i], scores[i] = i, mix(h, seed)
+	}
+	sort.Slice(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	if n > len(idx) {
+		n = len(idx)
+	}
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = r.nodes[idx[i]]
+	}
+	return nodes
+}
+
+var _ Placement = (*Rendezvous)(nil)
@@ -0,0 +1,119 @@
+package placement
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Ring 是一致性哈希，和 consistenthash.Map 相同，但是可以选择哈希函数，并且使用 64 位的哈希值
+// 虚拟节点的名称是 node + "#" + i，避免 CRC32 对 strconv.Itoa(i) + node 这样只有前缀不同的输入分布不均匀
+type Ring struct {
+	hash     Hash
+	replicas int               // 每一个真实节点的虚拟节点数
+	points   []uint64          // sorted
+	owners   map[uint64]string // 虚拟节点到真实节点的映射
+	nodes    map[string]bool
+}
+
+// NewRing 创建一个一致性哈希，replicas 为 0 时使用 160 个虚拟节点，hash 为 nil 时使用 XXHash
+func NewRing(replicas int, hash Hash) *Ring {
+	if replicas <= 0 {
+		replicas = 160
+	}
+	if hash == nil {
+		hash = XXHash
+	}
+	return &Ring{
+		hash:     hash,
+		replicas: replicas,
+		owners:   make(map[uint64]string),
+		nodes:    make(map[string]bool),
+	}
+}
+
+func (r *Ring) point(node string, i int) uint64 {
+	return r.hash([]byte(node + "#" + strconv.Itoa(i)))
+}
+
+// Add 添加节点以及它的虚拟节点
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		if r.nodes[node] {
+			continue
+		}
+		r.nodes[node] = true
+		for i := 0; i < r.replicas; i++ {
+			p := r.point(node, i)
+			if _, ok := r.owners[p]; !ok {
+				r.points = append(r.points, p)
+			}
+			r.owners[p] = node
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove 删除节点以及它的虚拟节点
+func (r *Ring) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if !r.nodes[node] {
+			continue
+		}
+		delete(r.nodes, node)
+		for i := 0; i < r.replicas; i++ {
+			if p := r.point(node, i); r.owners[p] == node {
+				delete(r.owners, p)
+			}
+		}
+	}
+	kept := r.points[:0]
+	for _, p := range r.points {
+		if _, ok := r.owners[p]; ok {
+			kept = append(kept, p)
+		}
+	}
+	r.points = kept
+}
+
+// search 返回 key 顺时针遇到的第一个虚拟节点的下标
+func (r *Ring) search(key string) int {
+	h := r.hash([]byte(key))
+	idx := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	return idx % len(r.points)
+}
+
+// Get 返回 key 顺时针遇到的第一个节点
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	return r.owners[r.points[r.search(key)]]
+}
+
+// GetN 返回 key 顺时针遇到的 n 个不同的节点
+func (r *Ring) GetN(key string, n int) []string {
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+	return r.walk(r.search(key), n, nil)
+}
+
+// walk 从下标 idx 开始顺时针收集 n 个不同的节点，skip 返回 true 的节点被跳过
+func (r *Ring) walk(idx, n int, skip func(node string) bool) []string {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(r.points) && len(nodes) < n; i++ {
+		node := r.owners[r.points[(idx+i)%len(r.points)]]
+		if seen[node] || skip != nil && skip(node) {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+var _ Placement = (*Ring)(nil)
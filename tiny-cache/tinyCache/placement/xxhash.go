@@ -0,0 +1,79 @@
+package placement
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXH64 的实现，参考 https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+
+const (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// XXHash 返回 data 的 XXH64 哈希值，seed 为 0
+func XXHash(data []byte) uint64 {
+	return xxhash64(data, 0)
+}
+
+func xxhash64(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + prime1 + prime2
+		v2 := seed + prime2
+		v3 := seed
+		v4 := seed - prime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxround(v1, binary.LittleEndian.Uint64(b[0:]))
+			v2 = xxround(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = xxround(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = xxround(v4, binary.LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxmerge(h, v1)
+		h = xxmerge(h, v2)
+		h = xxmerge(h, v3)
+		h = xxmerge(h, v4)
+	} else {
+		h = seed + prime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxround(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for ; len(b) > 0; b = b[1:] {
+		h ^= uint64(b[0]) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+func xxround(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func xxmerge(acc, val uint64) uint64 {
+	acc ^= xxround(0, val)
+	return acc*prime1 + prime4
+}
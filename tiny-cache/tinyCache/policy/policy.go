@@ -0,0 +1,46 @@
+// Package policy defines the interface shared by the eviction policies
+// (lru, lfu, twoq, arc, tinylfu) that back tinyCache's cache.
+package policy
+
+/*
+
+淘汰策略
+
+	lru       最近最少使用，实现简单，但是一次扫描就可以把热点数据全部挤出去
+	lfu       最少使用次数，对扫描友好，但是过去的热点数据很难被淘汰
+	twoq      2Q，新数据先进入 FIFO 队列，被淘汰之后再次访问才进入 LRU 主队列
+	arc       自适应的在 最近访问 和 频繁访问 两个队列之间分配空间
+	tinylfu   W-TinyLFU，窗口 LRU + 分段 LRU，使用 count-min sketch 估计频率决定是否接纳新数据
+
+所有的实现都按照字节数限制容量（key 的长度 + value.Len()），maxBytes 为 0 表示不限制，
+都不是并发安全的，由调用方加锁
+
+*/
+
+// Value use Len to count how many bytes it takes
+type Value interface {
+	Len() int
+}
+
+// Policy 是一个按照某种淘汰策略管理容量的缓存
+type Policy interface {
+	// Add 添加或者更新一个值，超出容量时淘汰一部分值
+	Add(key string, value Value)
+	// Get 查找一个值，同时记录这一次访问
+	Get(key string) (value Value, ok bool)
+	// Remove 删除一个值
+	Remove(key string)
+	// Clear 删除所有的值
+	Clear()
+	// Len 返回值的个数
+	Len() int
+	// Bytes 返回所有值占用的字节数
+	Bytes() int64
+	// Range 依次访问所有的值，fn 返回 false 时停止，不影响淘汰顺序，fn 中不能修改缓存
+	Range(fn func(key string, value Value) bool)
+}
+
+// Size 返回一个值占用的字节数
+func Size(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len())
+}
@@ -0,0 +1,127 @@
+package policy_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"tiny-cache/tinyCache/arc"
+	"tiny-cache/tinyCache/lfu"
+	"tiny-cache/tinyCache/lru"
+	"tiny-cache/tinyCache/policy"
+	"tiny-cache/tinyCache/tinylfu"
+	"tiny-cache/tinyCache/twoq"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+const (
+	keySpace   = 100000
+	traceLen   = 200000
+	entryBytes = 8 // key 7 字节 + value 1 字节
+	cacheBytes = 1000 * entryBytes
+)
+
+var policies = []struct {
+	name string
+	new  func(maxBytes int64) policy.Policy
+}{
+	{"lru", func(maxBytes int64) policy.Policy { return lru.New(maxBytes, nil) }},
+	{"lfu", func(maxBytes int64) policy.Policy { return lfu.New(maxBytes, nil) }},
+	{"twoq", func(maxBytes int64) policy.Policy { return twoq.New(maxBytes, nil) }},
+	{"arc", func(maxBytes int64) policy.Policy { return arc.New(maxBytes, nil) }},
+	{"tinylfu", func(maxBytes int64) policy.Policy { return tinylfu.New(maxBytes, nil) }},
+}
+
+// zipfTrace 生成服从 Zipf 分布的访问序列，s 越大热点越集中
+func zipfTrace(seed int64, s float64, n int) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, s, 1, keySpace-1)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("k%06d", z.Uint64())
+	}
+	return trace
+}
+
+// scanTrace 在 Zipf 访问序列中每隔一段插入一次长的顺序扫描，模拟夜间的批处理任务
+func scanTrace(seed int64, n int) []string {
+	trace := zipfTrace(seed, 1.1, n)
+	scan := 0
+	for i := 0; i+5000 < len(trace); i += 20000 {
+		for j := 0; j < 5000; j++ {
+			trace[i+j] = fmt.Sprintf("s%06d", scan)
+			scan++
+		}
+	}
+	return trace
+}
+
+// hitRatio 按照 读取，未命中时加入 的方式回放 trace
+func hitRatio(p policy.Policy, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := p.Get(key); ok {
+			hits++
+		} else {
+			p.Add(key, String("v"))
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+// traces 是用来比较命中率的访问序列，Zipf 分布的参数必须大于 1
+func traces() []struct {
+	name  string
+	trace []string
+} {
+	return []struct {
+		name  string
+		trace []string
+	}{
+		{"zipf-1.01", zipfTrace(1, 1.01, traceLen)},
+		{"zipf-1.2", zipfTrace(1, 1.2, traceLen)},
+		{"scan", scanTrace(1, traceLen)},
+	}
+}
+
+// TestHitRatio 打印每种策略的命中率，并且检查它们在有扫描的时候都比 lru 好
+func TestHitRatio(t *testing.T) {
+	for _, tr := range traces() {
+		var base float64
+		for _, p := range policies {
+			ratio := hitRatio(p.new(cacheBytes), tr.trace)
+			t.Logf("%-10s %-8s %.4f", tr.name, p.name, ratio)
+			if p.name == "lru" {
+				base = ratio
+			} else if tr.name == "scan" && ratio <= base {
+				t.Errorf("%s hit ratio %.4f on scan trace is not better than lru %.4f", p.name, ratio, base)
+			}
+		}
+	}
+}
+
+// go test -bench HitRatio -run none ./tinyCache/policy
+func BenchmarkHitRatio(b *testing.B) {
+	for _, tr := range traces() {
+		for _, p := range policies {
+			trace := tr.trace
+			b.Run(tr.name+"/"+p.name, func(b *testing.B) {
+				c := p.new(cacheBytes)
+				hits := 0
+				for i := 0; i < b.N; i++ {
+					key := trace[i%len(trace)]
+					if _, ok := c.Get(key); ok {
+						hits++
+					} else {
+						c.Add(key, String("v"))
+					}
+				}
+				b.ReportMetric(100*float64(hits)/float64(b.N), "hit%")
+			})
+		}
+	}
+}
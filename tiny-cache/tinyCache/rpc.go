@@ -0,0 +1,548 @@
+package tinyCache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+	"tiny-cache/tinyCache/placement"
+
+	"github.com/golang/protobuf/proto"
+)
+
+/*
+
+RPCPool 使用长连接的二进制协议在节点之间传输 cachepb 中 GroupCache 服务的请求
+
+每一个请求和响应是一帧：
+
+	| length uint32 | seq uint64 | method uint8 | protobuf |    请求，method 是 GroupCache 的方法
+	| length uint32 | seq uint64 | protobuf                |    响应，protobuf 是 cachepb.Response
+
+length 是 length 之后的字节数，seq 由客户端分配，服务端原样返回
+
+	多路复用   每一个远程节点只有一个连接，多个请求同时在这个连接上进行，响应按照 seq 分发
+	流水线     客户端不等待响应就可以发送下一个请求，服务端并发处理同一个连接上的请求，响应的顺序不固定
+	批量写入   客户端和服务端都把写队列中已有的帧合并到一次 flush 中，减少系统调用
+	限流       服务端每个连接最多同时处理 MaxInFlight 个请求，达到上限时暂停读取这个连接，由 TCP 的流量控制让客户端等待
+
+rpcGetter 和 httpGetter 使用相同的重试和熔断（见 HTTPPoolOptions），所有的方法都是幂等的，连接失败时可以重试
+
+	peers := tinyCache.NewRPCPool("localhost:9001")
+	peers.Set("localhost:9001", "localhost:9002", "localhost:9003")
+	group.RegisterPeers(peers)
+	lis, _ := net.Listen("tcp", "localhost:9001")
+	log.Fatal(peers.Serve(lis))
+
+*/
+
+const (
+	methodGet uint8 = iota + 1
+	methodSet
+	methodRemove
+	methodClear
+)
+
+const (
+	maxFrameSize       = 64 << 20
+	defaultDialTimeout = time.Second
+	defaultMaxInFlight = 256
+)
+
+var errConnClosed = errors.New("tinyCache: rpc connection closed")
+
+// RPCPool implements PeerPicker for a pool of RPC peers.
+type RPCPool struct {
+	self        string
+	maxInFlight int      // 每个连接同时处理的请求数的上限
+	peers       peerRing // 一致性哈希环以及每一个远程节点对应的 rpcGetter，keyed by e.g. "10.0.0.2:9001"
+}
+
+// RPCPoolOptions are the configurations of a RPCPool.
+// 零值的字段使用默认值
+type RPCPoolOptions struct {
+	// Placement 是选择节点的算法，默认是 50 个虚拟节点、CRC32 的 consistenthash.Map
+	Placement placement.Placement
+	// DialTimeout 是建立连接的超时时间，默认 1s
+	DialTimeout time.Duration
+	// MaxInFlight 是服务端每个连接同时处理的请求数的上限，默认 256
+	MaxInFlight int
+
+	// MaxRetries，RetryBackoff，BreakerThreshold 和 BreakerTimeout 的含义和默认值与 HTTPPoolOptions 相同
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	BreakerThreshold int
+	BreakerTimeout   time.Duration
+}
+
+// NewRPCPool initializes an RPC pool of peers, self 是本机的地址，例如 "localhost:9001"
+func NewRPCPool(self string) *RPCPool {
+	return NewRPCPoolOpts(self, nil)
+}
+
+// NewRPCPoolOpts initializes an RPC pool of peers with the given options.
+func NewRPCPoolOpts(self string, o *RPCPoolOptions) *RPCPool {
+	var opts RPCPoolOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = defaultMaxInFlight
+	}
+	return &RPCPool{
+		self:        self,
+		maxInFlight: opts.MaxInFlight,
+		peers: peerRing{self: self, ring: opts.Placement, newGetter: func(peer string) PeerGetter {
+			return &rpcGetter{
+				addr:        peer,
+				dialTimeout: opts.DialTimeout,
+				peerPolicy:  newPeerPolicy(opts.MaxRetries, opts.RetryBackoff, opts.BreakerThreshold, opts.BreakerTimeout),
+			}
+		}},
+	}
+}
+
+// Log info with server name
+func (p *RPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[RPC Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set 将节点设置为 peers，被删除的节点的连接会被关闭，其余节点的连接保持不变
+func (p *RPCPool) Set(peers ...string) {
+	p.peers.set(peers...)
+}
+
+// AddPeer 在运行时添加节点
+func (p *RPCPool) AddPeer(peers ...string) {
+	p.peers.add(peers...)
+}
+
+// RemovePeer 在运行时删除节点，并且关闭到这些节点的连接
+func (p *RPCPool) RemovePeer(peers ...string) {
+	p.peers.remove(peers...)
+}
+
+// SetSuspect 设置疑似故障的节点，PickPeer 不会选择这些节点，它们的 key 回退到本机加载
+func (p *RPCPool) SetSuspect(peers ...string) {
+	p.peers.setSuspect(peers...)
+}
+
+// Peers 返回当前所有节点的地址，包括本机
+func (p *RPCPool) Peers() []string {
+	return p.peers.names()
+}
+
+// PickPeer 根据具体的 key 选择节点，返回节点对应的 RPC 客户端
+func (p *RPCPool) PickPeer(key string) (PeerGetter, bool) {
+	if peer, getter, ok := p.peers.pick(key); ok {
+		p.Log("Pick peer %s", peer)
+		return getter, true
+	}
+	return nil, false
+}
+
+// PickReplicas 按照顺序返回 key 所在的 n 个节点，本机用 nil 表示
+func (p *RPCPool) PickReplicas(key string, n int) []PeerGetter {
+	return p.peers.pickN(key, n)
+}
+
+// ListPeers 返回除了本机之外所有节点的 rpcGetter
+func (p *RPCPool) ListPeers() []PeerGetter {
+	return p.peers.list()
+}
+
+// Close 关闭到其他节点的所有连接
+func (p *RPCPool) Close() {
+	for _, getter := range p.peers.list() {
+		getter.(*rpcGetter).close()
+	}
+}
+
+// Serve 接受 lis 上的连接并处理其他节点的请求，直到 lis 被关闭
+func (p *RPCPool) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// serveConn 处理一个连接，每一个请求在单独的 goroutine 中处理，响应交给 writeLoop 批量写入
+// 正在处理的请求达到 maxInFlight 时先等待其中一个完成再读取下一帧
+// 连接断开之后正在处理的请求的 ctx 被取消
+func (p *RPCPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sendq := make(chan []byte, 128)
+	done := make(chan struct{})
+	writerDone := make(chan struct{}) // 写入失败之后不再发送响应
+	go func() {
+		defer close(writerDone)
+		if err := writeLoop(conn, sendq, done); err != nil {
+			p.Log("write response: %v", err)
+		}
+	}()
+
+	maxInFlight := p.maxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	inflight := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				p.Log("read request: %v", err)
+			}
+			break
+		}
+		if len(frame) < 9 {
+			p.Log("short request frame")
+			break
+		}
+		seq, method, payload := binary.BigEndian.Uint64(frame), frame[8], frame[9:]
+		inflight <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			select {
+			case sendq <- encodeFrame(seq, nil, handleRPC(ctx, method, payload)):
+			case <-writerDone:
+			}
+		}()
+	}
+	cancel()
+	wg.Wait()
+	close(done)
+	<-writerDone
+}
+
+// handleRPC 解码请求并调用对应的处理函数
+func handleRPC(ctx context.Context, method uint8, payload []byte) *pb.Response {
+	switch method {
+	case methodGet, methodRemove, methodClear:
+		in := &pb.Request{}
+		if err := proto.Unmarshal(payload, in); err != nil {
+			return &pb.Response{Code: pb.Code_BAD_REQUEST, Error: "decoding request: " + err.Error()}
+		}
+		switch method {
+		case methodGet:
+			return serveGet(ctx, in)
+		case methodRemove:
+			return serveRemove(in)
+		default:
+			return serveClear(in)
+		}
+	case methodSet:
+		in := &pb.SetRequest{}
+		if err := proto.Unmarshal(payload, in); err != nil {
+			return &pb.Response{Code: pb.Code_BAD_REQUEST, Error: "decoding request: " + err.Error()}
+		}
+		return serveSet(in)
+	}
+	return &pb.Response{Code: pb.Code_BAD_REQUEST, Error: fmt.Sprintf("unknown method %d", method)}
+}
+
+// writeLoop 将 sendq 中的帧写入 w，队列中已有的帧合并到一次 flush 中，done 关闭之后写完剩下的帧再退出
+func writeLoop(w io.Writer, sendq chan []byte, done chan struct{}) error {
+	bw := bufio.NewWriter(w)
+	for {
+		select {
+		case frame := <-sendq:
+			bw.Write(frame)
+			for n := len(sendq); n > 0; n-- {
+				bw.Write(<-sendq)
+			}
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		case <-done:
+			for n := len(sendq); n > 0; n-- {
+				bw.Write(<-sendq)
+			}
+			return bw.Flush()
+		}
+	}
+}
+
+// encodeFrame 编码一帧，header 是 seq 之后，protobuf 之前的字节（请求的 method）
+func encodeFrame(seq uint64, header []byte, msg proto.Message) []byte {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		payload, _ = proto.Marshal(&pb.Response{Code: pb.Code_INTERNAL, Error: err.Error()})
+	}
+	frame := make([]byte, 12, 12+len(header)+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(8+len(header)+len(payload)))
+	binary.BigEndian.PutUint64(frame[4:], seq)
+	frame = append(frame, header...)
+	return append(frame, payload...)
+}
+
+// readFrame 读取一帧，返回 length 之后的字节
+func readFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n < 8 || n > maxFrameSize {
+		return nil, fmt.Errorf("invalid frame length %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+var _ PeerPicker = (*RPCPool)(nil)
+var _ PeerLister = (*RPCPool)(nil)
+var _ ReplicaPicker = (*RPCPool)(nil)
+
+// rpcGetter 是一个远程节点的客户端，第一次调用时建立连接，连接断开之后下一次调用重新建立
+type rpcGetter struct {
+	peerPolicy  // 重试和熔断
+	addr        string
+	dialTimeout time.Duration
+
+	mu      sync.Mutex // guards following
+	conn    *rpcConn
+	dialing chan struct{} // 正在建立连接时不为 nil，建立完成（或者失败）之后关闭
+	gen     int           // 每次 close 加一，close 之前开始建立的连接不再使用
+}
+
+// Get 方法从远程节点获取值，填充到 out 中
+func (g *rpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+// GetContext 和 Get 相同，ctx 的剩余时间作为 in.TimeoutMs 发送给远程节点
+func (g *rpcGetter) GetContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	in.TimeoutMs = timeoutMs(ctx)
+	return g.call(ctx, methodGet, in, out)
+}
+
+// Set 将值写入远程节点
+func (g *rpcGetter) Set(group string, key string, value []byte, ttl time.Duration) error {
+	in := &pb.SetRequest{Group: group, Key: key, Value: value, TtlMs: ttl.Milliseconds()}
+	return g.call(context.Background(), methodSet, in, &pb.Response{})
+}
+
+// Remove 删除远程节点上的值
+func (g *rpcGetter) Remove(group string, key string) error {
+	return g.call(context.Background(), methodRemove, &pb.Request{Group: group, Key: key}, &pb.Response{})
+}
+
+// Clear 清空远程节点上的 group
+func (g *rpcGetter) Clear(group string) error {
+	return g.call(context.Background(), methodClear, &pb.Request{Group: group}, &pb.Response{})
+}
+
+// call 发送一个请求，连接失败或者断开时按照 peerPolicy 重试
+func (g *rpcGetter) call(ctx context.Context, method uint8, in proto.Message, out *pb.Response) error {
+	return g.retry(ctx, g.addr, func() error {
+		out.Reset()
+		conn, err := g.getConn(ctx)
+		if err == nil {
+			err = conn.call(ctx, method, in, out)
+		}
+		if err != nil {
+			return &PeerError{Peer: g.addr, Unavailable: true, Err: err}
+		}
+		if out.GetCode() != pb.Code_OK {
+			return responseError(g.addr, out)
+		}
+		return nil
+	})
+}
+
+// getConn 返回当前的连接，没有可用的连接时建立一个
+// 建立连接时不持有 g.mu，同时到达的调用等待同一次 dial，不会各自建立连接
+func (g *rpcGetter) getConn(ctx context.Context) (*rpcConn, error) {
+	for {
+		g.mu.Lock()
+		if g.conn != nil && !g.conn.closed() {
+			conn := g.conn
+			g.mu.Unlock()
+			return conn, nil
+		}
+		if dialing := g.dialing; dialing != nil {
+			g.mu.Unlock()
+			select {
+			case <-dialing:
+				continue // 重新检查，dial 失败时由这个调用自己重新建立
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		dialing, gen := make(chan struct{}), g.gen
+		g.dialing = dialing
+		g.mu.Unlock()
+
+		nc, err := (&net.Dialer{Timeout: g.dialTimeout}).DialContext(ctx, "tcp", g.addr)
+
+		g.mu.Lock()
+		g.dialing = nil
+		close(dialing)
+		if err != nil {
+			g.mu.Unlock()
+			return nil, err
+		}
+		if gen != g.gen { // dial 期间 getter 被关闭了
+			g.mu.Unlock()
+			nc.Close()
+			return nil, errConnClosed
+		}
+		g.conn = newRPCConn(nc)
+		conn := g.conn
+		g.mu.Unlock()
+		return conn, nil
+	}
+}
+
+func (g *rpcGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gen++
+	if g.conn != nil {
+		g.conn.close(errConnClosed)
+		g.conn = nil
+	}
+}
+
+var _ PeerGetter = (*rpcGetter)(nil)
+var _ PeerGetterCtx = (*rpcGetter)(nil)
+var _ PeerWriter = (*rpcGetter)(nil)
+
+// rpcConn 是一个多路复用的连接，readLoop 按照 seq 把响应分发给等待的调用
+type rpcConn struct {
+	conn  net.Conn
+	sendq chan []byte
+	done  chan struct{} // 连接关闭之后关闭
+
+	mu      sync.Mutex // guards following
+	seq     uint64
+	pending map[uint64]chan []byte
+	err     error
+}
+
+func newRPCConn(conn net.Conn) *rpcConn {
+	c := &rpcConn{
+		conn:    conn,
+		sendq:   make(chan []byte, 128),
+		done:    make(chan struct{}),
+		pending: make(map[uint64]chan []byte),
+	}
+	go func() {
+		if err := writeLoop(conn, c.sendq, c.done); err != nil {
+			c.close(err)
+		}
+	}()
+	go c.readLoop()
+	return c
+}
+
+// call 发送一个请求并等待响应，ctx 结束时不再等待，之后到达的响应被丢弃
+func (c *rpcConn) call(ctx context.Context, method uint8, in proto.Message, out *pb.Response) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.seq++
+	seq := c.seq
+	ch := make(chan []byte, 1)
+	c.pending[seq] = ch
+	c.mu.Unlock()
+
+	select {
+	case c.sendq <- encodeFrame(seq, []byte{method}, in):
+	case <-c.done:
+		return c.closeErr()
+	case <-ctx.Done():
+		c.forget(seq)
+		return ctx.Err()
+	}
+
+	select {
+	case payload := <-ch:
+		return proto.Unmarshal(payload, out)
+	case <-ctx.Done():
+		c.forget(seq)
+		return ctx.Err()
+	case <-c.done:
+		select {
+		case payload := <-ch:
+			return proto.Unmarshal(payload, out)
+		default:
+			return c.closeErr()
+		}
+	}
+}
+
+// forget 删除不再等待的调用
+func (c *rpcConn) forget(seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, seq)
+}
+
+func (c *rpcConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		seq := binary.BigEndian.Uint64(frame)
+		c.mu.Lock()
+		ch, ok := c.pending[seq]
+		delete(c.pending, seq)
+		c.mu.Unlock()
+		if ok {
+			ch <- frame[8:]
+		}
+	}
+}
+
+// close 关闭连接，所有等待中的调用返回 err
+func (c *rpcConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.pending = nil
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *rpcConn) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+func (c *rpcConn) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
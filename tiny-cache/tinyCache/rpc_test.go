@@ -0,0 +1,379 @@
+package tinyCache
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+)
+
+// startRPC 在 loopback 上启动一个 RPCPool 的服务端，返回它的地址
+func startRPC(t testing.TB) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewRPCPool(lis.Addr().String())
+	go pool.Serve(lis)
+	return lis.Addr().String(), func() { lis.Close() }
+}
+
+func TestRPCPool(t *testing.T) {
+	g := NewGroup("rpc", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("origin-" + key), nil }), WithTTL(time.Minute))
+	addr, stop := startRPC(t)
+	defer stop()
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+
+	out := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "rpc", Key: "Tom"}, out); err != nil || string(out.Value) != "origin-Tom" {
+		t.Fatalf("expect origin-Tom, got %q %v", out.Value, err)
+	}
+	if out.TtlMs <= 0 {
+		t.Fatalf("expect ttl from peer, got %d", out.TtlMs)
+	}
+
+	if err := getter.Set("rpc", "Jack", []byte("set"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("Jack"); !ok || v.String() != "set" {
+		t.Fatalf("value set over rpc should be cached")
+	}
+	if err := getter.Remove("rpc", "Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Jack"); ok {
+		t.Fatalf("value removed over rpc should not be cached")
+	}
+	if err := getter.Clear("rpc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("group cleared over rpc should be empty")
+	}
+	if err := getter.Get(&pb.Request{Group: "no-such-group", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatalf("expect error for unknown group")
+	}
+}
+
+func TestRPCPipelining(t *testing.T) {
+	NewGroup("rpc-pipeline", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			time.Sleep(10 * time.Millisecond)
+			return []byte(key), nil
+		}))
+	addr, stop := startRPC(t)
+	defer stop()
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+
+	// 100 个请求共用一个连接并发进行，总时间远小于串行的 1 秒
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			out := &pb.Response{}
+			if err := getter.Get(&pb.Request{Group: "rpc-pipeline", Key: key}, out); err != nil || string(out.Value) != key {
+				t.Errorf("expect %s, got %q %v", key, out.Value, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("requests are not pipelined, took %v", elapsed)
+	}
+}
+
+func TestRPCReconnect(t *testing.T) {
+	NewGroup("rpc-reconnect", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	addr, stop := startRPC(t)
+	defer stop()
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+
+	in := &pb.Request{Group: "rpc-reconnect", Key: "k"}
+	if err := getter.Get(in, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	getter.conn.conn.Close() // 模拟连接断开
+	time.Sleep(10 * time.Millisecond)
+	if err := getter.Get(in, &pb.Response{}); err != nil {
+		t.Fatalf("getter should reconnect, got %v", err)
+	}
+}
+
+func TestRPCPoolPickPeer(t *testing.T) {
+	pool := NewRPCPool("127.0.0.1:1")
+	pool.Set("127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3")
+	if n := len(pool.ListPeers()); n != 2 {
+		t.Fatalf("expect 2 remote peers, got %d", n)
+	}
+	remote := 0
+	for i := 0; i < 300; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			remote++
+		}
+	}
+	if remote == 0 || remote == 300 {
+		t.Fatalf("keys should be spread over all peers, %d of 300 are remote", remote)
+	}
+}
+
+// BenchmarkPeerGet 比较 HTTPPool 和 RPCPool 在 loopback 上获取一个已经缓存的值的延迟
+//
+//	go test -bench PeerGet -run none ./tinyCache
+func BenchmarkPeerGet(b *testing.B) {
+	w := log.Writer()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(w)
+	NewGroup("bench", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return make([]byte, 100), nil }))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	addr, stop := startRPC(b)
+	defer stop()
+	rpc := &rpcGetter{addr: addr}
+	defer rpc.close()
+
+	getters := []struct {
+		name   string
+		getter PeerGetter
+	}{
+		{"http", &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}},
+		{"rpc", rpc},
+	}
+	for _, g := range getters {
+		getter := g.getter
+		b.Run(g.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := getter.Get(&pb.Request{Group: "bench", Key: "key"}, &pb.Response{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(g.name+"-parallel", func(b *testing.B) {
+			b.RunParallel(func(p *testing.PB) {
+				for p.Next() {
+					if err := getter.Get(&pb.Request{Group: "bench", Key: "key"}, &pb.Response{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// TestPeerDeadline 调用者的剩余时间通过 HTTP 和 RPC 发送给远程节点的 Getter
+func TestPeerDeadline(t *testing.T) {
+	remaining := make(chan time.Duration, 1)
+	NewGroup("deadline", 2<<10, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			remaining <- 0
+		} else {
+			remaining <- time.Until(deadline)
+		}
+		return []byte(key), 0, nil
+	}))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	addr, stop := startRPC(t)
+	defer stop()
+	rpc := &rpcGetter{addr: addr}
+	defer rpc.close()
+
+	getters := []struct {
+		name   string
+		getter PeerGetterCtx
+	}{
+		{"http", &httpGetter{baseURL: srv.URL + defaultBasePath, client: http.DefaultClient}},
+		{"rpc", rpc},
+	}
+	for i, g := range getters {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		in := &pb.Request{Group: "deadline", Key: strconv.Itoa(i)}
+		if err := g.getter.GetContext(ctx, in, &pb.Response{}); err != nil {
+			t.Fatalf("%s: %v", g.name, err)
+		}
+		cancel()
+		if d := <-remaining; d <= 300*time.Millisecond || d > 500*time.Millisecond {
+			t.Fatalf("%s: expect the peer to see about 500ms left, got %v", g.name, d)
+		}
+
+		// 没有 deadline 时不限制时间
+		in = &pb.Request{Group: "deadline", Key: strconv.Itoa(i + len(getters))}
+		if err := g.getter.GetContext(context.Background(), in, &pb.Response{}); err != nil {
+			t.Fatalf("%s: %v", g.name, err)
+		}
+		if d := <-remaining; d != 0 {
+			t.Fatalf("%s: expect no deadline, got %v", g.name, d)
+		}
+	}
+}
+
+func TestRPCGetterCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	NewGroup("rpc-cancel", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		return []byte(key), nil
+	}))
+	addr, stop := startRPC(t)
+	defer stop()
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := getter.GetContext(ctx, &pb.Request{Group: "rpc-cancel", Key: "k"}, &pb.Response{})
+	var perr *PeerError
+	if !errors.Is(err, context.DeadlineExceeded) || errors.As(err, &perr) {
+		t.Fatalf("expect context.DeadlineExceeded rather than a PeerError, got %v", err)
+	}
+	if getter.conn.closed() {
+		t.Fatalf("connection should stay open after a call is canceled")
+	}
+}
+
+// flakyListener 记录 Accept 的次数，前 drop 个连接直接关闭
+type flakyListener struct {
+	net.Listener
+	accepted int32
+	drop     int32
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if n := atomic.AddInt32(&l.accepted, 1); n <= l.drop {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func startFlakyRPC(t testing.TB, drop int32, opts *RPCPoolOptions) (*flakyListener, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky := &flakyListener{Listener: lis, drop: drop}
+	go NewRPCPoolOpts(lis.Addr().String(), opts).Serve(flaky)
+	return flaky, func() { lis.Close() }
+}
+
+func TestRPCGetterSingleDial(t *testing.T) {
+	NewGroup("rpc-single-dial", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	lis, stop := startFlakyRPC(t, 0, nil)
+	defer stop()
+	getter := &rpcGetter{addr: lis.Addr().String()}
+	defer getter.close()
+
+	// 同时到达的调用共用一次 dial
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if err := getter.Get(&pb.Request{Group: "rpc-single-dial", Key: key}, &pb.Response{}); err != nil {
+				t.Error(err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&lis.accepted); n != 1 {
+		t.Fatalf("expect 1 connection, got %d", n)
+	}
+}
+
+func TestRPCGetterRetry(t *testing.T) {
+	NewGroup("rpc-retry", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	lis, stop := startFlakyRPC(t, 1, nil)
+	defer stop()
+
+	// 第一个连接被服务端关闭，重试时重新建立连接
+	getter := &rpcGetter{addr: lis.Addr().String(), peerPolicy: newPeerPolicy(2, time.Millisecond, -1, 0)}
+	defer getter.close()
+	out := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "rpc-retry", Key: "k"}, out); err != nil || string(out.Value) != "k" {
+		t.Fatalf("expect k after retry, got %q %v", out.Value, err)
+	}
+
+	// 连续失败之后熔断，不再建立连接
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+	getter = &rpcGetter{addr: dead.Addr().String(), peerPolicy: newPeerPolicy(-1, 0, 2, time.Minute)}
+	for i := 0; i < 2; i++ {
+		var perr *PeerError
+		if err := getter.Remove("rpc-retry", "k"); !errors.As(err, &perr) || !perr.Unavailable {
+			t.Fatalf("expect unavailable peer, got %v", err)
+		}
+	}
+	if err := getter.Remove("rpc-retry", "k"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+	if getter.available() {
+		t.Fatalf("peer with an open breaker should not be available")
+	}
+}
+
+func TestRPCMaxInFlight(t *testing.T) {
+	var running, peak int32
+	NewGroup("rpc-inflight", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return []byte(key), nil
+		}))
+	lis, stop := startFlakyRPC(t, 0, &RPCPoolOptions{MaxInFlight: 2})
+	defer stop()
+	getter := &rpcGetter{addr: lis.Addr().String()}
+	defer getter.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			out := &pb.Response{}
+			if err := getter.Get(&pb.Request{Group: "rpc-inflight", Key: key}, out); err != nil || string(out.Value) != key {
+				t.Errorf("expect %s, got %q %v", key, out.Value, err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	if p := atomic.LoadInt32(&peak); p > 2 {
+		t.Fatalf("expect at most 2 requests in flight, got %d", p)
+	}
+}
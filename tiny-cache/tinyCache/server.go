@@ -0,0 +1,77 @@
+package tinyCache
+
+import (
+	"context"
+	"errors"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
+)
+
+// 节点收到其他节点的请求时的处理，HTTPPool 和 RPCPool 共用
+// 写操作只修改本机的缓存，不会再转发给其他节点
+
+// serveGet 读取 group 中的值，返回值剩余的有效时间
+// ctx 在对方断开连接时被取消，对方带上了剩余的时间时加载超过这个时间之后放弃
+func serveGet(ctx context.Context, in *pb.Request) *pb.Response {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.Response{Code: pb.Code_NO_SUCH_GROUP, Error: "no such group: " + in.GetGroup()}
+	}
+	group.Stats.ServerRequests.Add(1)
+	if in.GetTimeoutMs() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(in.GetTimeoutMs())*time.Millisecond)
+		defer cancel()
+	}
+	view, err := group.get(ctx, in.GetKey())
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return &pb.Response{Code: pb.Code_NOT_FOUND, Error: err.Error()}
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return &pb.Response{Code: pb.Code_DEADLINE_EXCEEDED, Error: err.Error()}
+		}
+		return &pb.Response{Code: pb.Code_INTERNAL, Error: err.Error()}
+	}
+	res := &pb.Response{Value: view.ByteSlice()}
+	if view.missing {
+		// 不存在的结果只有被缓存时才有过期时间，此时对方可以缓存同样长的时间
+		res = &pb.Response{Code: pb.Code_NOT_FOUND, Error: view.String()}
+	}
+	if expire := view.Expire(); !expire.IsZero() {
+		// 至少 1 毫秒，0 表示永不过期
+		res.TtlMs = (expire.Sub(group.now()) + time.Millisecond - 1).Milliseconds()
+		if res.TtlMs < 1 {
+			res.TtlMs = 1
+		}
+	}
+	return res
+}
+
+func serveSet(in *pb.SetRequest) *pb.Response {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.Response{Code: pb.Code_NO_SUCH_GROUP, Error: "no such group: " + in.GetGroup()}
+	}
+	group.AddKey(in.GetKey())
+	group.setLocally(in.GetKey(), in.GetValue(), time.Duration(in.GetTtlMs())*time.Millisecond)
+	return &pb.Response{}
+}
+
+func serveRemove(in *pb.Request) *pb.Response {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.Response{Code: pb.Code_NO_SUCH_GROUP, Error: "no such group: " + in.GetGroup()}
+	}
+	group.removeLocally(in.GetKey())
+	return &pb.Response{}
+}
+
+func serveClear(in *pb.Request) *pb.Response {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return &pb.Response{Code: pb.Code_NO_SUCH_GROUP, Error: "no such group: " + in.GetGroup()}
+	}
+	group.clearLocally()
+	return &pb.Response{}
+}
@@ -1,6 +1,15 @@
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
 
 /*
 
@@ -10,13 +19,67 @@ import "sync"
 		缓存血本通常因为服务器宕机，缓存的 key 设置了相同的过期时间等引起
 缓存击穿：一个存在的 key 在缓存过期的那一刻， 同时存在大量的请求，造成 DB 压力变大
 缓存穿透：查询一个不存在的数据，因为不存在则不会写到缓存中，所以每次都会请求 DB 如果瞬间流量过大，穿透到 DB 导致宕机
+
+fn panic 或者调用 runtime.Goexit 时，所有等待的调用者同样 panic 或者退出，不会一直阻塞：
+
+	Do、DoContext   在调用者自己的 goroutine 中重新 panic 同一个值（附带 fn 的调用栈），或者调用 runtime.Goexit
+	DoChan          调用者无法 recover 另一个 goroutine 中的 panic，为了不让 panic 被悄悄吞掉，进程崩溃；
+	                runtime.Goexit 时 channel 收到 ErrGoexit
+
 */
 
+// ErrGoexit 是 fn 调用了 runtime.Goexit 时 DoChan 返回的错误
+var ErrGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// panicError 是 fn panic 时的值和 fn 的调用栈
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func newPanicError(v interface{}) error {
+	stack := debug.Stack()
+	// 第一行是 "goroutine N [status]:"，重新 panic 的时候这个 goroutine 的状态已经变了，去掉它
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &panicError{value: v, stack: stack}
+}
+
 // call 表示正在进行中，或者已经结束的请求，使用 sync waitGroup 避免重入
 type call struct {
 	wg  sync.WaitGroup
 	val interface{}
 	err error
+
+	// 以下字段 protected by Group.mu
+	done    chan struct{}      // 请求结束之后关闭，DoContext 的调用者同时等待它和自己的 ctx
+	waiters int                // 等待结果的调用者数，DoContext 的调用者提前离开时减一
+	dups    int                // 加入这个请求的调用者数，不包括发起者
+	chans   []chan<- Result    // DoChan 的调用者
+	cancel  context.CancelFunc // 取消传给 fn 的 ctx，只有 DoContext 发起的请求有
+}
+
+// result 返回请求的结果，fn panic 或者调用了 runtime.Goexit 时在当前 goroutine 中同样 panic 或者退出
+func (c *call) result() (interface{}, error) {
+	if e, ok := c.err.(*panicError); ok {
+		panic(e)
+	}
+	if c.err == ErrGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err
+}
+
+// Result 是 DoChan 返回的结果
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // 结果是否同时返回给了其他调用者
 }
 
 // Group 是防止缓存击穿的主要数据结构，管理不同的 key 的请求 call
@@ -25,31 +88,193 @@ type Group struct {
 	m  map[string]*call // lazily initialized
 }
 
+// join 返回 key 正在进行的请求，没有时返回 nil，must hold g.mu
+func (g *Group) join(key string) *call {
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if !ok {
+		return nil
+	}
+	c.dups++
+	c.waiters++
+	return c
+}
+
+// start 为 key 创建一个新的请求，must hold g.mu
+func (g *Group) start(key string) *call {
+	c := &call{done: make(chan struct{}), waiters: 1}
+	c.wg.Add(1)  // 发起请求之前加锁
+	g.m[key] = c // 添加 g.m 表明 key 已经有对应的 请求在处理
+	return c
+}
+
 // Do 接收两个参数
 // 第一个参数是 key 第二个参数是 fn
 // do 的作用是 针对相同的 key 无论 Do 调用多少次，fn 函数都只会被调用一次
 // 等待 fn 的调用结束了，返回返回值或者是错误
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
-	if g.m == nil {
-		g.m = make(map[string]*call)
+	if c := g.join(key); c != nil { // Do 的调用者不会提前离开，所以请求不会被取消
+		g.mu.Unlock()
+		c.wg.Wait()       // 如果请求正在进行中，则等待
+		return c.result() // 请求结束，返回结果
 	}
-	if c, ok := g.m[key]; ok {
+	c := g.start(key)
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn, true)
+	return c.val, c.err // 返回结果
+}
+
+// DoChan 和 Do 相同，但是不阻塞，结果在请求结束之后发送到返回的 channel 中
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if c := g.join(key); c != nil {
+		c.chans = append(c.chans, ch)
 		g.mu.Unlock()
-		c.wg.Wait()         // 如果请求正在进行中，则等待
-		return c.val, c.err // 请求结束，返回结果
+		return ch
 	}
-	c := new(call)
-	c.wg.Add(1)  // 发起请求之前加锁
-	g.m[key] = c // 添加 g.m 表明 key 已经有对应的 请求在处理
+	c := g.start(key)
+	c.chans = append(c.chans, ch)
 	g.mu.Unlock()
 
-	c.val, c.err = fn() // 调用 fn 发起请求
-	c.wg.Done()         // 请求结束
+	go g.doCall(c, key, fn, false)
+	return ch
+}
 
+// DoContext 和 Do 相同，但是调用者在 ctx 结束时不再等待，直接返回 ctx.Err()，其余调用者继续等待同一个请求
+//
+// 发起请求的调用者同样可以离开，所以 fn 在单独的 goroutine 中执行，它的 ctx 保留发起者的 value 和 deadline，
+// 但是不会因为发起者被取消而取消，只有所有调用者都离开之后才会被取消，此时 key 被删除，下一次调用重新发起请求
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
-	delete(g.m, key) // 更新 g.m
+	c := g.join(key)
+	if c == nil {
+		var fctx context.Context
+		c = g.start(key)
+		fctx, c.cancel = detach(ctx)
+		go g.doCall(c, key, func() (interface{}, error) { return fn(fctx) }, false)
+	}
 	g.mu.Unlock()
 
-	return c.val, c.err // 返回结果
+	select {
+	case <-c.done:
+		return c.result()
+	case <-ctx.Done():
+		g.leave(c, key)
+		return nil, ctx.Err()
+	}
+}
+
+// doCall 调用 fn 并唤醒所有等待的调用者，owner 表示 doCall 在 Do 的调用者的 goroutine 中执行
+// 使用两层 defer 区分 fn panic 和调用 runtime.Goexit：panic 被内层 recover，Goexit 无法被 recover
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error), owner bool) {
+	normalReturn := false
+	recovered := false
+
+	defer func() {
+		if !normalReturn && !recovered {
+			c.err = ErrGoexit
+		}
+
+		g.mu.Lock()
+		if g.m[key] == c { // 所有调用者都离开或者 Forget 之后 key 可能已经有新的请求
+			delete(g.m, key) // 更新 g.m
+		}
+		waiters, chans := c.waiters, c.chans
+		res := Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+		g.mu.Unlock()
+
+		close(c.done)
+		c.wg.Done() // 请求结束
+		if c.cancel != nil {
+			c.cancel()
+		}
+
+		if e, ok := c.err.(*panicError); ok {
+			if len(chans) > 0 {
+				// DoChan 的调用者无法 recover，让进程崩溃，select 让这个 goroutine 出现在崩溃的调用栈中
+				go panic(e)
+				select {}
+			}
+			// Do 的发起者在自己的 goroutine 中 panic，其余调用者在 result 中 panic
+			// DoContext 的调用者都已经离开时没有人会 panic，在这里 panic 避免吞掉它
+			if owner || waiters == 0 {
+				panic(e)
+			}
+			return
+		}
+		for _, ch := range chans {
+			ch <- res
+		}
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = newPanicError(r)
+				}
+			}
+		}()
+		c.val, c.err = fn() // 调用 fn 发起请求
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// leave 在 DoContext 的调用者提前离开时调用，最后一个调用者离开时取消请求
+func (g *Group) leave(c *call, key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 || c.cancel == nil {
+		return
+	}
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	c.cancel()
+}
+
+// Forget 让 Group 忘记 key 正在进行的请求，之后的调用发起新的请求，而不是等待这个请求
+// 已经在等待的调用者仍然得到这个请求的结果，通常在知道结果已经过时（例如 key 被修改）时调用
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
+
+// Dups 返回加入 key 正在进行的请求的调用者数，不包括发起者，没有正在进行的请求时返回 0
+func (g *Group) Dups(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.m[key]; ok {
+		return c.dups
+	}
+	return 0
+}
+
+// detachedContext 保留 parent 的 value，但是没有 deadline，也不会被取消
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// detach 返回一个不会因为 ctx 被取消而取消的 context，它保留 ctx 的 value 和 deadline
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detachedContext{ctx}, deadline)
+	}
+	return context.WithCancel(detachedContext{ctx})
 }
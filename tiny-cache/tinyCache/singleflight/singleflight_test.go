@@ -1,7 +1,17 @@
 package singleflight
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
@@ -14,3 +24,292 @@ func TestDo(t *testing.T) {
 		t.Errorf("Do v = %v, error = %v", v, err)
 	}
 }
+
+type ctxKey struct{}
+
+// TestDoContextLeave 发起请求的调用者离开之后，请求继续为其余的调用者进行
+func TestDoContextLeave(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return ctx.Value(ctxKey{}), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "bar"))
+	first := make(chan error)
+	go func() {
+		_, err := g.DoContext(ctx, "key", fn)
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	second := make(chan interface{})
+	go func() {
+		v, _ := g.DoContext(context.Background(), "key", fn)
+		second <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("expect context.Canceled for the caller who left, got %v", err)
+	}
+	close(release)
+	if v := <-second; v != "bar" {
+		t.Fatalf("expect the load to continue with the first caller's values, got %v", v)
+	}
+}
+
+// TestDoContextAllLeave 所有调用者都离开之后请求被取消，下一次调用重新发起请求
+func TestDoContextAllLeave(t *testing.T) {
+	var g Group
+	canceled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("load should be canceled after all callers left")
+	}
+
+	v, err := g.DoContext(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("expect a new load, got %v %v", v, err)
+	}
+}
+
+// TestDoContextJoinDo DoContext 的调用者可以加入 Do 发起的请求
+func TestDoContextJoinDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	done := make(chan interface{})
+	go func() {
+		v, _ := g.Do("key", func() (interface{}, error) {
+			<-release
+			return "bar", nil
+		})
+		done <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.DoContext(ctx, "key", nil); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	close(release)
+	if v := <-done; v != "bar" {
+		t.Fatalf("Do should not be affected by DoContext callers leaving, got %v", v)
+	}
+}
+
+// TestDoDupSuppress 并发的调用者只调用一次 fn，都得到同一个结果
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := g.Do("key", fn); v != "bar" || err != nil {
+				t.Errorf("Do v = %v, error = %v", v, err)
+			}
+		}()
+	}
+	for start := time.Now(); g.Dups("key") < n-1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expect %d duplicate callers, got %d", n-1, g.Dups("key"))
+		}
+	}
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expect fn to be called once, got %d", got)
+	}
+	if g.Dups("key") != 0 {
+		t.Fatalf("expect no duplicates after the call finished, got %d", g.Dups("key"))
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	ch1 := g.DoChan("key", fn)
+	ch2 := g.DoChan("key", fn)
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		res := <-ch
+		if res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("expect a shared bar, got %+v", res)
+		}
+	}
+
+	res := <-g.DoChan("key", func() (interface{}, error) { return nil, errors.New("oops") })
+	if res.Err == nil || res.Err.Error() != "oops" || res.Shared {
+		t.Fatalf("expect an error that is not shared, got %+v", res)
+	}
+}
+
+// TestForget Forget 之后的调用发起新的请求，已经在等待的调用者得到原来的结果
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	joined := g.DoChan("key", func() (interface{}, error) { return 0, nil })
+
+	g.Forget("key")
+	second := g.DoChan("key", func() (interface{}, error) { return 2, nil })
+	if res := <-second; res.Val != 2 || res.Shared {
+		t.Fatalf("expect a new call after Forget, got %+v", res)
+	}
+
+	// 原来的请求结束时不会删除新的请求
+	third := make(chan struct{})
+	g.DoChan("key", func() (interface{}, error) {
+		<-third
+		return 3, nil
+	})
+	close(release)
+	if res := <-first; res.Val != 1 || !res.Shared {
+		t.Fatalf("expect 1, got %+v", res)
+	}
+	if res := <-joined; res.Val != 1 {
+		t.Fatalf("caller joined before Forget should get 1, got %+v", res)
+	}
+	fourth := g.DoChan("key", func() (interface{}, error) { return 4, nil })
+	close(third)
+	if res := <-fourth; res.Val != 3 || !res.Shared {
+		t.Fatalf("expect to join the call started after Forget, got %+v", res)
+	}
+}
+
+// TestDoPanic fn panic 时所有 Do 和 DoContext 的调用者都 panic，而不是一直等待
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	recovered := make(chan interface{}, 3)
+	call := func(do func()) {
+		defer func() { recovered <- recover() }()
+		do()
+	}
+	go call(func() { g.Do("key", fn) })
+	go call(func() { g.Do("key", fn) })
+	go call(func() {
+		g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) { return fn() })
+	})
+	for start := time.Now(); g.Dups("key") < 2; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expect 2 duplicate callers, got %d", g.Dups("key"))
+		}
+	}
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-recovered:
+			perr, ok := r.(*panicError)
+			if !ok || perr.value != "boom" || !strings.Contains(string(perr.stack), "TestDoPanic") {
+				t.Fatalf("expect the panic value with the stack of fn, got %v", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callers should not block after fn panicked")
+		}
+	}
+
+	// panic 之后 key 被删除，下一次调用正常进行
+	if v, err := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do v = %v, error = %v", v, err)
+	}
+}
+
+// TestDoGoexit fn 调用 runtime.Goexit 时 Do 的调用者同样退出，DoChan 收到 ErrGoexit
+func TestDoGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	}
+
+	exited := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			normal := false
+			defer func() { exited <- normal }()
+			g.Do("key", fn)
+			normal = true
+		}()
+	}
+	for start := time.Now(); g.Dups("key") < 1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expect a duplicate caller")
+		}
+	}
+	ch := g.DoChan("key", fn)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if normal := <-exited; normal {
+			t.Fatalf("Do should not return after fn called runtime.Goexit")
+		}
+	}
+	if res := <-ch; res.Err != ErrGoexit {
+		t.Fatalf("expect ErrGoexit, got %+v", res)
+	}
+}
+
+// TestDoChanPanic DoChan 的调用者无法 recover，fn panic 时进程崩溃并且输出 panic 的值
+func TestDoChanPanic(t *testing.T) {
+	if os.Getenv("TEST_DOCHAN_PANIC") != "" {
+		var g Group
+		<-g.DoChan("key", func() (interface{}, error) { panic("boom") })
+		t.Fatalf("DoChan should not return after fn panicked")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDoChanPanic$")
+	cmd.Env = append(os.Environ(), "TEST_DOCHAN_PANIC=1")
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := cmd.Run()
+	if err == nil {
+		t.Fatalf("expect the process to crash, got output:\n%s", out.String())
+	}
+	if !bytes.Contains(out.Bytes(), []byte("panic: boom")) {
+		t.Fatalf("expect the panic value in the output, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,75 @@
+package tinyCache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt
+	Loads          AtomicInt // (gets - cacheHits)
+	LoadsDeduped   AtomicInt // after singleflight
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	ServerRequests AtomicInt // gets that came over the network from peers
+	NegativeHits   AtomicInt // cache hits on keys known not to exist
+
+	BloomRejects        AtomicInt // gets rejected by the bloom filter without a load
+	BloomFalsePositives AtomicInt // keys passed by the bloom filter but not found by the Getter
+}
+
+// CacheType represents a type of cache.
+type CacheType int
+
+const (
+	// MainCache is the cache for items that this peer is the
+	// owner for.
+	MainCache CacheType = iota + 1
+
+	// HotCache is the cache for items that seem popular
+	// enough to replicate to this node, even though it's not the
+	// owner.
+	HotCache
+)
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes       int64
+	Items       int64
+	Gets        int64
+	Hits        int64
+	Evictions   int64 // 为了腾出空间淘汰的值，不包括过期的值以及 Remove 和 Clear 删除的值
+	Expirations int64 // 过期之后在访问时或者被 janitor 删除的值
+}
+
+// BloomStats are returned by Group.BloomStats.
+type BloomStats struct {
+	Keys              uint64  // 添加到当前过滤器的 key 的数量
+	Bits              uint64  // 位图的大小
+	Hashes            uint64  // 哈希函数的个数
+	FalsePositiveRate float64 // 根据位图中 1 的比例估计的误判率
+	Rebuilds          int64
+	LastRebuild       time.Time
+}
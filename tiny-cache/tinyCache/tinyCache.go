@@ -1,9 +1,14 @@
 package tinyCache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
+	pb "tiny-cache/tinyCache/cachepb"
 	"tiny-cache/tinyCache/singleflight"
 )
 
@@ -12,9 +17,26 @@ import (
 type Group struct {
 	name      string // 一个 group 可以认为是一个缓存的命名空间，每个 group 都拥有一个唯一的名称 name
 	getter    Getter // 缓存没有命中的时候获取源数据的 callback
-	mainCache cache  // 实现的并发缓存（lru + lock）
+	mainCache cache  // 实现的并发缓存（淘汰策略 + lock）
+	hotCache  cache  // 采样保存从远程节点获取的热点数据，避免每一次都访问网络
 	peers     PeerPicker
 	loader    *singleflight.Group // 保证每一个 key 都只会 fetch 一次
+
+	// Stats are statistics on the group.
+	Stats Stats
+
+	ttl              time.Duration    // 默认的过期时间，0 表示永不过期
+	ttlJitter        time.Duration    // 过期时间的随机抖动
+	janitorInterval  time.Duration    // 后台清理过期值的间隔，0 表示不启动 janitor
+	now              func() time.Time // 时钟，默认是 time.Now
+	stop             chan struct{}    // 关闭之后 janitor 退出
+	broadcast        bool             // 写操作之后是否通知所有节点删除自己的副本
+	hotSampleRate    float64          // 从远程节点获取的值放入 hotCache 的比例
+	replicas         int              // 每一个 key 所在的节点数，主节点失败时依次尝试副本节点
+	replicatedWrites bool             // 写操作是否发送给所有副本节点
+	negativeTTL      time.Duration    // 不存在的结果的过期时间，0 表示不缓存
+	bloom            *bloomGuard      // 过滤一定不存在的 key，nil 表示不使用
+	closeOnce        sync.Once
 }
 
 // A Getter loads data for a key.
@@ -30,6 +52,70 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// A GetterWithTTL loads data for a key together with how long it stays valid.
+// 返回的 ttl 为 0 时使用 group 默认的过期时间
+type GetterWithTTL interface {
+	Getter
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// A GetterWithTTLFunc implements GetterWithTTL with a function.
+type GetterWithTTLFunc func(key string) ([]byte, time.Duration, error)
+
+// Get implements Getter interface function
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// GetWithTTL implements GetterWithTTL interface function
+func (f GetterWithTTLFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// A GetterCtx loads data for a key and gives up when ctx is done.
+// Getter 同时实现了这个接口时 Group 使用它，ctx 在所有等待这个 key 的调用者都离开之后被取消，
+// 它的 deadline 是第一个调用者的 deadline。返回的 ttl 为 0 时使用 group 默认的过期时间
+type GetterCtx interface {
+	GetContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// A GetterCtxFunc implements Getter, GetterWithTTL and GetterCtx with a function.
+type GetterCtxFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+// Get implements Getter interface function
+func (f GetterCtxFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(context.Background(), key)
+	return b, err
+}
+
+// GetWithTTL implements GetterWithTTL interface function
+func (f GetterCtxFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(context.Background(), key)
+}
+
+// GetContext implements GetterCtx interface function
+func (f GetterCtxFunc) GetContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// ErrNotFound 由 Getter 返回，表示 key 在数据源中不存在，可以使用 fmt.Errorf 的 %w 包装
+// 开启了 WithNegativeTTL 时这个结果会被缓存，重复查询不存在的 key 不会每一次都访问数据源（缓存穿透）
+var ErrNotFound = errors.New("tinyCache: not found")
+
+// notFoundError 是从负缓存或者远程节点得到的不存在的结果，保留了 Getter 原来的错误信息
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
 // 函数类型实现一个接口，就叫做接口型函数
 // 方便使用者在调用的时候，既可以传入函数作为参数，也能够传入实现了这个接口的结构体作为参数
 
@@ -39,17 +125,36 @@ var (
 )
 
 // NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:          name,
+		getter:        getter,
+		mainCache:     cache{cacheBytes: cacheBytes},
+		hotCache:      cache{cacheBytes: cacheBytes / 8},
+		loader:        &singleflight.Group{},
+		now:           time.Now,
+		stop:          make(chan struct{}),
+		hotSampleRate: defaultHotSampleRate,
+		replicas:      1,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.mainCache.now = g.now
+	g.hotCache.now = g.now
+	if g.hotCache.newPolicy == nil {
+		g.hotCache.newPolicy = g.mainCache.newPolicy
+	}
+	if g.janitorInterval > 0 {
+		go g.janitor()
+	}
+	if g.bloom != nil && g.bloom.opts.Keys != nil {
+		go g.bloomRebuilder()
 	}
 	groups[name] = g
 	return g
@@ -65,17 +170,56 @@ func GetGroup(name string) *Group {
 }
 
 // Get value for a key from cache
+// key 在数据源中不存在时返回的错误满足 errors.Is(err, ErrNotFound)
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 相同，ctx 结束时返回 ctx.Err()
+// ctx 的剩余时间会发送给远程节点，同一个 key 的其余调用者继续等待同一次加载，所有调用者都离开之后加载被取消
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	v, err := g.get(ctx, key)
+	if err == nil && v.missing {
+		return ByteView{}, &notFoundError{msg: v.String()}
+	}
+	return v, err
+}
+
+// get 和 GetContext 相同，但是不存在的结果作为 missing 的 ByteView 返回，它的值是错误信息
+func (g *Group) get(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	if err := ctx.Err(); err != nil {
+		return ByteView{}, err
+	}
 
-	if v, ok := g.mainCache.get(key); ok {
+	g.Stats.Gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
 		log.Println("[kooCache] hit")
+		g.Stats.CacheHits.Add(1)
+		if v.missing {
+			g.Stats.NegativeHits.Add(1)
+		}
 		return v, nil
 	}
 
-	return g.load(key)
+	if g.bloom != nil && !g.bloom.mightContain(key) {
+		g.Stats.BloomRejects.Add(1)
+		return ByteView{b: []byte(key + " rejected by bloom filter: " + ErrNotFound.Error()), missing: true}, nil
+	}
+	return g.load(ctx, key)
+}
+
+// lookupCache 依次查找 mainCache 和 hotCache
+func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
+	if value, ok = g.mainCache.get(key); ok {
+		return
+	}
+	if g.hotCache.cacheBytes <= 0 {
+		return
+	}
+	return g.hotCache.get(key)
 }
 
 // RegisterPeers 将 实现了 PeerPicker 接口的 HTTPPool 注入到 Group 中。
@@ -87,21 +231,16 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 // load 使用 PickPeer() 方法选择节点，若非本机节点，则调用 getFromPeer() 从远程获取。若是本机节点或失败，则回退到 getLocally()。
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				}
-				log.Println("[Cache] Failed to get from peer", err)
-			}
-		}
-
-		return g.getLocally(key)
-	})
+	g.Stats.Loads.Add(1)
+	viewi, err := g.loader.DoContext(ctx, key, g.loadFunc(key))
+	if deadline, ok := ctx.Deadline(); errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil && (!ok || time.Now().Before(deadline)) {
+		// 加入的加载使用第一个调用者的 deadline，它超时的时候本调用者还有时间，使用自己的 deadline 重新加载一次
+		// 加载和第一个调用者的 deadline 相同但是定时器不同，加载可能先超时，所以比较 deadline 而不是只看 ctx.Err()
+		viewi, err = g.loader.DoContext(ctx, key, g.loadFunc(key))
+	}
 
 	if err == nil {
 		return viewi.(ByteView), nil
@@ -109,25 +248,320 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
+// loadFunc 返回 singleflight 中加载 key 的函数，依次查找缓存、远程节点和本地数据源
+func (g *Group) loadFunc(key string) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		// 等待 singleflight 的时候，之前的调用可能已经填充了缓存
+		if value, ok := g.lookupCache(key); ok {
+			g.Stats.CacheHits.Add(1)
+			if value.missing {
+				g.Stats.NegativeHits.Add(1)
+			}
+			return value, nil
+		}
+		g.Stats.LoadsDeduped.Add(1)
+		if value, ok := g.loadFromPeers(ctx, key); ok {
+			return value, nil
+		}
+		if err := ctx.Err(); err != nil { // 加载被取消或者超时时不再回退到本地加载
+			return nil, err
+		}
+
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+			return nil, err
+		}
+		g.Stats.LocalLoads.Add(1)
+		return value, nil
+	}
+}
+
+// loadFromPeers 从 key 所在的远程节点获取值，开启了 WithReplicas 时主节点失败之后依次尝试副本节点
+// 轮到本机或者所有节点都失败时 ok 为 false，由调用者从本地加载
+// 本机是 key 的副本节点时，获取到的值放入 mainCache，主节点重启时本机的副本仍然是热的
+func (g *Group) loadFromPeers(ctx context.Context, key string) (value ByteView, ok bool) {
+	peers := g.pickReplicas(key, g.replicas)
+	replica := false
+	for _, peer := range peers {
+		if peer == nil {
+			replica = true
+		}
+	}
+	for _, peer := range peers {
+		if peer == nil {
+			return ByteView{}, false
+		}
+		value, err := g.getFromPeer(ctx, peer, key, replica)
+		if err == nil {
+			g.Stats.PeerLoads.Add(1)
+			return value, true
+		}
+		g.Stats.PeerErrors.Add(1)
+		log.Println("[Cache] Failed to get from peer", err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return ByteView{}, false
+}
+
+// pickReplicas 按照顺序返回 key 所在的 n 个节点，本机用 nil 表示
+// PeerPicker 没有实现 ReplicaPicker 时只返回 PickPeer 选择的节点，key 在本机时返回空
+func (g *Group) pickReplicas(key string, n int) []PeerGetter {
+	if g.peers == nil {
+		return nil
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok && n > 1 {
+		return rp.PickReplicas(key, n)
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return nil
+}
+
+// Set 写入一个缓存值，ttl 为 0 时使用 group 默认的过期时间
+// 注册了节点时写入 key 所在的节点，开启了 WithReplicatedWrites 时写入所有副本节点，本机不是这些节点时本机的副本会被删除
+// 使用了 WithBloomFilter 时 key 同时被添加到本机和写入的节点的布隆过滤器
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.AddKey(key)
+	owners, local := g.pickWriters(key)
+	if !local {
+		g.removeLocally(key)
+	}
+	for _, owner := range owners {
+		if err := owner.Set(g.name, key, value, ttl); err != nil {
+			return err
+		}
+	}
+	if local {
+		g.setLocally(key, value, ttl)
+	}
+	return g.broadcastRemove(key, owners)
+}
+
+// Remove 删除一个缓存值，注册了节点时同时删除 key 所在节点（开启了 WithReplicatedWrites 时是所有副本节点）上的值
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	owners, _ := g.pickWriters(key)
+	for _, owner := range owners {
+		if err := owner.Remove(g.name, key); err != nil {
+			return err
+		}
+	}
+	return g.broadcastRemove(key, owners)
+}
+
+// Clear 清空本机以及所有节点上这个 group 的缓存
+func (g *Group) Clear() error {
+	g.clearLocally()
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range lister.ListPeers() {
+		if w, ok := peer.(PeerWriter); ok {
+			if err := w.Clear(g.name); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// pickWriters 返回需要写入的远程节点，local 表示本机也需要写入
+// key 在本机或者节点不支持写入时 local 为 true
+func (g *Group) pickWriters(key string) (owners []PeerWriter, local bool) {
+	n := 1
+	if g.replicatedWrites {
+		n = g.replicas
+	}
+	peers := g.pickReplicas(key, n)
+	if len(peers) == 0 {
+		return nil, true
+	}
+	for _, peer := range peers {
+		if w, ok := peer.(PeerWriter); ok {
+			owners = append(owners, w)
+		} else {
+			local = true
+		}
+	}
+	return owners, local
+}
+
+// broadcastRemove 开启了 WithBroadcast 时，通知除了 owners 之外的所有节点删除 key 的副本
+func (g *Group) broadcastRemove(key string, owners []PeerWriter) error {
+	if !g.broadcast {
+		return nil
+	}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var firstErr error
+	for _, peer := range lister.ListPeers() {
+		w, ok := peer.(PeerWriter)
+		if !ok || containsWriter(owners, w) {
+			continue
+		}
+		if err := w.Remove(g.name, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func containsWriter(writers []PeerWriter, w PeerWriter) bool {
+	for _, writer := range writers {
+		if writer == w {
+			return true
+		}
+	}
+	return false
+}
+
+// setLocally, removeLocally 和 clearLocally 只修改本机的缓存，用于处理其他节点发来的请求
+// setLocally 和 removeLocally 让 singleflight 忘记 key 正在进行的加载，之后的 Get 不会等到写之前的旧值
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) {
+	g.loader.Forget(key)
+	g.populateCache(key, ByteView{b: cloneBytes(value), e: g.expireAt(ttl)})
+}
+
+func (g *Group) removeLocally(key string) {
+	g.loader.Forget(key)
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) clearLocally() {
+	g.mainCache.clear()
+	g.hotCache.clear()
+}
+
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	if getter, ok := g.getter.(GetterCtx); ok {
+		bytes, ttl, err = getter.GetContext(ctx, key)
+	} else if getter, ok := g.getter.(GetterWithTTL); ok {
+		bytes, ttl, err = getter.GetWithTTL(key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		if errors.Is(err, ErrNotFound) && g.bloom != nil && g.bloom.active() {
+			g.Stats.BloomFalsePositives.Add(1)
+		}
+		if errors.Is(err, ErrNotFound) && g.negativeTTL > 0 {
+			value := ByteView{b: []byte(err.Error()), e: g.expireAt(g.negativeTTL), missing: true}
+			g.populateCache(key, value)
+			return value, nil
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	value := ByteView{b: cloneBytes(bytes), e: g.expireAt(ttl)}
 	g.populateCache(key, value)
 	return value, nil
 }
 
+// expireAt 计算过期时间，ttl 为 0 时使用 group 默认的过期时间，并且加上随机抖动
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if g.ttlJitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(g.ttlJitter)))
+	}
+	return g.now().Add(ttl)
+}
+
+// janitor 定期删除过期的缓存值，直到 group 被关闭
+func (g *Group) janitor() {
+	ticker := time.NewTicker(g.janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mainCache.removeExpired()
+			g.hotCache.removeExpired()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// Close 停止 group 的后台 goroutine
+func (g *Group) Close() {
+	g.closeOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
 // getFromPeer 使用实现了 PeerGetter 接口的 httpGetter 从访问远程节点，获取缓存值。
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
-	if err != nil {
+// 本机是 key 的副本节点时把获取到的值放入 mainCache，否则按照 hotSampleRate 的比例放入 hotCache
+// 远程节点实现了 PeerGetterCtx 时 ctx 的剩余时间会发送给它
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string, replica bool) (ByteView, error) {
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	res := &pb.Response{}
+	var value ByteView
+	var err error
+	if p, ok := peer.(PeerGetterCtx); ok {
+		err = p.GetContext(ctx, req, res)
+	} else {
+		err = peer.Get(req, res)
+	}
+	var perr *PeerError
+	if errors.As(err, &perr) && perr.Code == pb.Code_NOT_FOUND {
+		// 不存在是确定的结果，不再回退到本地加载，远程节点允许缓存并且开启了 WithNegativeTTL 时缓存这个结果
+		value = ByteView{b: []byte(res.GetError()), missing: true}
+		if res.GetTtlMs() <= 0 || g.negativeTTL <= 0 {
+			return value, nil
+		}
+		value.e = g.now().Add(time.Duration(res.GetTtlMs()) * time.Millisecond)
+	} else if err != nil {
 		return ByteView{}, err
+	} else {
+		ttl := time.Duration(res.GetTtlMs()) * time.Millisecond
+		value = ByteView{b: res.GetValue(), e: g.expireAt(ttl)}
+	}
+	if replica {
+		g.populateCache(key, value)
+	} else if g.hotCache.cacheBytes > 0 && rand.Float64() < g.hotSampleRate {
+		g.hotCache.add(key, value)
+	}
+	return value, nil
+}
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
 	}
-	return ByteView{b: bytes}, nil
 }
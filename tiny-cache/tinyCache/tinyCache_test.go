@@ -1,10 +1,15 @@
 package tinyCache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 // fake database
@@ -68,3 +73,369 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	loads := 0
+	g := NewGroup("ttl", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), time.Second, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(time.Minute), WithClock(clock))
+	defer g.Close()
+
+	for _, key := range []string{"short", "default"} {
+		if _, err := g.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, _ := g.Get("short"); v.Expire() != now.Add(time.Second) {
+		t.Fatalf("expect short to expire at %v, got %v", now.Add(time.Second), v.Expire())
+	}
+	if loads != 2 {
+		t.Fatalf("expect 2 loads, got %d", loads)
+	}
+
+	now = now.Add(time.Second)
+	g.Get("short")
+	g.Get("default")
+	if loads != 3 {
+		t.Fatalf("expired short should be reloaded, got %d loads", loads)
+	}
+
+	now = now.Add(time.Minute)
+	if n := g.mainCache.removeExpired(); n != 2 {
+		t.Fatalf("expect 2 expired entries, got %d", n)
+	}
+	// 过期和为了腾出空间的淘汰分开统计
+	if stats := g.CacheStats(MainCache); stats.Expirations != 3 || stats.Evictions != 0 {
+		t.Fatalf("expect 3 expirations and 0 evictions, got %d and %d", stats.Expirations, stats.Evictions)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	now := time.Unix(0, 0)
+	g := NewGroup("jitter", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithTTL(time.Minute), WithTTLJitter(time.Second), WithClock(func() time.Time { return now }))
+	defer g.Close()
+
+	for i := 0; i < 100; i++ {
+		v, _ := g.Get(strconv.Itoa(i))
+		if ttl := v.Expire().Sub(now); ttl < time.Minute || ttl >= time.Minute+time.Second {
+			t.Fatalf("ttl %v out of range [1m, 1m1s)", ttl)
+		}
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	g := NewGroup("janitor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }),
+		WithTTL(time.Millisecond), WithJanitor(time.Millisecond))
+	defer g.Close()
+
+	g.Get("key")
+	time.Sleep(50 * time.Millisecond)
+	g.mainCache.mu.Lock()
+	n := g.mainCache.policy.Len()
+	g.mainCache.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("janitor should remove expired entries, %d left", n)
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	factories := map[string]PolicyFactory{"lru": LRU, "lfu": LFU, "twoq": TwoQueue, "arc": ARC, "tinylfu": TinyLFU}
+	for name, factory := range factories {
+		loads := 0
+		g := NewGroup("policy-"+name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads++
+				return []byte(key), nil
+			}), WithPolicy(factory))
+		for i := 0; i < 2; i++ {
+			if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" {
+				t.Fatalf("%s: failed to get Tom", name)
+			}
+		}
+		if loads != 1 {
+			t.Fatalf("%s: expect 1 load, got %d", name, loads)
+		}
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	var ops []string
+	peer := &fakePeer{"p1", &ops}
+	g := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) { return []byte("local"), nil }), WithHotCache(1<<10, 1))
+	g.RegisterPeers(&fakePicker{peers: []PeerGetter{peer}})
+
+	for i := 0; i < 3; i++ {
+		if v, err := g.Get("remote-key"); err != nil || v.String() != "p1" {
+			t.Fatalf("expect value from p1, got %s %v", v, err)
+		}
+	}
+	g.Get("local-key")
+
+	if n := g.Stats.PeerLoads.Get(); n != 1 {
+		t.Fatalf("hot key should be fetched from peer once, got %d", n)
+	}
+	if hot := g.CacheStats(HotCache); hot.Items != 1 || hot.Hits != 2 {
+		t.Fatalf("unexpected hot cache stats %+v", hot)
+	}
+	if main := g.CacheStats(MainCache); main.Items != 1 || main.Bytes != int64(len("local-key")+len("local")) {
+		t.Fatalf("unexpected main cache stats %+v", main)
+	}
+	if g.Stats.Gets.Get() != 4 || g.Stats.CacheHits.Get() != 2 || g.Stats.LocalLoads.Get() != 1 {
+		t.Fatalf("unexpected group stats gets=%v hits=%v localLoads=%v",
+			&g.Stats.Gets, &g.Stats.CacheHits, &g.Stats.LocalLoads)
+	}
+
+	g.Remove("remote-key")
+	if hot := g.CacheStats(HotCache); hot.Items != 0 || hot.Evictions != 0 {
+		t.Fatalf("Remove should clear the hot copy without counting an eviction, got %+v", hot)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+	})
+
+	g := NewGroup("negative", 2<<10, getter, WithNegativeTTL(time.Second), WithClock(func() time.Time { return now }))
+	for i := 0; i < 3; i++ {
+		_, err := g.Get("kkk")
+		if !errors.Is(err, ErrNotFound) || err.Error() != "kkk not exist: tinyCache: not found" {
+			t.Fatalf("expect ErrNotFound with the getter's message, got %v", err)
+		}
+	}
+	if loads != 1 || g.Stats.NegativeHits.Get() != 2 {
+		t.Fatalf("expect 1 load and 2 negative hits, got %d and %d", loads, g.Stats.NegativeHits.Get())
+	}
+
+	now = now.Add(time.Second)
+	if _, err := g.Get("kkk"); !errors.Is(err, ErrNotFound) || loads != 2 {
+		t.Fatalf("expired negative result should be loaded again, got %d loads", loads)
+	}
+
+	// 没有 WithNegativeTTL 时不缓存，其他错误也不会被缓存
+	loads = 0
+	g = NewGroup("negative-off", 2<<10, getter)
+	g.Get("kkk")
+	g.Get("kkk")
+	if loads != 2 {
+		t.Fatalf("expect 2 loads without negative caching, got %d", loads)
+	}
+	loads = 0
+	g = NewGroup("negative-other", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return nil, fmt.Errorf("db is down")
+	}), WithNegativeTTL(time.Second))
+	g.Get("kkk")
+	if _, err := g.Get("kkk"); errors.Is(err, ErrNotFound) || loads != 2 {
+		t.Fatalf("other errors should not be cached, got %v after %d loads", err, loads)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		source  = map[string]string{"Tom": "630", "Jack": "589"}
+		loads   AtomicInt
+		scanErr error
+	)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		if v, ok := source[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+	})
+	keys := KeyEnumeratorFunc(func(add func(key string)) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for k := range source {
+			add(k)
+		}
+		return scanErr
+	})
+	g := NewGroup("bloom", 2<<10, getter, WithBloomFilter(BloomOptions{Keys: keys, ExpectedKeys: 100}))
+	defer g.Close()
+	if err := g.RebuildBloomFilter(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("expect 630, got %q %v", v.String(), err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := g.Get("random" + strconv.Itoa(i)); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if n := g.Stats.BloomRejects.Get(); n < 95 || loads.Get()+n != 101 {
+		t.Fatalf("absent keys should be rejected without loading, %d rejects and %d loads", n, loads.Get())
+	}
+	if n := g.Stats.BloomFalsePositives.Get(); n != loads.Get()-1 {
+		t.Fatalf("expect %d false positives, got %d", loads.Get()-1, n)
+	}
+
+	// 增量添加的 key 可以被加载，重建之后数据源中删除的 key 被拒绝
+	mu.Lock()
+	source["Sam"] = "567"
+	delete(source, "Jack")
+	mu.Unlock()
+	g.AddKey("Sam")
+	if v, err := g.Get("Sam"); err != nil || v.String() != "567" {
+		t.Fatalf("expect 567, got %q %v", v.String(), err)
+	}
+	if err := g.RebuildBloomFilter(); err != nil {
+		t.Fatal(err)
+	}
+	rejects := g.Stats.BloomRejects.Get()
+	if _, err := g.Get("Jack"); !errors.Is(err, ErrNotFound) || g.Stats.BloomRejects.Get() != rejects+1 {
+		t.Fatalf("deleted key should be rejected after rebuild, got %v", err)
+	}
+
+	// 重建失败时继续使用原来的过滤器
+	mu.Lock()
+	scanErr = errors.New("db is down")
+	mu.Unlock()
+	if err := g.RebuildBloomFilter(); err == nil {
+		t.Fatalf("expect error from the enumerator")
+	}
+	s := g.BloomStats()
+	if s.Keys != 2 || s.Rebuilds < 2 || s.Bits == 0 || s.Hashes == 0 || s.FalsePositiveRate <= 0 || s.FalsePositiveRate > 0.01 {
+		t.Fatalf("unexpected bloom stats %+v", s)
+	}
+}
+
+func TestBloomFilterIncremental(t *testing.T) {
+	loads := 0
+	g := NewGroup("bloom-incremental", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithBloomFilter(BloomOptions{ExpectedKeys: 100}))
+
+	// 没有 KeyEnumerator 时过滤器一开始是空的，只有添加过的 key 会被加载
+	if _, err := g.Get("Tom"); !errors.Is(err, ErrNotFound) || loads != 0 {
+		t.Fatalf("key not added should be rejected, got %v after %d loads", err, loads)
+	}
+	g.AddKey("Tom")
+	if v, err := g.Get("Tom"); err != nil || v.String() != "Tom" || loads != 1 {
+		t.Fatalf("expect Tom, got %q %v", v.String(), err)
+	}
+	if err := g.Set("Jack", []byte("589"), 0); err != nil {
+		t.Fatal(err)
+	}
+	g.Remove("Jack")
+	if v, err := g.Get("Jack"); err != nil || v.String() != "Jack" {
+		t.Fatalf("key written by Set should pass the filter, got %q %v", v.String(), err)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	var calls AtomicInt
+	canceled := make(chan struct{}, 1)
+	g := NewGroup("context", 2<<10, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		if calls.Add(1); calls.Get() > 1 {
+			return []byte("v"), 0, nil
+		}
+		<-ctx.Done()
+		canceled <- struct{}{}
+		return nil, 0, ctx.Err()
+	}))
+
+	// 唯一的调用者离开之后加载被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if _, err := g.GetContext(ctx, "k1"); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("getter should see the cancellation")
+	}
+	if _, err := g.GetContext(ctx, "k1"); err != context.Canceled {
+		t.Fatalf("expect context.Canceled without loading, got %v", err)
+	}
+	if calls.Get() != 1 {
+		t.Fatalf("canceled context should not load, got %d calls", calls.Get())
+	}
+}
+
+// TestGetContextJoin 加入的调用者在第一个调用者超时之后使用自己的 deadline 重新加载
+func TestGetContextJoin(t *testing.T) {
+	var calls AtomicInt
+	g := NewGroup("context-join", 2<<10, GetterCtxFunc(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		if calls.Add(1); calls.Get() > 1 {
+			return []byte("v"), 0, nil
+		}
+		<-ctx.Done()
+		return nil, 0, ctx.Err()
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	first := make(chan error)
+	go func() {
+		_, err := g.GetContext(ctx, "k")
+		first <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	v, err := g.Get("k")
+	if err != nil || v.String() != "v" {
+		t.Fatalf("expect v, got %q %v", v.String(), err)
+	}
+	if err := <-first; err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	if calls.Get() != 2 {
+		t.Fatalf("expect 2 loads, got %d", calls.Get())
+	}
+}
+
+// TestRemoveForgetsLoad Remove 之后的 Get 不会等待 Remove 之前开始的加载
+func TestRemoveForgetsLoad(t *testing.T) {
+	var calls AtomicInt
+	release := make(chan struct{})
+	g := NewGroup("forget", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if calls.Add(1); calls.Get() == 1 {
+			<-release
+			return []byte("old"), nil
+		}
+		return []byte("new"), nil
+	}))
+
+	old := make(chan string)
+	go func() {
+		v, _ := g.Get("k")
+		old <- v.String()
+	}()
+	for start := time.Now(); calls.Get() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("first load did not start")
+		}
+	}
+	if err := g.Remove("k"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Get("k"); err != nil || v.String() != "new" {
+		t.Fatalf("expect a new load after Remove, got %q %v", v.String(), err)
+	}
+	close(release)
+	if v := <-old; v != "old" {
+		t.Fatalf("caller before Remove should get old, got %q", v)
+	}
+}
@@ -0,0 +1,89 @@
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	sketchDepth = 4
+	maxCount    = 15 // 每个计数器只使用 4 bit
+)
+
+// sketch 是一个 count-min sketch，用很少的内存估计每个 key 最近的访问次数
+// 总的计数达到 sampleSize 之后所有的计数器减半，让旧的访问逐渐失效
+type sketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint32
+	additions  int
+	sampleSize int
+}
+
+// newSketch 创建一个估计大约 entries 个 key 的 sketch
+func newSketch(entries int) *sketch {
+	width := 16
+	for width < entries {
+		width <<= 1
+	}
+	s := &sketch{mask: uint32(width - 1), sampleSize: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// indexes 使用 double hashing 为每一行计算一个位置
+func (s *sketch) indexes(key string) (idx [sketchDepth]uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	for i := range idx {
+		idx[i] = (h1 + uint32(i)*h2) & s.mask
+	}
+	return
+}
+
+// increment 记录一次访问
+func (s *sketch) increment(key string) {
+	added := false
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < maxCount {
+			s.rows[i][j]++
+			added = true
+		}
+	}
+	if added {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.reset()
+		}
+	}
+}
+
+// estimate 返回 key 访问次数的估计值，所有行中最小的计数
+func (s *sketch) estimate(key string) uint8 {
+	min := uint8(maxCount)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return min
+}
+
+// reset 将所有的计数器减半
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+func (s *sketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+	s.additions = 0
+}
@@ -0,0 +1,218 @@
+package tinylfu
+
+import (
+	"container/list"
+	"tiny-cache/tinyCache/policy"
+)
+
+/*
+
+W-TinyLFU（Einziger, Friedman & Manes, 2017）
+
+	window      1% 的容量，LRU，新的值先进入这里，可以应对突发的访问
+	probation   主缓存中访问过一次的值
+	protected   主缓存中访问过多次的值，占主缓存的 80%
+
+值从 window 淘汰时成为候选者，和 probation 的队尾比较 sketch 估计的访问次数，
+次数更多的一方留在缓存中，所以扫描的数据很难进入主缓存
+
+*/
+
+const (
+	windowRatio       = 0.01
+	protectedRatio    = 0.8
+	defaultEntryBytes = 64 // 用来根据容量估计 sketch 的大小
+)
+
+const (
+	window = iota
+	probation
+	protected
+)
+
+// Cache is a W-TinyLFU cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes     int64
+	windowMax    int64
+	protectedMax int64
+	bytes        [3]int64
+	lists        [3]*list.List
+	cache        map[string]*list.Element
+	sketch       *sketch
+	// 在清除 item 的时候可以执行，没有被接纳的候选者也会调用
+	OnEvicted func(key string, value policy.Value)
+}
+
+type entry struct {
+	key   string
+	value policy.Value
+	size  int64
+	where int
+}
+
+var _ policy.Policy = (*Cache)(nil)
+
+// New is the Constructor of Cache, 假设每个值平均 64 字节来确定 sketch 的大小
+func New(maxBytes int64, onEvicted func(string, policy.Value)) *Cache {
+	entries := int(maxBytes / defaultEntryBytes)
+	if maxBytes == 0 {
+		entries = 1 << 12
+	}
+	return NewWithEntries(maxBytes, entries, onEvicted)
+}
+
+// NewWithEntries 创建 Cache，sketch 按照缓存中大约有 entries 个值来确定大小
+func NewWithEntries(maxBytes int64, entries int, onEvicted func(string, policy.Value)) *Cache {
+	windowMax := int64(float64(maxBytes) * windowRatio)
+	c := &Cache{
+		maxBytes:     maxBytes,
+		windowMax:    windowMax,
+		protectedMax: int64(float64(maxBytes-windowMax) * protectedRatio),
+		cache:        make(map[string]*list.Element),
+		sketch:       newSketch(entries),
+		OnEvicted:    onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value policy.Value) {
+	size := policy.Size(key, value)
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.bytes[kv.where] += size - kv.size
+		kv.value, kv.size = value, size
+		c.touch(ele)
+	} else {
+		c.cache[key] = c.lists[window].PushFront(&entry{key: key, value: value, size: size, where: window})
+		c.bytes[window] += size
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.bytes[window] > c.windowMax {
+		ele := c.lists[window].Back()
+		c.lists[window].Remove(ele)
+		c.bytes[window] -= ele.Value.(*entry).size
+		c.admit(ele.Value.(*entry))
+	}
+	for c.mainBytes() > c.maxBytes-c.windowMax {
+		c.removeElement(c.victim())
+	}
+}
+
+// Get look ups a key's value, 命中和未命中都会记录到 sketch 中
+func (c *Cache) Get(key string) (value policy.Value, ok bool) {
+	c.sketch.increment(key)
+	if ele, ok := c.cache[key]; ok {
+		c.touch(ele)
+		return ele.Value.(*entry).value, true
+	}
+	return
+}
+
+// touch 记录一次命中，probation 中的值晋升到 protected
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.where != probation {
+		c.lists[kv.where].MoveToFront(ele)
+		return
+	}
+	c.move(ele, protected)
+	for c.maxBytes != 0 && c.bytes[protected] > c.protectedMax {
+		c.move(c.lists[protected].Back(), probation)
+	}
+}
+
+// admit 决定从 window 淘汰的候选者能否进入主缓存
+func (c *Cache) admit(candidate *entry) {
+	mainMax := c.maxBytes - c.windowMax
+	for c.mainBytes()+candidate.size > mainMax {
+		victim := c.victim()
+		if victim == nil || c.sketch.estimate(candidate.key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			delete(c.cache, candidate.key)
+			if c.OnEvicted != nil {
+				c.OnEvicted(candidate.key, candidate.value)
+			}
+			return
+		}
+		c.removeElement(victim)
+	}
+	candidate.where = probation
+	c.cache[candidate.key] = c.lists[probation].PushFront(candidate)
+	c.bytes[probation] += candidate.size
+}
+
+// victim 返回主缓存中下一个被淘汰的值，优先淘汰 probation
+func (c *Cache) victim() *list.Element {
+	if ele := c.lists[probation].Back(); ele != nil {
+		return ele
+	}
+	return c.lists[protected].Back()
+}
+
+func (c *Cache) mainBytes() int64 {
+	return c.bytes[probation] + c.bytes[protected]
+}
+
+// move 将 ele 移动到 where 队列的队首
+func (c *Cache) move(ele *list.Element, where int) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.where].Remove(ele)
+	c.bytes[kv.where] -= kv.size
+	kv.where = where
+	c.cache[kv.key] = c.lists[where].PushFront(kv)
+	c.bytes[where] += kv.size
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.where].Remove(ele)
+	c.bytes[kv.where] -= kv.size
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// Clear purges all stored items from the cache and resets the frequency sketch.
+func (c *Cache) Clear() {
+	for _, l := range c.lists {
+		for l.Len() > 0 {
+			c.removeElement(l.Back())
+		}
+	}
+	c.sketch.clear()
+}
+
+// Range calls fn for each entry, window first.
+func (c *Cache) Range(fn func(key string, value policy.Value) bool) {
+	for _, l := range c.lists {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// Bytes the number of bytes used by cache entries
+func (c *Cache) Bytes() int64 {
+	return c.bytes[window] + c.mainBytes()
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
@@ -0,0 +1,95 @@
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+	"tiny-cache/tinyCache/policy"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(64)
+	for i := 0; i < 10; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	if n := s.estimate("hot"); n != 10 {
+		t.Fatalf("expect hot estimate 10, got %d", n)
+	}
+	if n := s.estimate("cold"); n < 1 || n > 2 {
+		t.Fatalf("expect cold estimate about 1, got %d", n)
+	}
+	for i := 0; i < 20; i++ {
+		s.increment("hot")
+	}
+	if n := s.estimate("hot"); n != maxCount {
+		t.Fatalf("counters should saturate at %d, got %d", maxCount, n)
+	}
+
+	s.reset()
+	if n := s.estimate("hot"); n != maxCount/2 {
+		t.Fatalf("reset should halve counters, got %d", n)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	// 每个值 5 字节，可以放下 30 个值，其中 20 个是热点
+	lfu := NewWithEntries(int64(30*5), 128, nil)
+	get := func(key string) {
+		if _, ok := lfu.Get(key); !ok {
+			lfu.Add(key, String("v"))
+		}
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			get(fmt.Sprintf("h%03d", i))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		get(fmt.Sprintf("s%03d", i))
+	}
+
+	hits := 0
+	for i := 0; i < 20; i++ {
+		if _, ok := lfu.Get(fmt.Sprintf("h%03d", i)); ok {
+			hits++
+		}
+	}
+	if hits < 18 {
+		t.Fatalf("scan evicted hot keys, only %d of 20 left", hits)
+	}
+	if total := lfu.bytes[window] + lfu.mainBytes(); total > lfu.maxBytes {
+		t.Fatalf("exceeds capacity: %d bytes", total)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := 0
+	lfu := New(int64(0), func(string, policy.Value) { evicted++ })
+	lfu.Add("key1", String("1"))
+	lfu.Add("key2", String("2"))
+	lfu.Remove("key1")
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	lfu.Clear()
+	if lfu.Len() != 0 || lfu.bytes != [3]int64{} || evicted != 2 {
+		t.Fatalf("Clear failed")
+	}
+}
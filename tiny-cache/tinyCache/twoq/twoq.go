@@ -0,0 +1,200 @@
+package twoq
+
+import (
+	"container/list"
+	"tiny-cache/tinyCache/policy"
+)
+
+/*
+
+2Q（Johnson & Shasha, 1994）
+
+	recent    A1in，新加入的值进入这个 FIFO 队列，在队列中再次访问不会改变顺序
+	ghost     A1out，从 recent 淘汰的 key（只保存 key 和大小，不保存值）
+	frequent  Am，LRU 队列，只有在 ghost 中的 key 再次加入时才会进入
+
+一次性扫描的数据只会经过 recent，不会把 frequent 中的热点数据挤出去
+
+*/
+
+const (
+	// DefaultRecentRatio 是 recent 队列占用容量的比例
+	DefaultRecentRatio = 0.25
+	// DefaultGhostRatio 是 ghost 队列记录的 key 对应的值占用容量的比例
+	DefaultGhostRatio = 0.5
+)
+
+// Cache is a 2Q cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes    int64
+	nowBytes    int64
+	recentMax   int64
+	recentBytes int64
+	ghostMax    int64
+	ghostBytes  int64
+	recent      *list.List
+	frequent    *list.List
+	ghost       *list.List
+	cache       map[string]*list.Element
+	ghostKeys   map[string]*list.Element
+	// 在清除 item 的时候可以执行
+	OnEvicted func(key string, value policy.Value)
+}
+
+type entry struct {
+	key      string
+	value    policy.Value
+	frequent bool // 是否在 frequent 队列中
+}
+
+type ghostEntry struct {
+	key  string
+	size int64
+}
+
+var _ policy.Policy = (*Cache)(nil)
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, policy.Value)) *Cache {
+	return NewParams(maxBytes, DefaultRecentRatio, DefaultGhostRatio, onEvicted)
+}
+
+// NewParams 使用指定的 recent 和 ghost 比例创建 Cache
+func NewParams(maxBytes int64, recentRatio, ghostRatio float64, onEvicted func(string, policy.Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		recentMax: int64(float64(maxBytes) * recentRatio),
+		ghostMax:  int64(float64(maxBytes) * ghostRatio),
+		recent:    list.New(),
+		frequent:  list.New(),
+		ghost:     list.New(),
+		cache:     make(map[string]*list.Element),
+		ghostKeys: make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value policy.Value) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		delta := int64(value.Len()) - int64(kv.value.Len())
+		c.nowBytes += delta
+		if kv.frequent {
+			c.frequent.MoveToFront(ele)
+		} else {
+			c.recentBytes += delta
+		}
+		kv.value = value
+	} else if ghost, ok := c.ghostKeys[key]; ok {
+		// 最近被淘汰过又再次加入，说明不是一次性的访问
+		c.removeGhost(ghost)
+		c.cache[key] = c.frequent.PushFront(&entry{key: key, value: value, frequent: true})
+		c.nowBytes += policy.Size(key, value)
+	} else {
+		c.cache[key] = c.recent.PushFront(&entry{key: key, value: value})
+		c.nowBytes += policy.Size(key, value)
+		c.recentBytes += policy.Size(key, value)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nowBytes {
+		c.evict()
+	}
+}
+
+// Get look ups a key's value
+func (c *Cache) Get(key string) (value policy.Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.frequent {
+			c.frequent.MoveToFront(ele)
+		}
+		return kv.value, true
+	}
+	return
+}
+
+// evict 淘汰一个值，recent 超出自己的份额时淘汰 recent 的队尾并记录到 ghost，否则淘汰 frequent 的队尾
+func (c *Cache) evict() {
+	if c.recent.Len() > 0 && (c.recentBytes > c.recentMax || c.frequent.Len() == 0) {
+		ele := c.recent.Back()
+		kv := ele.Value.(*entry)
+		c.removeElement(ele)
+		c.addGhost(kv.key, policy.Size(kv.key, kv.value))
+		return
+	}
+	if ele := c.frequent.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+func (c *Cache) addGhost(key string, size int64) {
+	c.ghostKeys[key] = c.ghost.PushFront(&ghostEntry{key: key, size: size})
+	c.ghostBytes += size
+	for c.ghostBytes > c.ghostMax && c.ghost.Len() > 0 {
+		c.removeGhost(c.ghost.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	g := ele.Value.(*ghostEntry)
+	c.ghost.Remove(ele)
+	delete(c.ghostKeys, g.key)
+	c.ghostBytes -= g.size
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// Clear purges all stored items from the cache.
+func (c *Cache) Clear() {
+	for _, l := range []*list.List{c.recent, c.frequent} {
+		for l.Len() > 0 {
+			c.removeElement(l.Back())
+		}
+	}
+	c.ghost.Init()
+	c.ghostKeys = make(map[string]*list.Element)
+	c.ghostBytes = 0
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	size := policy.Size(kv.key, kv.value)
+	if kv.frequent {
+		c.frequent.Remove(ele)
+	} else {
+		c.recent.Remove(ele)
+		c.recentBytes -= size
+	}
+	delete(c.cache, kv.key)
+	c.nowBytes -= size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Range calls fn for each entry, recent ones first.
+func (c *Cache) Range(fn func(key string, value policy.Value) bool) {
+	for _, l := range []*list.List{c.recent, c.frequent} {
+		for ele := l.Front(); ele != nil; ele = ele.Next() {
+			kv := ele.Value.(*entry)
+			if !fn(kv.key, kv.value) {
+				return
+			}
+		}
+	}
+}
+
+// Bytes the number of bytes used by cache entries
+func (c *Cache) Bytes() int64 {
+	return c.nowBytes
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
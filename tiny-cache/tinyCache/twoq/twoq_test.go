@@ -0,0 +1,69 @@
+package twoq
+
+import (
+	"strconv"
+	"testing"
+	"tiny-cache/tinyCache/policy"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	q := New(int64(0), nil)
+	q.Add("key1", String("1234"))
+	if v, ok := q.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := q.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestGhostPromotion(t *testing.T) {
+	// 容量 40 字节，recent 占 10 字节，ghost 记录 20 字节
+	q := New(int64(40), nil)
+	for i := 0; i < 10; i++ {
+		q.Add("k"+strconv.Itoa(i), String("v"))
+	}
+	// 较早的 key 从 recent 淘汰进入 ghost，更早的从 ghost 中移除
+	for i := 10; i < 18; i++ {
+		q.Add("k"+strconv.Itoa(i), String("v"))
+	}
+	if _, ok := q.Get("k0"); ok {
+		t.Fatalf("k0 should be evicted")
+	}
+	q.Add("k7", String("v"))
+	if ele, ok := q.cache["k7"]; !ok || !ele.Value.(*entry).frequent {
+		t.Fatalf("k7 in ghost should be promoted to frequent")
+	}
+
+	// 一次性的扫描不会淘汰 frequent 中的 k7
+	for i := 100; i < 200; i++ {
+		q.Add("k"+strconv.Itoa(i), String("v"))
+	}
+	if _, ok := q.Get("k7"); !ok {
+		t.Fatalf("scan should not evict frequent k7")
+	}
+	if q.nowBytes > 40 || q.ghostBytes > 20 {
+		t.Fatalf("exceeds capacity: %d bytes, %d ghost bytes", q.nowBytes, q.ghostBytes)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := 0
+	q := New(int64(0), func(string, policy.Value) { evicted++ })
+	q.Add("key1", String("1"))
+	q.Add("key2", String("2"))
+	q.Remove("key1")
+	if _, ok := q.Get("key1"); ok || q.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	q.Clear()
+	if q.Len() != 0 || q.nowBytes != 0 || q.recentBytes != 0 || evicted != 2 {
+		t.Fatalf("Clear failed")
+	}
+}
@@ -0,0 +1,102 @@
+package koo
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+/*
+
+koo 和标准库 net/http 之间的适配
+
+	WrapH / WrapF      把 http.Handler / http.HandlerFunc 当成 koo 的 HandlerFunc 使用
+	WrapMiddleware     把 func(http.Handler) http.Handler 形式的标准中间件放进 koo 的处理链
+	Mount              把一个 http.Handler（pprof，tinyCache 的 HTTPPool，另一个 koo.Engine）挂载到 group 下
+
+	admin := r.Group("/admin")
+	admin.Use(auth())
+	admin.Mount("/api", subEngine)     // /admin/api/users -> subEngine 看到的是 /users，auth 同样作用于 subEngine
+
+Mount 会去掉 prefix，tinyCache 的 HTTPPool 只处理以它的 basePath（默认 /_cache）开头的路径，其他路径返回 404，
+所以 prefix 不能包含 basePath，去掉 prefix 之后 basePath 必须仍然在路径中：
+
+	// r.Mount("/_cache", peers) 是错误的：peers 看到的是 /scores/Tom
+	peers := tinyCache.NewHTTPPool("http://localhost:8001/peers")
+	peers.Set("http://localhost:8001/peers", "http://localhost:8002/peers") // 节点地址带上 prefix
+	r.Mount("/peers", peers)           // /peers/_cache/scores/Tom -> peers 看到的是 /_cache/scores/Tom
+
+*/
+
+// WrapH 将 http.Handler 包装成 HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// WrapF 将 http.HandlerFunc 包装成 HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return WrapH(f)
+}
+
+// WrapMiddleware 将标准的中间件包装成 HandlerFunc
+// 中间件调用 next 时继续执行 koo 后面的 handler，并且使用中间件传入的 ResponseWriter 和 Request
+// 中间件没有调用 next 时，后面的 handler 不再执行
+func WrapMiddleware(mw func(http.Handler) http.Handler) HandlerFunc {
+	return func(c *Context) {
+		w, req := c.Writer, c.Req
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			called = true
+			c.Writer, c.Req = w, req
+			c.Next()
+		})
+		mw(next).ServeHTTP(c.Writer, c.Req)
+		c.Writer, c.Req = w, req
+		if !called {
+			c.Abort()
+		}
+	}
+}
+
+// Mount 将 handler 挂载到 prefix 下，prefix 以及它下面的所有路径都交给 handler 处理
+// handler 收到的请求路径去掉了 group 的前缀和 prefix，group 的中间件同样会执行
+// 挂载的路由不会出现在 OpenAPI 文档中
+// prefix 本身已经注册了路由时不会被覆盖，例如先注册 GET / 再 Mount("/", h)，GET / 仍然使用原来的 handler
+func (group *RouterGroup) Mount(prefix string, handler http.Handler) {
+	absolutePath := path.Join("/", group.prefix, prefix)
+	h := WrapH(stripPrefix(absolutePath, handler))
+	for _, method := range anyMethods {
+		if !group.engine.router.hasRoute(method, absolutePath) {
+			group.addRoute(method, prefix, h).Hidden()
+		}
+		group.addRoute(method, path.Join(prefix, "/*mountpath"), h).Hidden()
+	}
+}
+
+// stripPrefix 和 http.StripPrefix 类似，但是去掉前缀之后的路径总是以 / 开头
+func stripPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "/" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := strings.TrimPrefix(req.URL.Path, prefix)
+		rp := strings.TrimPrefix(req.URL.RawPath, prefix)
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		if rp != "" && !strings.HasPrefix(rp, "/") {
+			rp = "/" + rp
+		}
+
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = new(url.URL)
+		*r2.URL = *req.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = rp
+		h.ServeHTTP(w, r2)
+	})
+}
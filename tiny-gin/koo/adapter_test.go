@@ -0,0 +1,83 @@
+package koo_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+func TestMount(t *testing.T) {
+	sub := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s", req.URL.Path)
+	})
+	called := false
+	r := koo.New()
+	admin := r.Group("/admin")
+	admin.Use(func(c *koo.Context) {
+		called = true
+		c.Next()
+	})
+	admin.Mount("/api", sub)
+
+	kootest.NewRequest(r).GET("/admin/api/users/1").Do().AssertBody(t, "/users/1")
+	kootest.NewRequest(r).GET("/admin/api").Do().AssertBody(t, "/")
+	if !called {
+		t.Fatal("group middleware did not run for the mounted handler")
+	}
+}
+
+func TestMountRoot(t *testing.T) {
+	sub := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "sub %s", req.URL.Path)
+	})
+	r := koo.New()
+	r.GET("/", func(c *koo.Context) { c.String(http.StatusOK, "index") })
+	r.Mount("/", sub)
+	r.GET("/ping", func(c *koo.Context) { c.String(http.StatusOK, "pong") })
+
+	// 已经注册的 GET / 不会被覆盖，其他 method 的 / 交给挂载的 handler
+	kootest.NewRequest(r).GET("/").Do().AssertBody(t, "index")
+	kootest.NewRequest(r).POST("/").Do().AssertStatus(t, http.StatusOK).AssertBody(t, "sub /")
+	kootest.NewRequest(r).GET("/a/b").Do().AssertBody(t, "sub /a/b")
+	kootest.NewRequest(r).GET("/ping").Do().AssertBody(t, "pong")
+
+	bare := koo.New()
+	bare.Mount("/", sub)
+	kootest.NewRequest(bare).GET("/").Do().AssertStatus(t, http.StatusOK).AssertBody(t, "sub /")
+
+	// group 中的 Mount("/") 挂载在 group 的前缀上
+	api := bare.Group("/api")
+	api.Mount("/", sub)
+	kootest.NewRequest(bare).GET("/api").Do().AssertBody(t, "sub /")
+	kootest.NewRequest(bare).GET("/api/v1").Do().AssertBody(t, "sub /v1")
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	setHeader := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Wrapped", "yes")
+			next.ServeHTTP(w, req)
+		})
+	}
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "denied", http.StatusForbidden)
+		})
+	}
+
+	r := koo.New()
+	r.Use(koo.WrapMiddleware(setHeader))
+	r.GET("/", func(c *koo.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/std", koo.WrapF(func(w http.ResponseWriter, req *http.Request) { io.WriteString(w, "std") }))
+	denied := r.Group("/denied")
+	denied.Use(koo.WrapMiddleware(deny))
+	denied.GET("/x", func(c *koo.Context) { c.String(http.StatusOK, "reached") })
+
+	kootest.NewRequest(r).GET("/").Do().AssertHeader(t, "X-Wrapped", "yes").AssertBody(t, "ok")
+	kootest.NewRequest(r).GET("/std").Do().AssertBody(t, "std")
+	kootest.NewRequest(r).GET("/denied/x").Do().AssertStatus(t, http.StatusForbidden).AssertBody(t, "denied\n")
+}
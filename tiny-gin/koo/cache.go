@@ -0,0 +1,344 @@
+package koo
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+
+HTTP 缓存相关的中间件
+
+ETag()                        缓冲 GET 响应，计算弱 ETag，命中 If-None-Match / If-Modified-Since 时返回 304
+CacheResponse(ttl, keyFunc)   将完整的响应（状态码，响应头，响应体）缓存在 ResponseStore 中，
+                              相同 key 的 GET 请求直接返回缓存，不再执行后面的 handler
+                              响应设置了 Vary 时，Vary 列出的请求头也是 key 的一部分
+
+两者可以一起使用，CacheResponse 放在 ETag 后面，缓存命中的响应同样可以返回 304：
+
+	catalog := r.Group("/catalog")
+	catalog.Use(koo.ETag(), koo.CacheResponse(time.Minute, nil))
+
+*/
+
+// bufferedWriter 缓冲 handler 写入的状态码和响应体，响应头直接写在底层 ResponseWriter 的 Header 中
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// flush 将缓冲的响应写入底层的 ResponseWriter
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.statusCode())
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// buffer 将 c.Writer 替换为 bufferedWriter 并执行后面的 handler，返回之后恢复 c.Writer
+func buffer(c *Context) *bufferedWriter {
+	w := &bufferedWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer func() { c.Writer = w.ResponseWriter }()
+	c.Next()
+	return w
+}
+
+// ETag 中间件为 GET 的 200 响应计算弱 ETag，handler 自己设置了 ETag 时使用 handler 的
+// HEAD 响应没有响应体，无法计算出和 GET 相同的 ETag，所以不处理
+func ETag() HandlerFunc {
+	return func(c *Context) {
+		if c.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		w := buffer(c)
+		if w.statusCode() != http.StatusOK {
+			w.flush()
+			return
+		}
+
+		header := c.Writer.Header()
+		if header.Get("ETag") == "" {
+			header.Set("ETag", weakETag(w.body.Bytes()))
+		}
+		if notModified(c.Req, header) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			c.StatusCode = http.StatusNotModified
+			c.Writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.flush()
+	}
+}
+
+// weakETag 使用响应体的长度和 FNV-64a 作为弱 ETag
+func weakETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf(`W/"%x-%x"`, len(body), h.Sum64())
+}
+
+// notModified 判断条件请求是否可以返回 304
+// 同时存在时 If-None-Match 优先于 If-Modified-Since
+func notModified(req *http.Request, header http.Header) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// CachedResponse 是 CacheResponse 缓存的一个完整响应
+// Status 为 0 的 CachedResponse 只记录响应的 Vary，实际的响应保存在 varyKey 计算出的 key 中
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseStore 保存 CacheResponse 缓存的响应，需要是并发安全的
+type ResponseStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse, ttl time.Duration)
+}
+
+// DefaultCacheKey 使用请求方法和 RequestURI 作为缓存的 key
+func DefaultCacheKey(c *Context) string {
+	return c.Method + " " + c.Req.URL.RequestURI()
+}
+
+// CacheResponse 缓存 GET 响应，keyFunc 为 nil 时使用 DefaultCacheKey
+// 每次调用都创建一个新的内存 LRU（1024 个响应），不同的 CacheResponse 之间不共享缓存，
+// 需要共享或者使用其他存储时使用 CacheResponseWithStore
+func CacheResponse(ttl time.Duration, keyFunc func(*Context) string) HandlerFunc {
+	return CacheResponseWithStore(NewMemoryResponseStore(1024), ttl, keyFunc)
+}
+
+// CacheResponseWithStore 使用 store 缓存 GET / HEAD 的 200 响应，store 为 nil 时和 CacheResponse 相同
+// 设置了 Set-Cookie，Vary: * 或者 Cache-Control: no-store / private 的响应不会被缓存
+// 设置了 Vary 的响应按照 Vary 列出的请求头分别缓存，例如 Vary: Accept-Language 时每种语言缓存一份
+func CacheResponseWithStore(store ResponseStore, ttl time.Duration, keyFunc func(*Context) string) HandlerFunc {
+	if store == nil {
+		store = NewMemoryResponseStore(1024)
+	}
+	if keyFunc == nil {
+		keyFunc = DefaultCacheKey
+	}
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		key := keyFunc(c)
+		resp, ok := store.Get(key)
+		if ok && resp.Status == 0 {
+			resp, ok = store.Get(varyKey(key, resp.Header, c.Req))
+		}
+		if ok {
+			header := c.Writer.Header()
+			for k, v := range resp.Header {
+				header[k] = append([]string(nil), v...) // 不能和缓存中的响应共享 slice
+			}
+			header.Set("X-Koo-Cache", "HIT")
+			c.Data(resp.Status, resp.Body)
+			c.Abort()
+			return
+		}
+
+		c.Writer.Header().Set("X-Koo-Cache", "MISS")
+		w := buffer(c)
+		header := c.Writer.Header()
+		if w.statusCode() == http.StatusOK && cacheable(header) {
+			resp := &CachedResponse{Status: w.statusCode(), Header: header.Clone(), Body: w.body.Bytes()}
+			resp.Header.Del("X-Koo-Cache")
+			if vary := resp.Header.Values("Vary"); len(vary) > 0 {
+				index := &CachedResponse{Header: http.Header{"Vary": vary}}
+				store.Set(key, index, ttl)
+				key = varyKey(key, index.Header, c.Req)
+			}
+			store.Set(key, resp, ttl)
+		}
+		w.flush()
+	}
+}
+
+func cacheable(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range varyHeaders(header) {
+		if name == "*" {
+			return false
+		}
+	}
+	control := header.Get("Cache-Control")
+	return !strings.Contains(control, "no-store") && !strings.Contains(control, "private")
+}
+
+// varyHeaders 返回响应的 Vary 中列出的请求头
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// varyKey 将 Vary 列出的请求头加入 key
+// GET /doc + Vary: Accept-Language -> GET /doc\nAccept-Language: zh-CN
+func varyKey(key string, header http.Header, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range varyHeaders(header) {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+// MemoryResponseStore 是进程内的 LRU ResponseStore
+type MemoryResponseStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type responseEntry struct {
+	key    string
+	resp   *CachedResponse
+	expire time.Time
+}
+
+var _ ResponseStore = (*MemoryResponseStore)(nil)
+
+// NewMemoryResponseStore 创建一个最多保存 maxEntries 个响应的 LRU，maxEntries 为 0 表示不限制
+func NewMemoryResponseStore(maxEntries int) *MemoryResponseStore {
+	return &MemoryResponseStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get implements ResponseStore, 过期的响应在访问时删除
+func (s *MemoryResponseStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ele, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := ele.Value.(*responseEntry)
+	if time.Now().After(entry.expire) {
+		s.ll.Remove(ele)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.ll.MoveToFront(ele)
+	return entry.resp, true
+}
+
+// Set implements ResponseStore
+func (s *MemoryResponseStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &responseEntry{key: key, resp: resp, expire: time.Now().Add(ttl)}
+	if ele, ok := s.items[key]; ok {
+		ele.Value = entry
+		s.ll.MoveToFront(ele)
+		return
+	}
+	s.items[key] = s.ll.PushFront(entry)
+	for s.maxEntries != 0 && s.ll.Len() > s.maxEntries {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*responseEntry).key)
+	}
+}
+
+// ByteCache 是按照字节存取的缓存
+// tinyCache.Group 这样的分布式缓存包装成 ByteCache 之后（见 tinycachestore.NewByteCache），
+// 可以通过 NewByteResponseStore 在多个实例之间共享响应缓存
+type ByteCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// byteResponseStore 将响应 gob 编码之后保存在 ByteCache 中
+type byteResponseStore struct {
+	cache ByteCache
+}
+
+// NewByteResponseStore 将一个 ByteCache 适配成 ResponseStore
+func NewByteResponseStore(cache ByteCache) ResponseStore {
+	return &byteResponseStore{cache: cache}
+}
+
+func (s *byteResponseStore) Get(key string) (*CachedResponse, bool) {
+	data, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	resp := new(CachedResponse)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(resp); err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+func (s *byteResponseStore) Set(key string, resp *CachedResponse, ttl time.Duration) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(resp); err != nil {
+		return
+	}
+	s.cache.Set(key, buf.Bytes(), ttl)
+}
@@ -0,0 +1,255 @@
+package koo_test
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"koo"
+	"koo/kootest"
+)
+
+func TestETag(t *testing.T) {
+	modified := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	r := koo.New()
+	r.Use(koo.ETag())
+	r.GET("/doc", func(c *koo.Context) {
+		c.SetHeader("Last-Modified", modified.Format(http.TimeFormat))
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/missing", func(c *koo.Context) {
+		c.String(http.StatusNotFound, "missing")
+	})
+	r.GET("/tagged", func(c *koo.Context) {
+		c.SetHeader("ETag", `"v1"`)
+		c.String(http.StatusOK, "tagged")
+	})
+
+	rec := kootest.NewRequest(r).GET("/doc").Do().AssertStatus(t, http.StatusOK).AssertBody(t, "hello")
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag[:2] != "W/" {
+		t.Fatalf("ETag = %q, want a weak etag", etag)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{"if-none-match", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"strong comparison form", map[string]string{"If-None-Match": etag[2:]}, http.StatusNotModified},
+		{"list", map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+		{"star", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `W/"stale"`}, http.StatusOK},
+		{"if-modified-since", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"modified after since", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+		// 同时存在时只看 If-None-Match
+		{"etag wins", map[string]string{"If-None-Match": `W/"stale"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := kootest.NewRequest(r).GET("/doc")
+		for k, v := range tt.header {
+			req.WithHeader(k, v)
+		}
+		rec := req.Do()
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s: 304 with body %q", tt.name, rec.Body.String())
+		}
+	}
+
+	// HEAD 没有响应体，不计算 ETag
+	r.HEAD("/doc", func(c *koo.Context) { c.Status(http.StatusOK) })
+	kootest.NewRequest(r).Method(http.MethodHead, "/doc").Do().AssertStatus(t, http.StatusOK).AssertHeader(t, "ETag", "")
+
+	kootest.NewRequest(r).GET("/missing").WithHeader("If-None-Match", "*").Do().
+		AssertStatus(t, http.StatusNotFound).AssertHeader(t, "ETag", "")
+	kootest.NewRequest(r).GET("/tagged").WithHeader("If-None-Match", `"v1"`).Do().
+		AssertStatus(t, http.StatusNotModified).AssertHeader(t, "ETag", `"v1"`)
+}
+
+func TestCacheResponse(t *testing.T) {
+	calls := 0
+	r := koo.New()
+	r.Use(koo.CacheResponse(time.Minute, nil))
+	r.GET("/n", func(c *koo.Context) {
+		calls++
+		c.SetHeader("X-Calls", "set")
+		c.String(http.StatusOK, "n=%s", c.Query("n"))
+	})
+	r.GET("/private", func(c *koo.Context) {
+		calls++
+		c.SetHeader("Cache-Control", "private")
+		c.String(http.StatusOK, "private")
+	})
+	r.GET("/error", func(c *koo.Context) {
+		calls++
+		c.String(http.StatusInternalServerError, "error")
+	})
+
+	kootest.NewRequest(r).GET("/n?n=1").Do().AssertHeader(t, "X-Koo-Cache", "MISS").AssertBody(t, "n=1")
+	kootest.NewRequest(r).GET("/n?n=1").Do().AssertHeader(t, "X-Koo-Cache", "HIT").
+		AssertHeader(t, "X-Calls", "set").AssertBody(t, "n=1")
+	kootest.NewRequest(r).GET("/n?n=2").Do().AssertHeader(t, "X-Koo-Cache", "MISS").AssertBody(t, "n=2")
+	if calls != 2 {
+		t.Fatalf("handler called %d times, want 2", calls)
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		kootest.NewRequest(r).GET("/private").Do().AssertHeader(t, "X-Koo-Cache", "MISS")
+		kootest.NewRequest(r).GET("/error").Do().AssertStatus(t, http.StatusInternalServerError).
+			AssertHeader(t, "X-Koo-Cache", "MISS")
+	}
+	if calls != 4 {
+		t.Fatalf("uncacheable responses: handler called %d times, want 4", calls)
+	}
+}
+
+func TestCacheResponseVary(t *testing.T) {
+	calls := 0
+	r := koo.New()
+	r.Use(koo.CacheResponse(time.Minute, nil))
+	r.GET("/lang", func(c *koo.Context) {
+		calls++
+		c.SetHeader("Vary", "Accept-Language")
+		c.String(http.StatusOK, "%s", c.Req.Header.Get("Accept-Language"))
+	})
+	r.GET("/star", func(c *koo.Context) {
+		calls++
+		c.SetHeader("Vary", "*")
+		c.String(http.StatusOK, "star")
+	})
+
+	for _, lang := range []string{"en", "zh", "en", "zh"} {
+		kootest.NewRequest(r).GET("/lang").WithHeader("Accept-Language", lang).Do().AssertBody(t, lang)
+	}
+	kootest.NewRequest(r).GET("/lang").WithHeader("Accept-Language", "zh").Do().AssertHeader(t, "X-Koo-Cache", "HIT")
+	if calls != 2 {
+		t.Fatalf("handler called %d times, want 2", calls)
+	}
+
+	calls = 0
+	kootest.NewRequest(r).GET("/star").Do()
+	kootest.NewRequest(r).GET("/star").Do().AssertHeader(t, "X-Koo-Cache", "MISS")
+	if calls != 2 {
+		t.Fatalf("Vary: * handler called %d times, want 2", calls)
+	}
+}
+
+func TestCacheResponseHeaderCopy(t *testing.T) {
+	var seen []string
+	r := koo.New()
+	// 修改命中的响应头不能影响缓存中的响应
+	r.Use(func(c *koo.Context) {
+		c.Next()
+		v := c.Writer.Header()["X-Tag"]
+		seen = append(seen, v...)
+		v[0] = "changed"
+	})
+	r.Use(koo.CacheResponse(time.Minute, nil))
+	r.GET("/", func(c *koo.Context) {
+		c.SetHeader("X-Tag", "original")
+		c.String(http.StatusOK, "ok")
+	})
+	for i := 0; i < 3; i++ {
+		kootest.NewRequest(r).GET("/").Do()
+	}
+	if want := []string{"original", "original", "original"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("X-Tag = %v, want %v", seen, want)
+	}
+}
+
+func TestCacheResponsePerInstance(t *testing.T) {
+	// 两个 CacheResponse 使用同样的 key，但是不共享缓存
+	newEngine := func(body string) *koo.Engine {
+		r := koo.New()
+		r.Use(koo.CacheResponse(time.Minute, nil))
+		r.GET("/", func(c *koo.Context) { c.String(http.StatusOK, "%s", body) })
+		return r
+	}
+	a, b := newEngine("a"), newEngine("b")
+	kootest.NewRequest(a).GET("/").Do().AssertBody(t, "a")
+	kootest.NewRequest(b).GET("/").Do().AssertHeader(t, "X-Koo-Cache", "MISS").AssertBody(t, "b")
+}
+
+func TestCacheResponseWithETag(t *testing.T) {
+	r := koo.New()
+	r.Use(koo.ETag(), koo.CacheResponse(time.Minute, nil))
+	r.GET("/", func(c *koo.Context) { c.String(http.StatusOK, "body") })
+
+	etag := kootest.NewRequest(r).GET("/").Do().Header().Get("ETag")
+	kootest.NewRequest(r).GET("/").WithHeader("If-None-Match", etag).Do().
+		AssertStatus(t, http.StatusNotModified).AssertHeader(t, "X-Koo-Cache", "HIT")
+}
+
+// mapCache 是测试使用的 ByteCache
+type mapCache struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func (m *mapCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.items[key]
+	return v, ok
+}
+
+func (m *mapCache) Set(key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = value
+}
+
+func TestByteResponseStore(t *testing.T) {
+	cache := &mapCache{items: make(map[string][]byte)}
+	store := koo.NewByteResponseStore(cache)
+
+	// 共享同一个 ByteCache 的两个实例，一个写入的响应另一个可以命中
+	newEngine := func() *koo.Engine {
+		r := koo.New()
+		r.Use(koo.CacheResponseWithStore(store, time.Minute, nil))
+		r.GET("/", func(c *koo.Context) {
+			c.SetHeader("Content-Type", "text/plain")
+			c.String(http.StatusOK, "shared")
+		})
+		return r
+	}
+	kootest.NewRequest(newEngine()).GET("/").Do().AssertHeader(t, "X-Koo-Cache", "MISS")
+	kootest.NewRequest(newEngine()).GET("/").Do().AssertHeader(t, "X-Koo-Cache", "HIT").
+		AssertHeader(t, "Content-Type", "text/plain").AssertBody(t, "shared")
+
+	cache.Set("GET /bad", []byte("not gob"), time.Minute)
+	if _, ok := store.Get("GET /bad"); ok {
+		t.Fatal("undecodable entry is a hit")
+	}
+}
+
+func TestMemoryResponseStore(t *testing.T) {
+	store := koo.NewMemoryResponseStore(2)
+	resp := func(body string) *koo.CachedResponse {
+		return &koo.CachedResponse{Status: http.StatusOK, Body: []byte(body)}
+	}
+	store.Set("a", resp("a"), time.Minute)
+	store.Set("b", resp("b"), time.Minute)
+	store.Get("a")
+	store.Set("c", resp("c"), time.Minute) // 淘汰最久没有访问的 b
+	if _, ok := store.Get("b"); ok {
+		t.Error("b is not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, ok := store.Get(key); !ok || string(got.Body) != key {
+			t.Errorf("Get(%s) = %v, %t", key, got, ok)
+		}
+	}
+
+	store.Set("expired", resp("x"), -time.Second)
+	if _, ok := store.Get("expired"); ok {
+		t.Error("expired response is a hit")
+	}
+}
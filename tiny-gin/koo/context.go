@@ -11,9 +11,15 @@ package koo
 */
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // H 是将 string 映射到任意类型的一个简写
@@ -39,8 +45,19 @@ type Context struct {
 
 	// template
 	engine *Engine // Engine Pointer
+
+	// 中间件之间传递数据，例如 Sessions 保存的 *Session，只能通过 Set / Get 访问
+	// c 作为 context.Context 传给其他 goroutine 之后可能被并发读取，所以使用 mu 保护
+	mu   sync.RWMutex
+	keys map[string]any
+
+	// ctx 是 c.Req 为 nil 时 WithTimeout 设置的 context
+	ctx context.Context
 }
 
+// Context 实现了 context.Context，可以直接传给数据库，koorpc 等需要 context.Context 的调用
+var _ context.Context = (*Context)(nil)
+
 // newContext 是 context 的构造函数，返回一个 context 对象
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	return &Context{
@@ -52,6 +69,15 @@ func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	}
 }
 
+// NewContext 创建一个属于 engine 的 Context，handlers 作为它的处理链
+// 正常的请求由 ServeHTTP 创建 Context，这个方法主要给 kootest 这样的测试工具使用
+func (engine *Engine) NewContext(w http.ResponseWriter, req *http.Request, handlers ...HandlerFunc) *Context {
+	c := newContext(w, req)
+	c.handlers = handlers
+	c.engine = engine
+	return c
+}
+
 // Next 方法，对于一个 context，处理从 index 开始之后所有的 handlerFunc
 // index是记录当前执行到第几个中间件，当在中间件中调用Next方法时，
 // 控制权交给了下一个中间件，直到调用到最后一个中间件，然后再从后往前，调用每个中间件在Next方法之后定义的部分。
@@ -63,6 +89,16 @@ func (c *Context) Next() {
 	}
 }
 
+// Abort 跳过后面所有的 handler，已经执行的中间件在 Next 之后的部分仍然会执行
+func (c *Context) Abort() {
+	c.index = len(c.handlers)
+}
+
+// IsAborted 返回是否调用过 Abort 或者 Fail
+func (c *Context) IsAborted() bool {
+	return c.index >= len(c.handlers)
+}
+
 // Fail 方法将 c 的 index 跳转到最后一个元素的下一个，然后，将错误以 JSON 格式返回
 func (c *Context) Fail(code int, err string) {
 	c.index = len(c.handlers)
@@ -76,6 +112,67 @@ func (c *Context) Param(key string) string {
 	return value
 }
 
+// ParamInt 将路由参数解析为 int，参数不存在或者格式错误时返回 error
+func (c *Context) ParamInt(key string) (int, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("koo: param %s: %w", key, err)
+	}
+	return i, nil
+}
+
+// ParamInt64 将路由参数解析为 int64
+func (c *Context) ParamInt64(key string) (int64, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("koo: param %s: %w", key, err)
+	}
+	return i, nil
+}
+
+// ParamFloat64 将路由参数解析为 float64
+func (c *Context) ParamFloat64(key string) (float64, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("koo: param %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// ParamBool 将路由参数解析为 bool
+func (c *Context) ParamBool(key string) (bool, error) {
+	value, err := c.paramValue(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("koo: param %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// paramValue 返回路由参数，可选段没有出现时参数不存在，返回 error
+func (c *Context) paramValue(key string) (string, error) {
+	value, ok := c.Params[key]
+	if !ok {
+		return "", fmt.Errorf("koo: param %s not found", key)
+	}
+	return value, nil
+}
+
 // PostForm 接收一个 string 返回 http.Request.FormValue(string) 的结果
 func (c *Context) PostForm(key string) string {
 	return c.Req.FormValue(key)
@@ -99,6 +196,94 @@ func (c *Context) SetHeader(key string, value string) {
 	c.Writer.Header().Set(key, value)
 }
 
+// Set 在 c 中保存一个 key value，供后面的中间件和 handler 使用
+func (c *Context) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]any)
+	}
+	c.keys[key] = value
+}
+
+// Get 返回 Set 保存的 value
+func (c *Context) Get(key string) (value any, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, ok = c.keys[key]
+	return
+}
+
+// requestContext 返回请求的 context，客户端断开连接时 net/http 会取消它
+// 单独测试中间件时 c.Req 可能为 nil，此时使用 WithTimeout 设置的 ctx 或者 context.Background()
+func (c *Context) requestContext() context.Context {
+	if c.Req != nil {
+		return c.Req.Context()
+	}
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// Deadline implements context.Context, 代理到 c.Req.Context()
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	return c.requestContext().Deadline()
+}
+
+// Done implements context.Context, 客户端断开连接或者超过 WithTimeout 设置的时间时关闭
+// 耗时的 handler 可以通过 select c.Done() 提前结束
+func (c *Context) Done() <-chan struct{} {
+	return c.requestContext().Done()
+}
+
+// Err implements context.Context
+func (c *Context) Err() error {
+	return c.requestContext().Err()
+}
+
+// Value implements context.Context
+// string 类型的 key 先在 Set 保存的数据中查找，找不到时再查找 c.Req.Context()
+func (c *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if value, ok := c.Get(k); ok {
+			return value
+		}
+	}
+	return c.requestContext().Value(key)
+}
+
+// WithTimeout 为当前请求设置一个超时时间，之后的 handler 和使用 c 作为 context 的调用都会受到这个超时的限制
+// 返回的 cancel 应该在 handler 结束时调用，例如 defer c.WithTimeout(time.Second)()
+// cancel 同时恢复调用 WithTimeout 之前的 c.Req，之前的中间件看到的仍然是原来的请求
+func (c *Context) WithTimeout(timeout time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithTimeout(c.requestContext(), timeout)
+	req, prevCtx := c.Req, c.ctx
+	if req != nil {
+		c.Req = req.WithContext(ctx)
+	} else {
+		c.ctx = ctx
+	}
+	return func() {
+		cancel()
+		c.Req, c.ctx = req, prevCtx
+	}
+}
+
+// Cookie 返回请求中名为 name 的 cookie 的值
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// SetCookie 在响应中添加一个 Set-Cookie，必须在写入响应体之前调用
+func (c *Context) SetCookie(cookie *http.Cookie) {
+	http.SetCookie(c.Writer, cookie)
+}
+
 /*使用上面提供的接口实现更加集中的 API 接口 */
 
 // 使用 String 传入一部分信息，然后将 code 的信息记录在 c 中
@@ -128,10 +313,37 @@ func (c *Context) Data(code int, data []byte) {
 }
 
 // HTML 接口，根据模板文件名选择模板进行渲染。
+// 先渲染到 buffer 中，模板出错的时候还没有写入 header，可以正常返回 500
+// 渲染器是 HTMLFuncRender 时，使用 setTemplateFunc 绑定到当前请求的函数
 func (c *Context) HTML(code int, name string, data interface{}) {
+	if c.engine == nil || c.engine.htmlRender == nil {
+		c.Fail(http.StatusInternalServerError, "koo: html render is not set, call LoadHTMLGlob first")
+		return
+	}
+	var buf bytes.Buffer
+	var err error
+	funcs, _ := c.Get(templateFuncsKey)
+	if r, ok := c.engine.htmlRender.(HTMLFuncRender); ok && funcs != nil {
+		err = r.RenderFuncs(&buf, name, data, funcs.(template.FuncMap))
+	} else {
+		err = c.engine.htmlRender.Render(&buf, name, data)
+	}
+	if err != nil {
+		c.Fail(http.StatusInternalServerError, err.Error())
+		return
+	}
 	c.SetHeader("Content-Type", "text/html")
 	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(500, err.Error())
+	c.Writer.Write(buf.Bytes())
+}
+
+// setTemplateFunc 将模板函数 name 绑定到当前请求，c.HTML 渲染时替换同名的函数
+func (c *Context) setTemplateFunc(name string, fn any) {
+	v, _ := c.Get(templateFuncsKey)
+	funcs, ok := v.(template.FuncMap)
+	if !ok {
+		funcs = template.FuncMap{}
+		c.Set(templateFuncsKey, funcs)
 	}
+	funcs[name] = fn
 }
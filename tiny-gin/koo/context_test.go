@@ -0,0 +1,131 @@
+package koo_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"koo"
+	"koo/kootest"
+)
+
+type ctxKey struct{}
+
+func TestContextValue(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), ctxKey{}, "from request"))
+	c.Set("user", "fengwei")
+
+	var ctx context.Context = c
+	if got := ctx.Value("user"); got != "fengwei" {
+		t.Errorf("Value(user) = %v, want fengwei", got)
+	}
+	if got := ctx.Value(ctxKey{}); got != "from request" {
+		t.Errorf("Value(ctxKey) = %v, want from request", got)
+	}
+	if got := ctx.Value("missing"); got != nil {
+		t.Errorf("Value(missing) = %v, want nil", got)
+	}
+}
+
+func TestContextConcurrentKeys(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint(i)
+			c.Set(key, i)
+			if v, ok := c.Get(key); !ok || v != i {
+				t.Errorf("Get(%s) = %v, %t", key, v, ok)
+			}
+			_ = c.Value(key)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestContextWithTimeout(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	req := c.Req
+
+	cancel := c.WithTimeout(10 * time.Millisecond)
+	if _, ok := c.Deadline(); !ok {
+		t.Fatal("no deadline after WithTimeout")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done is not closed after the timeout")
+	}
+	if c.Err() != context.DeadlineExceeded {
+		t.Fatalf("Err = %v, want DeadlineExceeded", c.Err())
+	}
+
+	cancel()
+	if c.Req != req {
+		t.Fatal("cancel does not restore the previous request")
+	}
+	if _, ok := c.Deadline(); ok || c.Err() != nil {
+		t.Fatalf("deadline still set after cancel, Err = %v", c.Err())
+	}
+}
+
+func TestContextWithTimeoutNested(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	outer := c.WithTimeout(time.Hour)
+	d1, _ := c.Deadline()
+	inner := c.WithTimeout(time.Minute)
+	d2, _ := c.Deadline()
+	if !d2.Before(d1) {
+		t.Fatalf("inner deadline %v is not before outer %v", d2, d1)
+	}
+	inner()
+	if d, _ := c.Deadline(); !d.Equal(d1) {
+		t.Fatalf("deadline after inner cancel = %v, want %v", d, d1)
+	}
+	outer()
+	if _, ok := c.Deadline(); ok {
+		t.Fatal("deadline still set after outer cancel")
+	}
+}
+
+func TestContextWithTimeoutNilRequest(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	c.Req = nil
+	if c.Done() != nil || c.Err() != nil {
+		t.Fatal("Context without request is cancelable")
+	}
+
+	cancel := c.WithTimeout(time.Millisecond)
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done is not closed after the timeout")
+	}
+	cancel()
+	if c.Req != nil || c.Err() != nil {
+		t.Fatalf("cancel does not restore the Context, Req = %v, Err = %v", c.Req, c.Err())
+	}
+}
+
+func TestContextAsContext(t *testing.T) {
+	// handler 中的 c 直接作为 context.Context 传给下游调用
+	r := koo.New()
+	r.GET("/slow", func(c *koo.Context) {
+		defer c.WithTimeout(5 * time.Millisecond)()
+		select {
+		case <-time.After(time.Second):
+			c.String(http.StatusOK, "done")
+		case <-c.Done():
+			c.String(http.StatusGatewayTimeout, "%v", c.Err())
+		}
+	})
+	kootest.NewRequest(r).GET("/slow").Do().
+		AssertStatus(t, http.StatusGatewayTimeout).AssertBody(t, context.DeadlineExceeded.Error())
+}
@@ -0,0 +1,166 @@
+package koo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+
+CookieStore 将 session 的数据直接保存在 cookie 中
+
+cookie 的值 = base64( timestamp(8) | nonce | AES-GCM(gob(values)) | HMAC-SHA256 )
+
+HMAC 的输入包含 cookie 名，防止把一个 cookie 的值挪到另一个 cookie 上使用
+密钥按照 (hashKey, blockKey) 成对传入，第一对用于编码，所有的密钥对都可以用于解码
+轮换密钥时把新的密钥对放在最前面，旧的密钥对保留到旧 cookie 全部过期之后再删除
+
+*/
+
+// maxCookieSize 是浏览器允许的单个 cookie 的大小
+const maxCookieSize = 4096
+
+var (
+	errCookieInvalid = errors.New("koo: session cookie is invalid")
+	errCookieExpired = errors.New("koo: session cookie is expired")
+)
+
+// CookieStore 在 cookie 中保存签名并且加密之后的 session 数据
+type CookieStore struct {
+	Options SessionOptions
+	codecs  []cookieCodec
+}
+
+var _ Store = (*CookieStore)(nil)
+
+type cookieCodec struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// NewCookieStore 创建一个 CookieStore，keyPairs 是成对的 hashKey 和 blockKey
+// hashKey 建议 32 或 64 字节，blockKey 必须是 16，24 或 32 字节，分别对应 AES-128，AES-192，AES-256
+func NewCookieStore(keyPairs ...[]byte) (*CookieStore, error) {
+	if len(keyPairs) == 0 || len(keyPairs)%2 != 0 {
+		return nil, fmt.Errorf("koo: cookie store needs (hashKey, blockKey) pairs, got %d keys", len(keyPairs))
+	}
+	st := &CookieStore{Options: DefaultSessionOptions}
+	for i := 0; i < len(keyPairs); i += 2 {
+		hashKey, blockKey := keyPairs[i], keyPairs[i+1]
+		if len(hashKey) == 0 {
+			return nil, fmt.Errorf("koo: cookie store hash key %d is empty", i/2)
+		}
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, fmt.Errorf("koo: cookie store block key %d: %w", i/2, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		st.codecs = append(st.codecs, cookieCodec{hashKey: hashKey, aead: aead})
+	}
+	return st, nil
+}
+
+// Get implements Store
+func (st *CookieStore) Get(c *Context, name string) (*Session, error) {
+	s := NewSession(c, st, name, st.Options)
+	value, err := c.Cookie(name)
+	if err != nil {
+		return s, nil
+	}
+	data, err := st.decode(name, value)
+	if err != nil {
+		return s, err
+	}
+	values, err := decodeValues(data)
+	if err != nil {
+		return s, err
+	}
+	s.Values, s.IsNew = values, false
+	return s, nil
+}
+
+// Save implements Store
+func (st *CookieStore) Save(c *Context, s *Session) error {
+	if s.Options.MaxAge < 0 {
+		c.SetCookie(s.Options.cookie(s.name, ""))
+		return nil
+	}
+	data, err := encodeValues(s.Values)
+	if err != nil {
+		return err
+	}
+	value, err := st.encode(s.name, data)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxCookieSize {
+		return fmt.Errorf("koo: session %s is too large for a cookie: %d bytes", s.name, len(value))
+	}
+	c.SetCookie(s.Options.cookie(s.name, value))
+	return nil
+}
+
+// encode 使用第一对密钥加密并签名
+func (st *CookieStore) encode(name string, data []byte) (string, error) {
+	codec := st.codecs[0]
+	buf := make([]byte, 8, 8+codec.aead.NonceSize()+len(data)+codec.aead.Overhead()+sha256.Size)
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().Unix()))
+
+	nonce := make([]byte, codec.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	buf = append(buf, nonce...)
+	buf = codec.aead.Seal(buf, nonce, data, []byte(name))
+	buf = append(buf, codec.mac(name, buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// decode 依次使用每一对密钥校验签名，签名正确之后检查是否过期并解密
+func (st *CookieStore) decode(name string, value string) ([]byte, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errCookieInvalid
+	}
+	for _, codec := range st.codecs {
+		if len(buf) < 8+codec.aead.NonceSize()+sha256.Size {
+			continue
+		}
+		body, sum := buf[:len(buf)-sha256.Size], buf[len(buf)-sha256.Size:]
+		if !hmac.Equal(sum, codec.mac(name, body)) {
+			continue
+		}
+
+		created := time.Unix(int64(binary.BigEndian.Uint64(body)), 0)
+		if st.Options.MaxAge > 0 && time.Since(created) > time.Duration(st.Options.MaxAge)*time.Second {
+			return nil, errCookieExpired
+		}
+		nonce, ciphertext := body[8:8+codec.aead.NonceSize()], body[8+codec.aead.NonceSize():]
+		data, err := codec.aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil {
+			return nil, errCookieInvalid
+		}
+		return data, nil
+	}
+	return nil, errCookieInvalid
+}
+
+func (codec cookieCodec) mac(name string, body []byte) []byte {
+	h := hmac.New(sha256.New, codec.hashKey)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write(body)
+	return h.Sum(nil)
+}
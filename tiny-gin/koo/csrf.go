@@ -0,0 +1,123 @@
+package koo
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+)
+
+/*
+
+CSRF 中间件使用 double submit 的方式防御跨站请求伪造：
+
+1. 每个请求都保证浏览器中有一个随机 token 的 cookie
+2. POST / PUT / PATCH / DELETE 请求必须在请求头或者表单字段中再提交一次这个 token
+3. 两者不一致时返回 403
+
+其他站点可以让浏览器带上 cookie，但是读不到 cookie 的内容，所以无法构造出正确的请求头或者表单字段
+
+模板中使用 csrfField 生成隐藏的表单字段：
+
+	opts := koo.CSRFOptions{FormField: "csrf_token"}
+	r.Use(koo.CSRF(opts))
+	r.SetFuncMap(koo.CSRFFuncMap(opts)) // 使用同一份 opts，表单字段名和中间件读取的一致
+	c.HTML(http.StatusOK, "form.tmpl", koo.H{"csrf": c.CSRFToken()})
+	<form method="post">{{ csrfField .csrf }} ... </form>
+
+*/
+
+const csrfKey = "koo/csrf"
+
+// CSRFOptions 是 CSRF 中间件的配置，零值的字段使用默认值
+type CSRFOptions struct {
+	CookieName   string        // 默认 _csrf
+	HeaderName   string        // 默认 X-CSRF-Token
+	FormField    string        // 默认 _csrf
+	Path         string        // cookie 的 path，默认 /
+	MaxAge       int           // cookie 的有效期（秒），默认 12 小时
+	Secure       bool          // 只在 https 中发送 cookie
+	SameSite     http.SameSite // 默认 Lax
+	ErrorHandler HandlerFunc   // token 校验失败时调用，默认返回 403
+}
+
+// withDefaults 返回填充了默认值的 opts
+func (opts CSRFOptions) withDefaults() CSRFOptions {
+	if opts.CookieName == "" {
+		opts.CookieName = "_csrf"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FormField == "" {
+		opts.FormField = "_csrf"
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = 12 * 3600
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(c *Context) {
+			c.Fail(http.StatusForbidden, "invalid csrf token")
+		}
+	}
+	return opts
+}
+
+// CSRF 中间件
+func CSRF(opts CSRFOptions) HandlerFunc {
+	opts = opts.withDefaults()
+	return func(c *Context) {
+		token, _ := c.Cookie(opts.CookieName)
+
+		switch c.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			submitted := c.Req.Header.Get(opts.HeaderName)
+			if submitted == "" {
+				submitted = c.PostForm(opts.FormField)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) != 1 {
+				opts.ErrorHandler(c)
+				return
+			}
+		}
+
+		if token == "" {
+			token = randomToken(32)
+			// 前端的 js 需要读取 cookie 放到请求头中，所以不能是 HttpOnly
+			c.SetCookie(&http.Cookie{
+				Name:     opts.CookieName,
+				Value:    token,
+				Path:     opts.Path,
+				MaxAge:   opts.MaxAge,
+				Secure:   opts.Secure,
+				SameSite: opts.SameSite,
+			})
+		}
+		c.Set(csrfKey, token)
+		c.Next()
+	}
+}
+
+// CSRFToken 返回当前请求的 csrf token，没有使用 CSRF 中间件时返回空字符串
+func (c *Context) CSRFToken() string {
+	token, _ := c.Get(csrfKey)
+	s, _ := token.(string)
+	return s
+}
+
+// CSRFFuncMap 返回模板中使用的 csrf 辅助函数，通过 engine.SetFuncMap 注册
+// csrfField 接收 c.CSRFToken() 的值，生成名为 opts.FormField 的隐藏表单字段，opts 应该和传给 CSRF 的相同
+func CSRFFuncMap(opts CSRFOptions) template.FuncMap {
+	field := template.HTMLEscapeString(opts.withDefaults().FormField)
+	return template.FuncMap{
+		"csrfField": func(token string) template.HTML {
+			return template.HTML(`<input type="hidden" name="` + field + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	}
+}
@@ -0,0 +1,75 @@
+package koo_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+func newCSRFEngine(opts koo.CSRFOptions) *koo.Engine {
+	r := koo.New()
+	r.Use(koo.CSRF(opts))
+	r.GET("/form", func(c *koo.Context) {
+		c.String(http.StatusOK, "%s", c.CSRFToken())
+	})
+	r.POST("/form", func(c *koo.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return r
+}
+
+// csrfCookie 发送一个 GET 请求，返回 CSRF 中间件写入的 cookie 和 token
+func csrfCookie(t *testing.T, r *koo.Engine, name string) (*http.Cookie, string) {
+	t.Helper()
+	rec := kootest.NewRequest(r).GET("/form").Do().AssertStatus(t, http.StatusOK)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			if cookie.Value != rec.Body.String() {
+				t.Fatalf("cookie %s = %q, CSRFToken() = %q", name, cookie.Value, rec.Body.String())
+			}
+			return cookie, cookie.Value
+		}
+	}
+	t.Fatalf("no %s cookie in response", name)
+	return nil, ""
+}
+
+func TestCSRF(t *testing.T) {
+	r := newCSRFEngine(koo.CSRFOptions{})
+	cookie, token := csrfCookie(t, r, "_csrf")
+
+	kootest.NewRequest(r).POST("/form").Do().AssertStatus(t, http.StatusForbidden)
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).Do().AssertStatus(t, http.StatusForbidden)
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).WithHeader("X-CSRF-Token", "bad").Do().
+		AssertStatus(t, http.StatusForbidden)
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).WithHeader("X-CSRF-Token", token).Do().
+		AssertStatus(t, http.StatusOK).AssertBody(t, "ok")
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).WithForm(url.Values{"_csrf": {token}}).Do().
+		AssertStatus(t, http.StatusOK)
+}
+
+func TestCSRFCustomFormField(t *testing.T) {
+	opts := koo.CSRFOptions{CookieName: "xsrf", FormField: "csrf_token"}
+	r := newCSRFEngine(opts)
+	cookie, token := csrfCookie(t, r, "xsrf")
+
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).WithForm(url.Values{"csrf_token": {token}}).Do().
+		AssertStatus(t, http.StatusOK)
+	kootest.NewRequest(r).POST("/form").WithCookie(cookie).WithForm(url.Values{"_csrf": {token}}).Do().
+		AssertStatus(t, http.StatusForbidden)
+
+	// csrfField 生成的字段名和中间件读取的字段名一致
+	field := koo.CSRFFuncMap(opts)["csrfField"].(func(string) template.HTML)(token)
+	if !strings.Contains(string(field), `name="csrf_token"`) {
+		t.Errorf("csrfField = %s, want name csrf_token", field)
+	}
+	field = koo.CSRFFuncMap(koo.CSRFOptions{})["csrfField"].(func(string) template.HTML)(`"<x>`)
+	if want := `<input type="hidden" name="_csrf" value="&#34;&lt;x&gt;">`; string(field) != want {
+		t.Errorf("csrfField = %s, want %s", field, want)
+	}
+}
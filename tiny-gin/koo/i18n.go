@@ -0,0 +1,610 @@
+package koo
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+
+国际化
+
+Bundle 保存每种语言的消息，消息文件使用 JSON 或者 TOML，文件名的最后一段是语言，例如 zh.json，messages.en-US.toml
+
+	{
+		"hello": "你好，%s",
+		"user": {"login": "登录"},                               // 嵌套的 key 展开为 user.login
+		"apples": {"one": "%d apple", "other": "%d apples"}    // 复数形式
+	}
+
+I18n 中间件按照 query 参数，cookie，Accept-Language 的顺序协商语言，handler 中使用 c.T 翻译：
+
+	bundle := koo.NewBundle("en")
+	bundle.LoadFS(locales, "locales/*.json")
+	bundle.SetFallback("zh-TW", "zh", "en")
+	r.Use(koo.I18n(bundle, koo.I18nOptions{}))
+	r.SetFuncMap(bundle.FuncMap()) // 模板中 {{ T "hello" .name }}，渲染时 T 绑定到当前请求的语言
+
+	c.T("hello", "fengwei")   // 你好，fengwei
+	c.T("apples", 3)          // 第一个参数是整数并且消息有复数形式时，按照语言的复数规则选择
+
+找不到的消息按照回退链查找：zh-TW -> zh -> 默认语言，都找不到时返回 key 本身
+I18n 设置 Vary: Accept-Language, Cookie，CacheResponse 会为每种语言分别缓存
+
+*/
+
+const (
+	localeKey = "koo/locale"
+	bundleKey = "koo/i18n"
+)
+
+// PluralRule 根据数量返回 CLDR 的复数类别：zero one two few many other
+type PluralRule func(n int) string
+
+var pluralForms = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+// 内置的复数规则，按照语言（不含地区）查找，没有的语言使用 englishPlural
+var defaultPluralRules = map[string]PluralRule{
+	"en": englishPlural,
+	"de": englishPlural,
+	"zh": otherPlural,
+	"ja": otherPlural,
+	"ko": otherPlural,
+	"fr": frenchPlural,
+	"ru": russianPlural,
+}
+
+func englishPlural(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func otherPlural(n int) string {
+	return "other"
+}
+
+func frenchPlural(n int) string {
+	if n == 0 || n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func russianPlural(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+// message 是一条消息，forms 不为空时表示有复数形式
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+// Bundle 保存所有语言的消息
+type Bundle struct {
+	mu          sync.RWMutex // protects following
+	defaultLang string
+	messages    map[string]map[string]message // lang -> key -> message
+	fallbacks   map[string][]string
+	plurals     map[string]PluralRule
+}
+
+// NewBundle 创建一个 Bundle，defaultLang 是所有回退链的最后一项
+func NewBundle(defaultLang string) *Bundle {
+	return &Bundle{
+		defaultLang: canonicalLang(defaultLang),
+		messages:    make(map[string]map[string]message),
+		fallbacks:   make(map[string][]string),
+		plurals:     make(map[string]PluralRule),
+	}
+}
+
+// SetFallback 设置 lang 的回退链，例如 SetFallback("zh-TW", "zh-HK", "zh", "en")
+func (b *Bundle) SetFallback(lang string, chain ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fallbacks := make([]string, len(chain)) // 不修改调用者的 slice
+	for i, l := range chain {
+		fallbacks[i] = canonicalLang(l)
+	}
+	b.fallbacks[canonicalLang(lang)] = fallbacks
+}
+
+// SetPluralRule 设置语言的复数规则，lang 可以是 ru 这样的语言，也可以是 pt-BR 这样带地区的
+func (b *Bundle) SetPluralRule(lang string, rule PluralRule) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.plurals[canonicalLang(lang)] = rule
+}
+
+// AddMessages 添加 lang 的消息，value 是字符串，嵌套的 map 或者复数形式的 map
+func (b *Bundle) AddMessages(lang string, messages map[string]any) error {
+	flat := make(map[string]message)
+	if err := flattenMessages("", messages, flat); err != nil {
+		return fmt.Errorf("koo: i18n %s: %w", lang, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lang = canonicalLang(lang)
+	if b.messages[lang] == nil {
+		b.messages[lang] = make(map[string]message)
+	}
+	for key, msg := range flat {
+		b.messages[lang][key] = msg
+	}
+	return nil
+}
+
+func flattenMessages(prefix string, messages map[string]any, flat map[string]message) error {
+	for key, value := range messages {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case string:
+			flat[key] = message{text: v}
+		case map[string]any:
+			if forms, ok := pluralMessage(v); ok {
+				flat[key] = message{text: forms["other"], forms: forms}
+				continue
+			}
+			if err := flattenMessages(key, v, flat); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %s must be a string or an object, got %T", key, value)
+		}
+	}
+	return nil
+}
+
+// pluralMessage 判断一个 map 是不是复数形式：所有的 key 都是复数类别，并且有 other
+func pluralMessage(m map[string]any) (map[string]string, bool) {
+	if _, ok := m["other"]; !ok {
+		return nil, false
+	}
+	forms := make(map[string]string, len(m))
+	for form, value := range m {
+		text, ok := value.(string)
+		if !pluralForms[form] || !ok {
+			return nil, false
+		}
+		forms[form] = text
+	}
+	return forms, true
+}
+
+// LoadFile 加载一个 .json 或者 .toml 消息文件，语言由文件名决定
+func (b *Bundle) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return b.loadData(filepath.Base(filename), data)
+}
+
+// LoadFS 从 fs.FS（例如 embed.FS）中加载所有匹配 patterns 的消息文件
+func (b *Bundle) LoadFS(fsys fs.FS, patterns ...string) error {
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			if err := b.loadData(path.Base(file), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadData 根据文件名的扩展名解析消息，扩展名前面的最后一段是语言
+func (b *Bundle) loadData(name string, data []byte) error {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	lang := base[strings.LastIndex(base, ".")+1:]
+
+	messages := make(map[string]any)
+	switch ext {
+	case ".json":
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("koo: i18n %s: %w", name, err)
+		}
+	case ".toml":
+		var err error
+		if messages, err = parseTOML(string(data)); err != nil {
+			return fmt.Errorf("koo: i18n %s: %w", name, err)
+		}
+	default:
+		return fmt.Errorf("koo: i18n %s: unsupported file type", name)
+	}
+	return b.AddMessages(lang, messages)
+}
+
+// Languages 返回已经加载了消息的语言
+func (b *Bundle) Languages() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	langs := make([]string, 0, len(b.messages))
+	for lang := range b.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// chain 返回 lang 的回退链：lang，SetFallback 设置的语言（或者 lang 去掉地区之后的语言），默认语言
+func (b *Bundle) chain(lang string) []string {
+	chain := []string{lang}
+	if fallbacks, ok := b.fallbacks[lang]; ok {
+		chain = append(chain, fallbacks...)
+	} else if base, _, found := strings.Cut(lang, "-"); found {
+		chain = append(chain, base)
+	}
+	return append(chain, b.defaultLang)
+}
+
+// T 翻译 lang 中的 key，args 不为空时使用 fmt.Sprintf 格式化
+// 第一个参数是整数并且消息有复数形式时，按照 lang 的复数规则选择形式
+func (b *Bundle) T(lang string, key string, args ...any) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	lang = canonicalLang(lang)
+	for _, l := range b.chain(lang) {
+		msg, ok := b.messages[l][key]
+		if !ok {
+			continue
+		}
+		text := msg.text
+		if len(msg.forms) > 0 && len(args) > 0 {
+			if n, ok := toInt(args[0]); ok {
+				if form, ok := msg.forms[b.pluralRule(l)(n)]; ok {
+					text = form
+				}
+			}
+		}
+		if len(args) == 0 {
+			return text
+		}
+		return fmt.Sprintf(text, args...)
+	}
+	return key
+}
+
+func (b *Bundle) pluralRule(lang string) PluralRule {
+	if rule, ok := b.plurals[lang]; ok {
+		return rule
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if rule, ok := b.plurals[base]; ok {
+		return rule
+	}
+	if rule, ok := defaultPluralRules[base]; ok {
+		return rule
+	}
+	return englishPlural
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint:
+		return int(n), true
+	case uint8:
+		return int(n), true
+	case uint16:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// supported 判断 lang 是否可以使用：lang 或者它回退链中除默认语言外的某个语言有消息
+func (b *Bundle) supported(lang string) bool {
+	chain := b.chain(lang)
+	for _, l := range chain[:len(chain)-1] {
+		if _, ok := b.messages[l]; ok {
+			return true
+		}
+	}
+	return lang == b.defaultLang
+}
+
+// Negotiate 依次检查 candidates，返回第一个可以使用的语言，都不可以时返回默认语言
+func (b *Bundle) Negotiate(candidates ...string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if lang := canonicalLang(candidate); b.supported(lang) {
+			return lang
+		}
+	}
+	return b.defaultLang
+}
+
+// FuncMap 返回模板中使用的 T 函数，{{ T "hello" .name }}
+// 使用 I18n 中间件时 c.HTML 把 T 绑定到当前请求的语言，否则使用默认语言
+func (b *Bundle) FuncMap() template.FuncMap {
+	return template.FuncMap{"T": func(key string, args ...any) string {
+		return b.T(b.defaultLang, key, args...)
+	}}
+}
+
+// I18nOptions 是 I18n 中间件的配置
+type I18nOptions struct {
+	QueryParam string // 默认 lang
+	CookieName string // 默认 lang
+	// RememberQuery 为 true 时，通过 query 参数选择的语言会写入 cookie
+	RememberQuery bool
+}
+
+// I18n 中间件，按照 query 参数，cookie，Accept-Language 的顺序协商语言
+func I18n(bundle *Bundle, opts I18nOptions) HandlerFunc {
+	if opts.QueryParam == "" {
+		opts.QueryParam = "lang"
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "lang"
+	}
+	return func(c *Context) {
+		query := c.Query(opts.QueryParam)
+		cookie, _ := c.Cookie(opts.CookieName)
+		candidates := append([]string{query, cookie}, parseAcceptLanguage(c.Req.Header.Get("Accept-Language"))...)
+		lang := bundle.Negotiate(candidates...)
+		if opts.RememberQuery && query != "" && lang == canonicalLang(query) {
+			c.SetCookie(&http.Cookie{Name: opts.CookieName, Value: lang, Path: "/", MaxAge: 365 * 86400})
+		}
+		c.Writer.Header().Add("Vary", "Accept-Language, Cookie")
+		c.Set(bundleKey, bundle)
+		c.Set(localeKey, lang)
+		c.setTemplateFunc("T", c.T)
+		c.Next()
+	}
+}
+
+// Locale 返回 I18n 中间件协商出来的语言，没有使用 I18n 中间件时返回空字符串
+func (c *Context) Locale() string {
+	lang, _ := c.Get(localeKey)
+	s, _ := lang.(string)
+	return s
+}
+
+// T 使用当前请求的语言翻译 key，没有使用 I18n 中间件时返回 key
+func (c *Context) T(key string, args ...any) string {
+	bundle, ok := c.Get(bundleKey)
+	if !ok {
+		return key
+	}
+	return bundle.(*Bundle).T(c.Locale(), key, args...)
+}
+
+// parseAcceptLanguage 按照 q 值从大到小返回 Accept-Language 中的语言
+// zh-CN,zh;q=0.9,en;q=0.8 -> [zh-CN zh en]
+func parseAcceptLanguage(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{lang: lang, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.lang
+	}
+	return langs
+}
+
+// canonicalLang 规范化语言标签：zh_tw -> zh-TW，zh-hant -> zh-Hant
+func canonicalLang(lang string) string {
+	parts := strings.FieldsFunc(lang, func(r rune) bool { return r == '-' || r == '_' })
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parseTOML 解析消息文件使用的 TOML 子集：注释，[table]，key = "string"，key = 'literal'，a.b = "dotted key"
+func parseTOML(data string) (map[string]any, error) {
+	root := make(map[string]any)
+	table := root
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: bad table header", i+1)
+			}
+			keys, err := tomlKeys(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			continue
+		}
+
+		rawKey, rawValue, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		keys, err := tomlKeys(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		value, err := tomlString(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		t, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		t[keys[len(keys)-1]] = value
+	}
+	return root, nil
+}
+
+// tomlKeys 解析 a."b.c".d 形式的 key
+func tomlKeys(raw string) ([]string, error) {
+	var keys []string
+	raw = strings.TrimSpace(raw)
+	for raw != "" {
+		var key string
+		if raw[0] == '"' || raw[0] == '\'' {
+			end := strings.IndexByte(raw[1:], raw[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key %s", raw)
+			}
+			key, raw = raw[1:end+1], raw[end+2:]
+		} else {
+			var rest string
+			key, rest, _ = strings.Cut(raw, ".")
+			key = strings.TrimSpace(key)
+			raw = "." + rest
+			if rest == "" {
+				raw = ""
+			}
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		keys = append(keys, key)
+		raw = strings.TrimSpace(raw)
+		if raw != "" {
+			if raw[0] != '.' {
+				return nil, fmt.Errorf("bad key near %s", raw)
+			}
+			raw = strings.TrimSpace(raw[1:])
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	return keys, nil
+}
+
+// tomlString 解析一个单行的字符串，值后面可以有注释
+func tomlString(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return raw[1 : end+1], tomlTrailing(raw[end+2:])
+	case '"':
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+				continue
+			}
+			if raw[i] == '"' {
+				s, err := strconv.Unquote(raw[:i+1])
+				if err != nil {
+					return "", fmt.Errorf("bad string %s", raw[:i+1])
+				}
+				return s, tomlTrailing(raw[i+1:])
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", raw)
+	}
+	return "", fmt.Errorf("only string values are supported, got %s", raw)
+}
+
+func tomlTrailing(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && rest[0] != '#' {
+		return fmt.Errorf("unexpected %s after value", rest)
+	}
+	return nil
+}
+
+// tomlTable 返回 keys 对应的表，不存在时创建
+func tomlTable(root map[string]any, keys []string) (map[string]any, error) {
+	table := root
+	for _, key := range keys {
+		next, ok := table[key]
+		if !ok {
+			t := make(map[string]any)
+			table[key] = t
+			table = t
+			continue
+		}
+		if table, ok = next.(map[string]any); !ok {
+			return nil, fmt.Errorf("key %s is already a value", key)
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,208 @@
+package koo_test
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"koo"
+	"koo/kootest"
+)
+
+var localeFS = fstest.MapFS{
+	"locales/en.json": {Data: []byte(`{
+		"hello": "hello, %s",
+		"user": {"login": "login"},
+		"apples": {"one": "%d apple", "other": "%d apples"}
+	}`)},
+	"locales/messages.zh.toml": {Data: []byte(`
+# 中文
+hello = "你好，%s"
+apples = '%d 个苹果'
+
+[user]
+login = "登录"
+`)},
+	"locales/fr.json": {Data: []byte(`{"apples": {"one": "%d pomme", "other": "%d pommes"}}`)},
+	"locales/ru.json": {Data: []byte(`{"apples": {"one": "%d яблоко", "few": "%d яблока", "many": "%d яблок", "other": "%d яблока"}}`)},
+}
+
+func newBundle(t *testing.T) *koo.Bundle {
+	t.Helper()
+	bundle := koo.NewBundle("en")
+	if err := bundle.LoadFS(localeFS, "locales/*.json", "locales/*.toml"); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestBundle(t *testing.T) {
+	bundle := newBundle(t)
+	if got, want := bundle.Languages(), []string{"en", "fr", "ru", "zh"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Languages = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		lang string
+		key  string
+		args []any
+		want string
+	}{
+		{"en", "hello", []any{"koo"}, "hello, koo"},
+		{"zh", "hello", []any{"koo"}, "你好，koo"},
+		{"zh", "user.login", nil, "登录"},
+		{"en", "user.login", nil, "login"},
+		{"en", "missing", nil, "missing"},
+		// 复数
+		{"en", "apples", []any{1}, "1 apple"},
+		{"en", "apples", []any{int64(2)}, "2 apples"},
+		{"fr", "apples", []any{0}, "0 pomme"},
+		{"fr", "apples", []any{2}, "2 pommes"},
+		{"ru", "apples", []any{1}, "1 яблоко"},
+		{"ru", "apples", []any{3}, "3 яблока"},
+		{"ru", "apples", []any{11}, "11 яблок"},
+		{"ru", "apples", []any{22}, "22 яблока"},
+		{"ru", "apples", []any{25}, "25 яблок"},
+		{"zh", "apples", []any{1}, "1 个苹果"},
+		// 回退：zh-CN -> zh -> en，fr 没有的消息使用默认语言
+		{"zh_cn", "hello", []any{"koo"}, "你好，koo"},
+		{"fr", "user.login", nil, "login"},
+		{"de", "hello", []any{"koo"}, "hello, koo"},
+	}
+	for _, tt := range tests {
+		if got := bundle.T(tt.lang, tt.key, tt.args...); got != tt.want {
+			t.Errorf("T(%s, %s, %v) = %q, want %q", tt.lang, tt.key, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestBundleFallback(t *testing.T) {
+	bundle := newBundle(t)
+	if err := bundle.AddMessages("zh-Hant", map[string]any{"user": map[string]any{"login": "登入"}}); err != nil {
+		t.Fatal(err)
+	}
+	bundle.SetFallback("zh-TW", "zh-Hant", "zh")
+	if got := bundle.T("zh-TW", "user.login"); got != "登入" {
+		t.Errorf("T(zh-TW, user.login) = %q, want 登入", got)
+	}
+	if got := bundle.T("zh-TW", "hello", "koo"); got != "你好，koo" {
+		t.Errorf("T(zh-TW, hello) = %q, want 你好，koo", got)
+	}
+
+	bundle.SetPluralRule("en", func(n int) string { return "other" })
+	if got := bundle.T("en", "apples", 1); got != "1 apples" {
+		t.Errorf("T with a custom plural rule = %q, want 1 apples", got)
+	}
+}
+
+func TestBundleErrors(t *testing.T) {
+	bundle := koo.NewBundle("en")
+	if err := bundle.AddMessages("en", map[string]any{"n": 1}); err == nil {
+		t.Error("AddMessages with a number succeeded")
+	}
+	bad := fstest.MapFS{
+		"en.yaml": {Data: []byte(`hello: hi`)},
+		"en.json": {Data: []byte(`{`)},
+		"zh.toml": {Data: []byte(`hello = "unterminated`)},
+		"fr.toml": {Data: []byte(`[table`)},
+		"ru.toml": {Data: []byte(`hello "no equals"`)},
+		"ja.toml": {Data: []byte(`hello = "x" trailing`)},
+	}
+	for name := range bad {
+		if err := bundle.LoadFS(bad, name); err == nil {
+			t.Errorf("LoadFS(%s) succeeded", name)
+		}
+	}
+}
+
+func TestI18n(t *testing.T) {
+	r := koo.New()
+	r.Use(koo.I18n(newBundle(t), koo.I18nOptions{RememberQuery: true}))
+	r.GET("/", func(c *koo.Context) {
+		c.String(http.StatusOK, "%s %s", c.Locale(), c.T("hello", "koo"))
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		accept string
+		want   string
+	}{
+		{"default", "", "", "", "en hello, koo"},
+		{"accept", "", "", "ja,zh-CN;q=0.9,en;q=0.8", "zh-CN 你好，koo"},
+		{"accept q", "", "", "en;q=0.5,zh;q=0.9", "zh 你好，koo"},
+		{"accept zero", "", "", "zh;q=0,de", "en hello, koo"},
+		{"cookie", "", "zh", "en", "zh 你好，koo"},
+		{"query", "zh", "en", "en", "zh 你好，koo"},
+		{"unsupported query", "ja", "", "zh", "zh 你好，koo"},
+	}
+	for _, tt := range tests {
+		req := kootest.NewRequest(r).GET("/")
+		if tt.query != "" {
+			req.WithQuery("lang", tt.query)
+		}
+		if tt.cookie != "" {
+			req.WithCookie(&http.Cookie{Name: "lang", Value: tt.cookie})
+		}
+		if tt.accept != "" {
+			req.WithHeader("Accept-Language", tt.accept)
+		}
+		rec := req.Do().AssertBody(t, tt.want)
+
+		// 只有通过 query 选中的语言才写入 cookie
+		remembered := len(rec.Result().Cookies()) > 0
+		if want := tt.name == "query"; remembered != want {
+			t.Errorf("%s: cookie set = %t, want %t", tt.name, remembered, want)
+		}
+	}
+}
+
+func TestI18nWithoutMiddleware(t *testing.T) {
+	r := koo.New()
+	r.GET("/", func(c *koo.Context) { c.String(http.StatusOK, "[%s] %s", c.Locale(), c.T("hello")) })
+	kootest.NewRequest(r).GET("/").Do().AssertBody(t, "[] hello")
+}
+
+func TestI18nFuncMap(t *testing.T) {
+	// 没有绑定到请求时使用默认语言
+	tmpl := template.Must(template.New("").Funcs(newBundle(t).FuncMap()).Parse(`{{ T "apples" .n }}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, koo.H{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "3 apples" {
+		t.Fatalf("template = %q, want 3 apples", buf.String())
+	}
+}
+
+func TestI18nHTML(t *testing.T) {
+	bundle := newBundle(t)
+	r := koo.New()
+	r.SetFuncMap(bundle.FuncMap())
+	if err := r.LoadHTMLFS(fstest.MapFS{"hello.tmpl": {Data: []byte(`{{ T "hello" .name }}`)}}, "*.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(koo.I18n(bundle, koo.I18nOptions{}), koo.CacheResponse(time.Minute, nil))
+	r.GET("/", func(c *koo.Context) { c.HTML(http.StatusOK, "hello.tmpl", koo.H{"name": "koo"}) })
+
+	// 模板中的 T 使用当前请求的语言，Vary 让 CacheResponse 为每种语言分别缓存
+	for i := 0; i < 2; i++ {
+		kootest.NewRequest(r).GET("/").WithHeader("Accept-Language", "zh").Do().
+			AssertBody(t, "你好，koo").AssertHeader(t, "Vary", "Accept-Language, Cookie")
+		kootest.NewRequest(r).GET("/").WithHeader("Accept-Language", "en").Do().AssertBody(t, "hello, koo")
+	}
+}
+
+func TestSetFallbackCopiesChain(t *testing.T) {
+	bundle := newBundle(t)
+	chain := []string{"zh_cn", "en"}
+	bundle.SetFallback("zh-TW", chain...)
+	if chain[0] != "zh_cn" {
+		t.Fatalf("SetFallback modified the caller's slice: %v", chain)
+	}
+}
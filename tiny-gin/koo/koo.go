@@ -2,6 +2,7 @@ package koo
 
 import (
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"path"
@@ -23,9 +24,13 @@ type (
 	Engine struct {
 		*RouterGroup
 		router        *router
-		groups        []*RouterGroup     // store all groups
-		htmlTemplates *template.Template // for html render
-		funcMap       template.FuncMap   // for html render 1   fefewfewfe
+		groups        []*RouterGroup   // store all groups
+		routes        []*RouteInfo     // store all routes, for OpenAPI
+		openAPIInfo   OpenAPIInfo      // for OpenAPI
+		htmlRender    HTMLRender       // for html render
+		htmlTemplates *HTMLTemplates   // default html render, created lazily
+		funcMap       template.FuncMap // for html render
+		debug         bool             // reload html templates when files change
 	}
 )
 
@@ -62,20 +67,76 @@ func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+// AddRoute 和 Handle 相同，但是 pattern 中的约束不是合法的正则表达式时返回错误
+func (group *RouterGroup) AddRoute(method string, comp string, handler HandlerFunc) (*RouteInfo, error) {
 	pattern := group.prefix + comp
+	if err := group.engine.router.addRoute(method, pattern, handler); err != nil {
+		return nil, err
+	}
 	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	route := &RouteInfo{Method: method, Pattern: pattern}
+	group.engine.routes = append(group.engine.routes, route)
+	return route, nil
+}
+
+// addRoute 和 AddRoute 相同，但是 pattern 不合法时 panic，GET、POST 等方法都使用它注册路由
+func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) *RouteInfo {
+	route, err := group.AddRoute(method, comp, handler)
+	if err != nil {
+		panic(err)
+	}
+	return route
 }
 
 // GET defines the method to add GET request
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+// the returned RouteInfo can be used to describe the route for OpenAPI
+func (group *RouterGroup) GET(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("GET", pattern, handler)
 }
 
 // POST defines the method to add POST request
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) POST(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("POST", pattern, handler)
+}
+
+// PUT defines the method to add PUT request
+func (group *RouterGroup) PUT(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("PUT", pattern, handler)
+}
+
+// PATCH defines the method to add PATCH request
+func (group *RouterGroup) PATCH(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("PATCH", pattern, handler)
+}
+
+// DELETE defines the method to add DELETE request
+func (group *RouterGroup) DELETE(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("DELETE", pattern, handler)
+}
+
+// HEAD defines the method to add HEAD request
+func (group *RouterGroup) HEAD(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("HEAD", pattern, handler)
+}
+
+// OPTIONS defines the method to add OPTIONS request
+func (group *RouterGroup) OPTIONS(pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute("OPTIONS", pattern, handler)
+}
+
+// Handle defines the method to add request with any http method
+func (group *RouterGroup) Handle(method string, pattern string, handler HandlerFunc) *RouteInfo {
+	return group.addRoute(method, pattern, handler)
+}
+
+// anyMethods are the methods registered by Any
+var anyMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// Any registers the handler for all common http methods
+func (group *RouterGroup) Any(pattern string, handler HandlerFunc) {
+	for _, method := range anyMethods {
+		group.addRoute(method, pattern, handler)
+	}
 }
 
 // create static handler
@@ -103,12 +164,54 @@ func (group *RouterGroup) Static(relativePath string, root string) {
 }
 
 // for custom render function
+// should be called before templates are loaded, debug mode also uses it on reload
+// can be called more than once, e.g. SetFuncMap(CSRFFuncMap(opts)), funcs are merged
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
-	engine.funcMap = funcMap
+	if engine.funcMap == nil {
+		engine.funcMap = template.FuncMap{}
+	}
+	for name, fn := range funcMap {
+		engine.funcMap[name] = fn
+	}
+	if engine.htmlTemplates != nil {
+		engine.htmlTemplates.SetFuncMap(engine.funcMap)
+	}
+}
+
+// SetDebug turns on debug mode, html templates are re-parsed when files change
+func (engine *Engine) SetDebug(debug bool) {
+	engine.debug = debug
+	if engine.htmlTemplates != nil {
+		engine.htmlTemplates.SetDebug(debug)
+	}
+}
+
+// SetHTMLRender replaces the default HTMLTemplates used by c.HTML
+func (engine *Engine) SetHTMLRender(render HTMLRender) {
+	engine.htmlRender = render
+}
+
+// HTMLTemplates returns the default html render, use it to add named template sets
+func (engine *Engine) HTMLTemplates() *HTMLTemplates {
+	if engine.htmlTemplates == nil {
+		engine.htmlTemplates = NewHTMLTemplates()
+		engine.htmlTemplates.SetFuncMap(engine.funcMap)
+		engine.htmlTemplates.SetDebug(engine.debug)
+		if engine.htmlRender == nil {
+			engine.htmlRender = engine.htmlTemplates
+		}
+	}
+	return engine.htmlTemplates
+}
+
+// LoadHTMLGlob loads the default template set from local files
+func (engine *Engine) LoadHTMLGlob(pattern string) error {
+	return engine.HTMLTemplates().LoadGlob(pattern)
 }
 
-func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+// LoadHTMLFS loads the default template set from fsys, e.g. an embed.FS
+func (engine *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) error {
+	return engine.HTMLTemplates().LoadFS(fsys, patterns...)
 }
 
 // Run defines the method to start a http server
@@ -0,0 +1,90 @@
+package koo_test
+
+import (
+	"net/http"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+func methodHandler(c *koo.Context) {
+	c.String(http.StatusOK, "%s %s", c.Method, c.Param("id"))
+}
+
+func TestRouteMethods(t *testing.T) {
+	r := koo.New()
+	v1 := r.Group("/v1")
+	register := map[string]func(string, koo.HandlerFunc) *koo.RouteInfo{
+		http.MethodGet:     v1.GET,
+		http.MethodPost:    v1.POST,
+		http.MethodPut:     v1.PUT,
+		http.MethodPatch:   v1.PATCH,
+		http.MethodDelete:  v1.DELETE,
+		http.MethodHead:    v1.HEAD,
+		http.MethodOptions: v1.OPTIONS,
+	}
+	for method, add := range register {
+		add("/"+method+"/:id", methodHandler)
+	}
+
+	for method := range register {
+		for other := range register {
+			rec := kootest.NewRequest(r).Method(other, "/v1/"+method+"/7").Do()
+			if other == method {
+				rec.AssertStatus(t, http.StatusOK).AssertBody(t, method+" 7")
+			} else {
+				rec.AssertStatus(t, http.StatusNotFound)
+			}
+		}
+	}
+}
+
+func TestRouteHandle(t *testing.T) {
+	r := koo.New()
+	r.Handle("PROPFIND", "/dav/:id", methodHandler)
+	kootest.NewRequest(r).Method("PROPFIND", "/dav/1").Do().AssertBody(t, "PROPFIND 1")
+	kootest.NewRequest(r).GET("/dav/1").Do().AssertStatus(t, http.StatusNotFound)
+
+	var routes []string
+	for _, route := range r.Routes() {
+		routes = append(routes, route.Method+" "+route.Pattern)
+	}
+	if len(routes) != 1 || routes[0] != "PROPFIND /dav/:id" {
+		t.Fatalf("Routes = %v, want [PROPFIND /dav/:id]", routes)
+	}
+}
+
+func TestRouteAny(t *testing.T) {
+	r := koo.New()
+	r.Any("/any/:id", methodHandler)
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"} {
+		kootest.NewRequest(r).Method(method, "/any/2").Do().AssertStatus(t, http.StatusOK).AssertBody(t, method+" 2")
+	}
+	kootest.NewRequest(r).Method("PROPFIND", "/any/2").Do().AssertStatus(t, http.StatusNotFound)
+	if n := len(r.Routes()); n != 7 {
+		t.Fatalf("Any registered %d routes, want 7", n)
+	}
+}
+
+func TestAddRouteInvalidConstraint(t *testing.T) {
+	r := koo.New()
+	if _, err := r.AddRoute("GET", "/user/{id:[0-9+}", methodHandler); err == nil {
+		t.Fatal("AddRoute accepted an invalid regexp")
+	}
+	if n := len(r.Routes()); n != 0 {
+		t.Fatalf("AddRoute with an invalid regexp registered %d routes", n)
+	}
+	route, err := r.AddRoute("GET", "/user/{id:[0-9]+}", methodHandler)
+	if err != nil || route.Pattern != "/user/{id:[0-9]+}" {
+		t.Fatalf("AddRoute = %v, %v", route, err)
+	}
+	kootest.NewRequest(r).GET("/user/7").Do().AssertBody(t, "GET 7")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("GET with an invalid regexp did not panic")
+		}
+	}()
+	r.GET("/bad/{id:(}", methodHandler)
+}
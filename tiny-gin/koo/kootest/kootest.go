@@ -0,0 +1,243 @@
+package kootest
+
+/*
+
+kootest 在进程内测试 koo 的 handler，不需要启动 httptest.Server
+
+	rec := kootest.NewRequest(engine).
+		POST("/login").
+		WithJSON(koo.H{"username": "fengwei"}).
+		WithHeader("X-Token", "abc").
+		Do()
+	rec.AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "Content-Type", "application/json").
+		AssertJSON(t, "data.username", "fengwei")
+
+单独测试一个中间件时，使用 CreateTestContext 构造 Context，next 作为中间件中 c.Next() 调用的处理链
+
+	w := httptest.NewRecorder()
+	c, _ := kootest.CreateTestContext(w, func(c *koo.Context) { called = true })
+	koo.Logger()(c)
+
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"koo"
+)
+
+// Request 是一个待发送给 engine 的请求，使用链式调用构造
+type Request struct {
+	engine  *koo.Engine
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    io.Reader
+}
+
+// NewRequest 创建一个发送给 engine 的请求，默认是 GET /
+func NewRequest(engine *koo.Engine) *Request {
+	return &Request{
+		engine: engine,
+		method: http.MethodGet,
+		path:   "/",
+		header: make(http.Header),
+		query:  make(url.Values),
+	}
+}
+
+// Method 设置请求的方法和路径，path 中可以带有 query
+func (r *Request) Method(method string, path string) *Request {
+	r.method = method
+	r.path = path
+	return r
+}
+
+// GET defines a GET request
+func (r *Request) GET(path string) *Request { return r.Method(http.MethodGet, path) }
+
+// POST defines a POST request
+func (r *Request) POST(path string) *Request { return r.Method(http.MethodPost, path) }
+
+// PUT defines a PUT request
+func (r *Request) PUT(path string) *Request { return r.Method(http.MethodPut, path) }
+
+// PATCH defines a PATCH request
+func (r *Request) PATCH(path string) *Request { return r.Method(http.MethodPatch, path) }
+
+// DELETE defines a DELETE request
+func (r *Request) DELETE(path string) *Request { return r.Method(http.MethodDelete, path) }
+
+// WithHeader 设置一个请求头
+func (r *Request) WithHeader(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery 添加一个 query 参数
+func (r *Request) WithQuery(key string, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithCookie 添加一个 cookie
+func (r *Request) WithCookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// WithBody 设置请求体和对应的 Content-Type
+func (r *Request) WithBody(contentType string, body io.Reader) *Request {
+	r.header.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+// WithJSON 将 body 编码为 JSON 作为请求体，编码失败会 panic
+func (r *Request) WithJSON(body any) *Request {
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic("kootest: encode json body: " + err.Error())
+	}
+	return r.WithBody("application/json", bytes.NewReader(data))
+}
+
+// WithForm 将 form 编码为 application/x-www-form-urlencoded 请求体
+func (r *Request) WithForm(form url.Values) *Request {
+	return r.WithBody("application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
+
+// Do 将请求直接交给 engine.ServeHTTP 处理，返回记录了响应的 Recorder
+func (r *Request) Do() *Recorder {
+	req := httptest.NewRequest(r.method, r.path, r.body)
+	if len(r.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range r.query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+		req.RequestURI = req.URL.RequestURI()
+	}
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+
+	rec := &Recorder{ResponseRecorder: httptest.NewRecorder()}
+	r.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// Recorder 记录 handler 的响应，并提供断言方法
+// 断言失败时调用 t.Errorf，方法返回 Recorder 本身，方便链式调用
+type Recorder struct {
+	*httptest.ResponseRecorder
+}
+
+// JSON 将响应体解码到 v 中
+func (r *Recorder) JSON(v any) error {
+	return json.Unmarshal(r.Body.Bytes(), v)
+}
+
+// JSONPath 返回响应体中 path 对应的值，path 使用 . 分隔，数组使用下标
+// 例如 "data.items.0.name"，空 path 返回整个响应体
+func (r *Recorder) JSONPath(path string) (any, error) {
+	var value any
+	if err := r.JSON(&value); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return value, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("kootest: json path %s: key %q not found", path, key)
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("kootest: json path %s: bad index %q", path, key)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("kootest: json path %s: %q is not an object or array", path, key)
+		}
+	}
+	return value, nil
+}
+
+// AssertStatus 断言响应的状态码
+func (r *Recorder) AssertStatus(t testing.TB, code int) *Recorder {
+	t.Helper()
+	if r.Code != code {
+		t.Errorf("status = %d, want %d, body: %s", r.Code, code, r.Body.String())
+	}
+	return r
+}
+
+// AssertHeader 断言响应头的值
+func (r *Recorder) AssertHeader(t testing.TB, key string, want string) *Recorder {
+	t.Helper()
+	if got := r.Header().Get(key); got != want {
+		t.Errorf("header %s = %q, want %q", key, got, want)
+	}
+	return r
+}
+
+// AssertBody 断言响应体的内容
+func (r *Recorder) AssertBody(t testing.TB, want string) *Recorder {
+	t.Helper()
+	if got := r.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	return r
+}
+
+// AssertJSON 断言响应体中 path 对应的值
+// want 会先经过一次 JSON 编解码，所以 1 和 float64(1) 被认为相等
+func (r *Recorder) AssertJSON(t testing.TB, path string, want any) *Recorder {
+	t.Helper()
+	got, err := r.JSONPath(path)
+	if err != nil {
+		t.Errorf("%v, body: %s", err, r.Body.String())
+		return r
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Errorf("kootest: encode want: %v", err)
+		return r
+	}
+	var normalized any
+	_ = json.Unmarshal(data, &normalized)
+	if !reflect.DeepEqual(got, normalized) {
+		t.Errorf("json %s = %v, want %v", path, got, want)
+	}
+	return r
+}
+
+// CreateTestContext 创建一个 GET / 的 Context，用于单独测试一个中间件
+// next 是中间件调用 c.Next() 时执行的处理链，c.Req 等字段可以直接修改
+func CreateTestContext(w http.ResponseWriter, next ...koo.HandlerFunc) (*koo.Context, *koo.Engine) {
+	engine := koo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	return engine.NewContext(w, req, next...), engine
+}
@@ -0,0 +1,181 @@
+package kootest_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+// echo 将请求的内容原样返回
+func echo(c *koo.Context) {
+	body, _ := io.ReadAll(c.Req.Body)
+	var cookie string
+	if sid, err := c.Req.Cookie("sid"); err == nil {
+		cookie = sid.Value
+	}
+	c.JSON(http.StatusOK, koo.H{
+		"method":      c.Method,
+		"path":        c.Path,
+		"query":       c.Req.URL.Query(),
+		"token":       c.Req.Header.Get("X-Token"),
+		"contentType": c.Req.Header.Get("Content-Type"),
+		"cookie":      cookie,
+		"body":        string(body),
+	})
+}
+
+func newEngine() *koo.Engine {
+	r := koo.New()
+	r.GET("/echo", echo)
+	r.POST("/echo", echo)
+	r.GET("/items", func(c *koo.Context) {
+		c.JSON(http.StatusOK, koo.H{"data": koo.H{"items": []koo.H{{"name": "a"}, {"name": "b"}}, "total": 2}})
+	})
+	return r
+}
+
+func TestRequest(t *testing.T) {
+	r := newEngine()
+	kootest.NewRequest(r).GET("/echo?a=1").
+		WithQuery("a", "2").
+		WithQuery("b", "3").
+		WithHeader("X-Token", "abc").
+		WithCookie(&http.Cookie{Name: "sid", Value: "s1"}).
+		Do().
+		AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "Content-Type", "application/json").
+		AssertJSON(t, "method", "GET").
+		AssertJSON(t, "path", "/echo").
+		AssertJSON(t, "query", url.Values{"a": {"1", "2"}, "b": {"3"}}).
+		AssertJSON(t, "token", "abc").
+		AssertJSON(t, "cookie", "s1")
+
+	kootest.NewRequest(r).POST("/echo").WithJSON(koo.H{"name": "fengwei"}).Do().
+		AssertJSON(t, "method", "POST").
+		AssertJSON(t, "contentType", "application/json").
+		AssertJSON(t, "body", `{"name":"fengwei"}`)
+	kootest.NewRequest(r).POST("/echo").WithForm(url.Values{"name": {"fengwei"}}).Do().
+		AssertJSON(t, "contentType", "application/x-www-form-urlencoded").
+		AssertJSON(t, "body", "name=fengwei")
+	// 没有注册的方法返回 404
+	for _, req := range []*kootest.Request{
+		kootest.NewRequest(r).PUT("/echo"),
+		kootest.NewRequest(r).PATCH("/echo"),
+		kootest.NewRequest(r).DELETE("/echo"),
+	} {
+		req.Do().AssertStatus(t, http.StatusNotFound)
+	}
+}
+
+func TestWithJSONPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithJSON with an unencodable body did not panic")
+		}
+	}()
+	kootest.NewRequest(newEngine()).WithJSON(make(chan int))
+}
+
+func TestJSONPath(t *testing.T) {
+	rec := kootest.NewRequest(newEngine()).GET("/items").Do()
+	tests := []struct {
+		path string
+		want any
+		err  bool
+	}{
+		{path: "data.total", want: float64(2)},
+		{path: "data.items.1.name", want: "b"},
+		{path: "data.items.2", err: true},
+		{path: "data.items.x", err: true},
+		{path: "data.missing", err: true},
+		{path: "data.total.x", err: true},
+	}
+	for _, tt := range tests {
+		got, err := rec.JSONPath(tt.path)
+		if (err != nil) != tt.err || (!tt.err && got != tt.want) {
+			t.Errorf("JSONPath(%s) = %v, %v, want %v, error %t", tt.path, got, err, tt.want, tt.err)
+		}
+	}
+	if root, err := rec.JSONPath(""); err != nil || root.(map[string]any)["data"] == nil {
+		t.Errorf("JSONPath(\"\") = %v, %v", root, err)
+	}
+
+	var v struct {
+		Data struct{ Total int }
+	}
+	if err := rec.JSON(&v); err != nil || v.Data.Total != 2 {
+		t.Errorf("JSON = %+v, %v", v, err)
+	}
+}
+
+// fakeTB 记录断言失败的信息，用来测试断言本身
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertions(t *testing.T) {
+	rec := kootest.NewRequest(newEngine()).GET("/items").Do()
+	tests := []struct {
+		name   string
+		assert func(tb testing.TB)
+		fail   bool
+	}{
+		{"status", func(tb testing.TB) { rec.AssertStatus(tb, http.StatusOK) }, false},
+		{"wrong status", func(tb testing.TB) { rec.AssertStatus(tb, http.StatusCreated) }, true},
+		{"header", func(tb testing.TB) { rec.AssertHeader(tb, "Content-Type", "application/json") }, false},
+		{"wrong header", func(tb testing.TB) { rec.AssertHeader(tb, "Content-Type", "text/plain") }, true},
+		{"body", func(tb testing.TB) { rec.AssertBody(tb, rec.Body.String()) }, false},
+		{"wrong body", func(tb testing.TB) { rec.AssertBody(tb, "") }, true},
+		{"json", func(tb testing.TB) { rec.AssertJSON(tb, "data.total", 2) }, false},
+		{"json object", func(tb testing.TB) { rec.AssertJSON(tb, "data.items.0", koo.H{"name": "a"}) }, false},
+		{"wrong json", func(tb testing.TB) { rec.AssertJSON(tb, "data.total", 3) }, true},
+		{"missing json", func(tb testing.TB) { rec.AssertJSON(tb, "data.missing", nil) }, true},
+		{"unencodable want", func(tb testing.TB) { rec.AssertJSON(tb, "data.total", make(chan int)) }, true},
+	}
+	for _, tt := range tests {
+		tb := &fakeTB{TB: t}
+		tt.assert(tb)
+		if failed := len(tb.errors) > 0; failed != tt.fail {
+			t.Errorf("%s: failed = %t, want %t, errors: %v", tt.name, failed, tt.fail, tb.errors)
+		}
+	}
+}
+
+func TestCreateTestContext(t *testing.T) {
+	var called []string
+	w := httptest.NewRecorder()
+	c, engine := kootest.CreateTestContext(w,
+		func(c *koo.Context) { called = append(called, "a") },
+		func(c *koo.Context) { called = append(called, "b"); c.String(http.StatusTeapot, "next") },
+	)
+	if engine == nil || c.Method != http.MethodGet || c.Path != "/" {
+		t.Fatalf("context = %s %s, engine = %v", c.Method, c.Path, engine)
+	}
+
+	// 中间件调用 c.Next() 时执行 next
+	middleware := func(c *koo.Context) {
+		called = append(called, "before")
+		c.Next()
+		called = append(called, "after")
+	}
+	middleware(c)
+	if fmt.Sprint(called) != "[before a b after]" {
+		t.Fatalf("called = %v", called)
+	}
+	if w.Code != http.StatusTeapot || w.Body.String() != "next" {
+		t.Fatalf("response = %d %q", w.Code, w.Body.String())
+	}
+}
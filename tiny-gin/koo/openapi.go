@@ -0,0 +1,525 @@
+package koo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+根据注册的路由生成 OpenAPI 3.0 文档
+
+注册路由时可以附加描述信息：
+
+	r.GET("/user/{id:int}", getUser).
+		Summary("get a user").
+		Tags("user").
+		Response(http.StatusOK, User{})
+	r.POST("/user", createUser).
+		Request(CreateUserReq{}).
+		Response(http.StatusCreated, User{})
+	r.Docs("/openapi.json") // 以 .yaml 或者 .yml 结尾时返回 YAML
+
+结构体的字段通过 tag 生成参数和 schema：
+
+	json:"name"          请求体和响应体中的字段，json:"-" 的字段被忽略
+	query:"page"         query 参数，form 和 query 相同
+	header:"X-Token"     header 参数
+	binding:"required"   必填字段
+	doc:"..."            字段的描述
+
+路径参数从 pattern 中解析，{id:int} 这样的约束会生成对应的类型
+
+*/
+
+// RouteInfo 是一条已经注册的路由，附加的描述信息用于生成 OpenAPI 文档
+type RouteInfo struct {
+	Method  string
+	Pattern string
+
+	summary     string
+	description string
+	tags        []string
+	request     reflect.Type
+	responses   map[int]reflect.Type
+	hidden      bool
+}
+
+// Summary 设置路由的简介
+func (r *RouteInfo) Summary(summary string) *RouteInfo {
+	r.summary = summary
+	return r
+}
+
+// Description 设置路由的详细描述
+func (r *RouteInfo) Description(description string) *RouteInfo {
+	r.description = description
+	return r
+}
+
+// Tags 设置路由的分组标签
+func (r *RouteInfo) Tags(tags ...string) *RouteInfo {
+	r.tags = append(r.tags, tags...)
+	return r
+}
+
+// Request 设置请求的结构体类型，传入零值即可，例如 Request(CreateUserReq{})
+func (r *RouteInfo) Request(v any) *RouteInfo {
+	r.request = reflect.TypeOf(v)
+	return r
+}
+
+// Response 设置 code 对应的响应体类型，v 为 nil 表示没有响应体
+func (r *RouteInfo) Response(code int, v any) *RouteInfo {
+	if r.responses == nil {
+		r.responses = make(map[int]reflect.Type)
+	}
+	r.responses[code] = reflect.TypeOf(v)
+	return r
+}
+
+// Hidden 不在 OpenAPI 文档中显示这条路由
+func (r *RouteInfo) Hidden() *RouteInfo {
+	r.hidden = true
+	return r
+}
+
+// Routes 返回所有注册的路由
+func (engine *Engine) Routes() []*RouteInfo {
+	return engine.routes
+}
+
+// OpenAPIInfo 是 OpenAPI 文档的 info 部分
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// SetOpenAPIInfo 设置 OpenAPI 文档的标题，版本和描述
+func (engine *Engine) SetOpenAPIInfo(info OpenAPIInfo) {
+	engine.openAPIInfo = info
+}
+
+// Docs 注册一个 GET 路由返回 OpenAPI 文档，path 以 .yaml 或者 .yml 结尾时返回 YAML，否则返回 JSON
+// 文档在每次请求时根据当前的路由生成
+func (group *RouterGroup) Docs(path string) {
+	engine := group.engine
+	yaml := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	group.GET(path, func(c *Context) {
+		var data []byte
+		var err error
+		if yaml {
+			data, err = engine.OpenAPIYAML()
+			c.SetHeader("Content-Type", "application/yaml")
+		} else {
+			data, err = engine.OpenAPIJSON()
+			c.SetHeader("Content-Type", "application/json")
+		}
+		if err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Data(http.StatusOK, data)
+	}).Hidden()
+}
+
+// OpenAPIJSON 返回 JSON 格式的 OpenAPI 文档
+func (engine *Engine) OpenAPIJSON() ([]byte, error) {
+	return json.MarshalIndent(engine.OpenAPI(), "", "  ")
+}
+
+// OpenAPIYAML 返回 YAML 格式的 OpenAPI 文档
+func (engine *Engine) OpenAPIYAML() ([]byte, error) {
+	data, err := json.Marshal(engine.OpenAPI())
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAML(&buf, doc, 0)
+	return buf.Bytes(), nil
+}
+
+// OpenAPI 根据注册的路由生成 OpenAPI 3.0 文档
+func (engine *Engine) OpenAPI() H {
+	info := engine.openAPIInfo
+	if info.Title == "" {
+		info.Title = "koo"
+	}
+	if info.Version == "" {
+		info.Version = "0.0.0"
+	}
+
+	gen := &schemaGenerator{components: H{}}
+	paths := H{}
+	for _, route := range engine.routes {
+		if route.hidden {
+			continue
+		}
+		for _, pattern := range expandOptional(route.Pattern) {
+			path, params := openAPIPath(pattern)
+			item, ok := paths[path].(H)
+			if !ok {
+				item = H{}
+				paths[path] = item
+			}
+			item[strings.ToLower(route.Method)] = gen.operation(route, params)
+		}
+	}
+
+	doc := H{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(gen.components) > 0 {
+		doc["components"] = H{"schemas": gen.components}
+	}
+	return doc
+}
+
+// openAPIPath 将 koo 的 pattern 转换为 OpenAPI 的 path，同时返回路径参数
+// /user/:id/{n:int}/*filepath -> /user/{id}/{n}/{filepath}
+func openAPIPath(pattern string) (string, []H) {
+	parts := parsePattern(pattern)
+	var params []H
+	for i, part := range parts {
+		name, ok := paramName(part)
+		if !ok {
+			continue
+		}
+		schema := H{"type": "string"}
+		if part[0] == '{' {
+			schema = constraintSchema(part)
+		}
+		params = append(params, H{"name": name, "in": "path", "required": true, "schema": schema})
+		parts[i] = "{" + name + "}"
+	}
+	return "/" + strings.Join(parts, "/"), params
+}
+
+// constraintSchema 将 {name:constraint} 中的约束转换为 schema
+func constraintSchema(part string) H {
+	inner := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+	_, expr, _ := strings.Cut(inner, ":")
+	switch expr {
+	case "":
+		return H{"type": "string"}
+	case "int":
+		return H{"type": "integer", "format": "int64"}
+	case "uint":
+		return H{"type": "integer", "format": "int64", "minimum": 0}
+	case "float":
+		return H{"type": "number"}
+	case "bool":
+		return H{"type": "boolean"}
+	case "uuid":
+		return H{"type": "string", "format": "uuid"}
+	case "alpha":
+		return H{"type": "string", "pattern": "^[A-Za-z]+$"}
+	case "alnum":
+		return H{"type": "string", "pattern": "^[A-Za-z0-9]+$"}
+	}
+	paramTypesMu.RLock()
+	_, custom := paramTypes[expr]
+	paramTypesMu.RUnlock()
+	if custom {
+		return H{"type": "string"}
+	}
+	return H{"type": "string", "pattern": "^(?:" + expr + ")$"}
+}
+
+// schemaGenerator 通过反射生成 schema，具名的结构体放到 components 中，通过 $ref 引用
+type schemaGenerator struct {
+	components H
+}
+
+func (g *schemaGenerator) operation(route *RouteInfo, pathParams []H) H {
+	op := H{}
+	if route.summary != "" {
+		op["summary"] = route.summary
+	}
+	if route.description != "" {
+		op["description"] = route.description
+	}
+	if len(route.tags) > 0 {
+		op["tags"] = route.tags
+	}
+
+	params := append([]H{}, pathParams...)
+	if route.request != nil {
+		reqParams, body := g.requestSchema(route.request)
+		params = append(params, reqParams...)
+		if body != nil && route.Method != http.MethodGet && route.Method != http.MethodHead && route.Method != http.MethodDelete {
+			op["requestBody"] = H{
+				"required": true,
+				"content":  H{"application/json": H{"schema": body}},
+			}
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	responses := H{}
+	for code, t := range route.responses {
+		resp := H{"description": http.StatusText(code)}
+		if t != nil {
+			resp["content"] = H{"application/json": H{"schema": g.schema(t)}}
+		}
+		responses[strconv.Itoa(code)] = resp
+	}
+	if len(responses) == 0 {
+		responses["200"] = H{"description": http.StatusText(http.StatusOK)}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// requestSchema 将请求结构体中 query / form / header 的字段转换为参数，其余字段作为请求体
+func (g *schemaGenerator) requestSchema(t reflect.Type) ([]H, H) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, g.schema(t)
+	}
+
+	var params []H
+	hasBody := false
+	for _, field := range structFields(t) {
+		in, name := "", ""
+		if name = tagName(field, "query"); name != "" {
+			in = "query"
+		} else if name = tagName(field, "form"); name != "" {
+			in = "query"
+		} else if name = tagName(field, "header"); name != "" {
+			in = "header"
+		} else if name = tagName(field, "path"); name != "" {
+			continue // 路径参数从 pattern 中解析
+		}
+		if in == "" {
+			hasBody = true
+			continue
+		}
+		param := H{"name": name, "in": in, "schema": g.schema(field.Type)}
+		if required(field) {
+			param["required"] = true
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			param["description"] = doc
+		}
+		params = append(params, param)
+	}
+	if !hasBody {
+		return params, nil
+	}
+	return params, g.bodySchema(t)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema 返回类型 t 的 schema
+func (g *schemaGenerator) schema(t reflect.Type) H {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return H{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return H{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return H{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return H{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return H{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return H{"type": "number", "format": "double"}
+	case reflect.String:
+		return H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return H{"type": "string", "format": "byte"}
+		}
+		return H{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return H{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.bodySchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = H{} // 先占位，防止递归的结构体死循环
+			g.components[name] = g.bodySchema(t)
+		}
+		return H{"$ref": "#/components/schemas/" + name}
+	}
+	return H{}
+}
+
+// bodySchema 返回结构体中 json 字段组成的 object schema
+func (g *schemaGenerator) bodySchema(t reflect.Type) H {
+	properties := H{}
+	var requiredFields []string
+	for _, field := range structFields(t) {
+		if tagName(field, "query") != "" || tagName(field, "form") != "" ||
+			tagName(field, "header") != "" || tagName(field, "path") != "" {
+			continue
+		}
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		prop := g.schema(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			if _, ref := prop["$ref"]; ref {
+				prop = H{"allOf": []H{prop}, "description": doc}
+			} else {
+				prop["description"] = doc
+			}
+		}
+		properties[name] = prop
+		if required(field) {
+			requiredFields = append(requiredFields, name)
+		}
+	}
+	schema := H{"type": "object", "properties": properties}
+	if len(requiredFields) > 0 {
+		sort.Strings(requiredFields)
+		schema["required"] = requiredFields
+	}
+	return schema
+}
+
+// structFields 返回导出的字段，匿名嵌入的结构体展开
+func structFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			fields = append(fields, structFields(field.Type)...)
+			continue
+		}
+		if field.IsExported() {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func tagName(field reflect.StructField, key string) string {
+	name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func required(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+var unsafeSchemaName = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// schemaName 使用类型名作为 components 中的名字，泛型类型的参数部分被替换掉
+func schemaName(t reflect.Type) string {
+	return unsafeSchemaName.ReplaceAllString(t.Name(), "_")
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$-]*$`)
+
+// writeYAML 将 JSON 解码得到的数据写成 YAML，字符串都使用双引号，转义规则和 JSON 兼容
+func writeYAML(buf *bytes.Buffer, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := k
+			if !plainYAMLKey.MatchString(k) {
+				key = strconv.Quote(k)
+			}
+			writeYAMLEntry(buf, pad+key+":", v[k], indent)
+		}
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range v {
+			writeYAMLEntry(buf, pad+"-", item, indent)
+		}
+	default:
+		buf.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLEntry 写入 map 的一项或者数组的一项，标量写在同一行，map 和数组换行缩进
+func writeYAMLEntry(buf *bytes.Buffer, prefix string, v any, indent int) {
+	switch child := v.(type) {
+	case map[string]any:
+		if len(child) == 0 {
+			buf.WriteString(prefix + " {}\n")
+			return
+		}
+		buf.WriteString(prefix + "\n")
+		writeYAML(buf, child, indent+1)
+	case []any:
+		if len(child) == 0 {
+			buf.WriteString(prefix + " []\n")
+			return
+		}
+		buf.WriteString(prefix + "\n")
+		writeYAML(buf, child, indent+1)
+	default:
+		buf.WriteString(prefix + " " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
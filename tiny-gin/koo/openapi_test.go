@@ -0,0 +1,148 @@
+package koo_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+type docUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name" doc:"user name"`
+}
+
+type docCreateUser struct {
+	Token string `header:"X-Token" binding:"required"`
+	Dry   bool   `query:"dry"`
+	Name  string `json:"name" binding:"required"`
+	Skip  string `json:"-"`
+}
+
+func newDocEngine() *koo.Engine {
+	r := koo.New()
+	r.SetOpenAPIInfo(koo.OpenAPIInfo{Title: "users", Version: "1.0.0"})
+	noop := func(c *koo.Context) {}
+	r.GET("/user/{id:int}", noop).
+		Summary("get a user").
+		Tags("user").
+		Response(http.StatusOK, docUser{})
+	r.POST("/user", noop).
+		Request(docCreateUser{}).
+		Response(http.StatusCreated, docUser{}).
+		Response(http.StatusBadRequest, nil)
+	r.GET("/files/:dir/*filepath", noop)
+	r.GET("/internal", noop).Hidden()
+	r.Docs("/openapi.json")
+	r.Docs("/openapi.yaml")
+	return r
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := newDocEngine()
+	rec := kootest.NewRequest(r).GET("/openapi.json").Do().
+		AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "Content-Type", "application/json")
+
+	tests := []struct {
+		path string
+		want any
+	}{
+		{"openapi", "3.0.3"},
+		{"info.title", "users"},
+		{"info.version", "1.0.0"},
+		{"paths./user/{id}.get.summary", "get a user"},
+		{"paths./user/{id}.get.tags", []string{"user"}},
+		{"paths./user/{id}.get.parameters.0", koo.H{"name": "id", "in": "path", "required": true,
+			"schema": koo.H{"type": "integer", "format": "int64"}}},
+		{"paths./user/{id}.get.responses.200.content.application/json.schema.$ref", "#/components/schemas/docUser"},
+		{"paths./user.post.parameters", []koo.H{
+			{"name": "X-Token", "in": "header", "required": true, "schema": koo.H{"type": "string"}},
+			{"name": "dry", "in": "query", "schema": koo.H{"type": "boolean"}},
+		}},
+		{"paths./user.post.requestBody.content.application/json.schema", koo.H{
+			"type":       "object",
+			"properties": koo.H{"name": koo.H{"type": "string"}},
+			"required":   []string{"name"},
+		}},
+		{"paths./user.post.responses.400", koo.H{"description": "Bad Request"}},
+		{"paths./files/{dir}/{filepath}.get.responses.200.description", "OK"},
+		{"components.schemas.docUser.properties.name", koo.H{"type": "string", "description": "user name"}},
+	}
+	for _, tt := range tests {
+		rec.AssertJSON(t, tt.path, tt.want)
+	}
+}
+
+func TestOpenAPIHidden(t *testing.T) {
+	paths := newDocEngine().OpenAPI()["paths"].(koo.H)
+	for _, path := range []string{"/internal", "/openapi.json", "/openapi.yaml"} {
+		if _, ok := paths[path]; ok {
+			t.Errorf("hidden route %s is in the document", path)
+		}
+	}
+	if len(paths) != 3 {
+		t.Errorf("got %d paths, want 3", len(paths))
+	}
+}
+
+func TestOpenAPIConstraints(t *testing.T) {
+	koo.RegisterParamType("docslug", func(s string) bool { return strings.Trim(s, "abcdefghijklmnopqrstuvwxyz-") == "" })
+	r := koo.New()
+	r.GET("/a/{n:uint}/{ok:bool}/{code:[A-Z]{3}}/{slug:docslug}/{opt?}", func(c *koo.Context) {})
+
+	doc := r.OpenAPI()["paths"].(koo.H)
+	// 可选段展开为两条路径
+	if _, ok := doc["/a/{n}/{ok}/{code}/{slug}"]; !ok {
+		t.Fatalf("optional segment is not expanded, paths: %v", doc)
+	}
+	params := doc["/a/{n}/{ok}/{code}/{slug}/{opt}"].(koo.H)["get"].(koo.H)["parameters"].([]koo.H)
+	want := []koo.H{
+		{"type": "integer", "format": "int64", "minimum": 0},
+		{"type": "boolean"},
+		{"type": "string", "pattern": "^(?:[A-Z]{3})$"},
+		{"type": "string"},
+		{"type": "string"},
+	}
+	if len(params) != len(want) {
+		t.Fatalf("got %d parameters, want %d", len(params), len(want))
+	}
+	for i, param := range params {
+		schema := param["schema"].(koo.H)
+		if len(schema) != len(want[i]) {
+			t.Errorf("param %v schema = %v, want %v", param["name"], schema, want[i])
+			continue
+		}
+		for k, v := range want[i] {
+			if schema[k] != v {
+				t.Errorf("param %v schema = %v, want %v", param["name"], schema, want[i])
+				break
+			}
+		}
+	}
+}
+
+func TestOpenAPIYAML(t *testing.T) {
+	r := newDocEngine()
+	rec := kootest.NewRequest(r).GET("/openapi.yaml").Do().
+		AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "Content-Type", "application/yaml")
+	body := rec.Body.String()
+	for _, want := range []string{
+		"openapi: \"3.0.3\"",
+		"  title: \"users\"",
+		"  \"/user/{id}\":",
+		"$ref: \"#/components/schemas/docUser\"",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("yaml does not contain %q:\n%s", want, body)
+		}
+	}
+
+	data, err := r.OpenAPIYAML()
+	if err != nil || string(data) != body {
+		t.Fatalf("OpenAPIYAML differs from the Docs endpoint, err = %v", err)
+	}
+}
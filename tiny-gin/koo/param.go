@@ -0,0 +1,152 @@
+package koo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+
+除了 :name 和 *name 之外，路由参数还支持花括号形式的约束写法：
+
+	/user/{id}                 等价于 /user/:id
+	/user/{id:int}             只匹配整数
+	/file/{name:[a-z]+\.txt}   冒号后面不是已注册的类型名时，按照正则表达式处理（整段匹配）
+	/item/{uuid:uuid}          匹配 UUID
+	/page/{n:int?}             末尾带 ? 表示可选段，/page 和 /page/2 都会命中这个路由
+
+约束不满足时，trie 的 search 会继续尝试下一个候选路由，而不是把请求交给 handler
+因为 parsePattern 使用 / 切分，所以正则中不能出现 /
+正则本身以 ? 结尾时需要用括号包起来，例如 {x:([a-z]?)}，否则会被当成可选段
+
+*/
+
+var (
+	paramTypesMu sync.RWMutex
+	paramTypes   = map[string]func(string) bool{
+		"int":   isInt,
+		"uint":  isUint,
+		"float": isFloat,
+		"bool":  isBool,
+		"alpha": regexp.MustCompile(`^[A-Za-z]+$`).MatchString,
+		"alnum": regexp.MustCompile(`^[A-Za-z0-9]+$`).MatchString,
+		"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	}
+)
+
+// RegisterParamType 注册一个可以在 {name:type} 中使用的约束类型
+// 需要在注册路由之前调用
+func RegisterParamType(name string, match func(string) bool) {
+	paramTypesMu.Lock()
+	defer paramTypesMu.Unlock()
+	paramTypes[name] = match
+}
+
+func isInt(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+func isUint(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func isBool(s string) bool {
+	_, err := strconv.ParseBool(s)
+	return err == nil
+}
+
+// paramSpec 是 {name:constraint} 形式的 part 解析之后的结果
+// match: 约束检查，没有约束时为 nil
+// typed: 约束是已注册的类型名，而不是正则表达式，匹配时优先于正则
+// optional: 末尾带 ? 的可选段
+type paramSpec struct {
+	name     string
+	match    func(string) bool
+	typed    bool
+	optional bool
+}
+
+// splitParam 将 {name:constraint} 形式的 part 拆分为参数名、约束和是否可选，不编译约束
+func splitParam(part string) (name, expr string, optional bool) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+	if strings.HasSuffix(inner, "?") {
+		inner = inner[:len(inner)-1]
+		optional = true
+	}
+	name, expr, _ = strings.Cut(inner, ":")
+	return name, expr, optional
+}
+
+// parseParam 解析 {name:constraint} 形式的 part，约束不是合法的正则表达式时返回错误
+// 只在注册路由的时候调用，编译好的约束保存在 trie 的 node 上
+func parseParam(part string) (paramSpec, error) {
+	var spec paramSpec
+	var expr string
+	spec.name, expr, spec.optional = splitParam(part)
+	if expr == "" {
+		return spec, nil
+	}
+
+	paramTypesMu.RLock()
+	spec.match, spec.typed = paramTypes[expr]
+	paramTypesMu.RUnlock()
+	if !spec.typed {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return spec, fmt.Errorf("koo: invalid constraint in %s: %w", part, err)
+		}
+		spec.match = re.MatchString
+	}
+	return spec, nil
+}
+
+// paramName 返回一个 part 对应的参数名，part 不是参数时返回 false
+func paramName(part string) (string, bool) {
+	switch part[0] {
+	case ':', '*':
+		return part[1:], len(part) > 1
+	case '{':
+		name, _, _ := splitParam(part)
+		return name, true
+	}
+	return "", false
+}
+
+// expandOptional 将含有可选段的 pattern 展开成多个普通 pattern
+// /page/{n:int?} -> /page/{n:int}, /page
+func expandOptional(pattern string) []string {
+	if !strings.Contains(pattern, "?}") {
+		return []string{pattern}
+	}
+
+	variants := [][]string{{}}
+	for _, part := range parsePattern(pattern) {
+		if _, _, optional := splitParam(part); part[0] != '{' || !optional {
+			for i := range variants {
+				variants[i] = append(variants[i], part)
+			}
+			continue
+		}
+		required := strings.TrimSuffix(strings.TrimSuffix(part, "}"), "?") + "}"
+		for i, n := 0, len(variants); i < n; i++ {
+			with := append(append([]string{}, variants[i]...), required)
+			variants = append(variants, with)
+		}
+	}
+
+	patterns := make([]string, 0, len(variants))
+	for _, parts := range variants {
+		patterns = append(patterns, "/"+strings.Join(parts, "/"))
+	}
+	return patterns
+}
@@ -0,0 +1,140 @@
+package koo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		part     string
+		name     string
+		typed    bool
+		regex    bool
+		optional bool
+		accept   []string
+		reject   []string
+	}{
+		{part: "{id}", name: "id"},
+		{part: "{id:}", name: "id"},
+		{part: "{id?}", name: "id", optional: true},
+		{part: "{id:int}", name: "id", typed: true, accept: []string{"42", "-7"}, reject: []string{"4.2", "abc", ""}},
+		{part: "{id:uint}", name: "id", typed: true, accept: []string{"42"}, reject: []string{"-7"}},
+		{part: "{n:int?}", name: "n", typed: true, optional: true, accept: []string{"2"}, reject: []string{"x"}},
+		{part: "{f:float}", name: "f", typed: true, accept: []string{"1.5", "3"}, reject: []string{"1.5x"}},
+		{part: "{b:bool}", name: "b", typed: true, accept: []string{"true", "0"}, reject: []string{"yes"}},
+		{part: "{s:alpha}", name: "s", typed: true, accept: []string{"abc"}, reject: []string{"abc1"}},
+		{part: "{s:alnum}", name: "s", typed: true, accept: []string{"abc1"}, reject: []string{"abc-1"}},
+		{part: "{u:uuid}", name: "u", typed: true, accept: []string{"123e4567-e89b-12d3-a456-426614174000"}, reject: []string{"123e4567"}},
+		{part: `{name:[a-z]+\.txt}`, name: "name", regex: true, accept: []string{"a.txt"}, reject: []string{"a.txt.bak", "A.txt", "xtxt"}},
+		{part: "{x:([a-z]?)}", name: "x", regex: true, accept: []string{"", "a"}, reject: []string{"ab"}},
+		{part: "{x:([a-z]?)?}", name: "x", regex: true, optional: true, accept: []string{"a"}, reject: []string{"ab"}},
+	}
+	for _, tt := range tests {
+		spec, err := parseParam(tt.part)
+		if err != nil {
+			t.Errorf("parseParam(%q): %v", tt.part, err)
+			continue
+		}
+		if spec.name != tt.name || spec.typed != tt.typed || spec.optional != tt.optional {
+			t.Errorf("parseParam(%q) = {name=%q typed=%t optional=%t}, want {name=%q typed=%t optional=%t}",
+				tt.part, spec.name, spec.typed, spec.optional, tt.name, tt.typed, tt.optional)
+		}
+		if constrained := tt.typed || tt.regex; (spec.match != nil) != constrained {
+			t.Errorf("parseParam(%q) has constraint %t, want %t", tt.part, spec.match != nil, constrained)
+			continue
+		}
+		for _, s := range tt.accept {
+			if !spec.match(s) {
+				t.Errorf("parseParam(%q) rejects %q", tt.part, s)
+			}
+		}
+		for _, s := range tt.reject {
+			if spec.match(s) {
+				t.Errorf("parseParam(%q) accepts %q", tt.part, s)
+			}
+		}
+	}
+}
+
+func TestRegisterParamType(t *testing.T) {
+	RegisterParamType("even", func(s string) bool {
+		n := len(s)
+		return n > 0 && (s[n-1]-'0')%2 == 0
+	})
+	spec, err := parseParam("{n:even}")
+	if err != nil || !spec.typed || !spec.match("42") || spec.match("43") {
+		t.Fatalf("registered type even not applied: typed=%t", spec.typed)
+	}
+}
+
+func TestInvalidConstraint(t *testing.T) {
+	if _, err := parseParam("{id:[0-9+}"); err == nil {
+		t.Fatal("parseParam accepted an invalid regexp")
+	}
+
+	r := newRouter()
+	if err := r.addRoute("GET", "/a/{id:(x?}/{n:int?}", nil); err == nil {
+		t.Fatal("addRoute accepted an invalid regexp")
+	}
+	if _, ok := r.roots["GET"]; ok || len(r.handlers) != 0 {
+		t.Fatalf("addRoute with an invalid regexp registered %d routes", len(r.handlers))
+	}
+}
+
+func TestExpandOptional(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/page/:n", []string{"/page/:n"}},
+		{"/page/{n:int?}", []string{"/page", "/page/{n:int}"}},
+		{"/{lang?}/doc", []string{"/doc", "/{lang}/doc"}},
+		{"/a/{b?}/{c:int?}", []string{"/a", "/a/{b}", "/a/{c:int}", "/a/{b}/{c:int}"}},
+	}
+	for _, tt := range tests {
+		if got := expandOptional(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandOptional(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParamInt(t *testing.T) {
+	tests := []struct {
+		params  map[string]string
+		want    int
+		wantErr bool
+	}{
+		{params: map[string]string{"id": "42"}, want: 42},
+		{params: map[string]string{"id": "-1"}, want: -1},
+		{params: map[string]string{"id": "abc"}, wantErr: true},
+		{params: map[string]string{"id": "4.2"}, wantErr: true},
+		{params: map[string]string{"id": ""}, wantErr: true},
+		{params: map[string]string{"id": "99999999999999999999"}, wantErr: true},
+		{params: map[string]string{}, wantErr: true},
+		{params: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		c := &Context{Params: tt.params}
+		got, err := c.ParamInt("id")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParamInt with %v = %d, %v, want %d, error %t", tt.params, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParamTypedErrors(t *testing.T) {
+	c := &Context{Params: map[string]string{"x": "abc"}}
+	if _, err := c.ParamInt64("x"); err == nil {
+		t.Error("ParamInt64 accepted abc")
+	}
+	if _, err := c.ParamFloat64("x"); err == nil {
+		t.Error("ParamFloat64 accepted abc")
+	}
+	if _, err := c.ParamBool("x"); err == nil {
+		t.Error("ParamBool accepted abc")
+	}
+	if _, err := c.ParamInt64("missing"); err == nil {
+		t.Error("ParamInt64 accepted a missing param")
+	}
+}
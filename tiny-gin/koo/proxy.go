@@ -0,0 +1,416 @@
+package koo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+反向代理，可以把 koo 当成一个简单的网关使用：
+
+	api := r.Group("/cache")
+	p := api.Proxy("/", []string{"http://localhost:8001", "http://localhost:8002"}, koo.ProxyOptions{
+		Balancer:        koo.LeastConn(),
+		HealthCheckPath: "/healthz",
+	})
+	defer p.Close() // 停止健康检查
+
+/cache/_cache/scores/Tom 会被转发到某个上游的 /_cache/scores/Tom
+
+- 负载均衡：RoundRobin（默认），Random，LeastConn
+- 主动健康检查：定期请求每个上游的 HealthCheckPath，失败的上游不再被选中，恢复之后重新加入
+- 重试：没有请求体的幂等请求（GET HEAD OPTIONS PUT DELETE）在连接上游失败时换一个上游重试
+- 响应体边收边发，WebSocket 等 Upgrade 请求由 httputil.ReverseProxy 负责双向转发
+
+*/
+
+// ErrNoUpstream 表示没有可用的上游
+var ErrNoUpstream = errors.New("koo: no healthy upstream")
+
+// Upstream 是一个上游服务
+type Upstream struct {
+	URL     *url.URL
+	active  int64 // 正在处理的请求数，LeastConn 使用
+	healthy int32 // 1 表示健康
+}
+
+// Active 返回正在转发给这个上游的请求数
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+// Healthy 返回最近一次健康检查是否成功
+func (u *Upstream) Healthy() bool {
+	return atomic.LoadInt32(&u.healthy) == 1
+}
+
+// Balancer 从可用的上游中选择一个
+type Balancer interface {
+	Next(upstreams []*Upstream) *Upstream
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin 依次选择每个上游
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Next(upstreams []*Upstream) *Upstream {
+	n := atomic.AddUint64(&b.next, 1)
+	return upstreams[(n-1)%uint64(len(upstreams))]
+}
+
+type random struct{}
+
+// Random 随机选择一个上游
+func Random() Balancer {
+	return random{}
+}
+
+func (random) Next(upstreams []*Upstream) *Upstream {
+	return upstreams[rand.Intn(len(upstreams))]
+}
+
+type leastConn struct{}
+
+// LeastConn 选择正在处理的请求最少的上游
+func LeastConn() Balancer {
+	return leastConn{}
+}
+
+func (leastConn) Next(upstreams []*Upstream) *Upstream {
+	best := upstreams[0]
+	for _, u := range upstreams[1:] {
+		if u.Active() < best.Active() {
+			best = u
+		}
+	}
+	return best
+}
+
+// ProxyOptions 是反向代理的配置，零值的字段使用默认值
+type ProxyOptions struct {
+	Balancer            Balancer            // 默认 RoundRobin
+	StripPrefix         string              // 转发之前从请求路径中去掉的前缀
+	Rewrite             func(string) string // 去掉前缀之后再改写路径
+	HealthCheckPath     string              // 为空时不做主动健康检查，所有上游都认为是健康的
+	HealthCheckInterval time.Duration       // 默认 10s
+	HealthCheckTimeout  time.Duration       // 默认 2s
+	Retries             int                 // 幂等请求最多重试的次数，默认 0
+	FlushInterval       time.Duration       // 默认 -1，即每次写入之后立刻 flush，适合流式响应
+	Transport           http.RoundTripper   // 默认 http.DefaultTransport
+}
+
+// ReverseProxy 将请求转发给一组上游
+type ReverseProxy struct {
+	upstreams []*Upstream
+	opts      ProxyOptions
+	proxy     *httputil.ReverseProxy
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewProxy 创建一个转发给 targets 的反向代理，设置了 HealthCheckPath 时启动健康检查，使用 Close 停止
+func NewProxy(targets []string, opts ProxyOptions) (*ReverseProxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("koo: proxy needs at least one target")
+	}
+	if opts.Balancer == nil {
+		opts.Balancer = RoundRobin()
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = 10 * time.Second
+	}
+	if opts.HealthCheckTimeout == 0 {
+		opts.HealthCheckTimeout = 2 * time.Second
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = -1
+	}
+	if opts.Transport == nil {
+		opts.Transport = http.DefaultTransport
+	}
+
+	p := &ReverseProxy{opts: opts, done: make(chan struct{})}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("koo: invalid proxy target %q", target)
+		}
+		p.upstreams = append(p.upstreams, &Upstream{URL: u, healthy: 1})
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:      p.director,
+		Transport:     roundTripperFunc(p.roundTrip),
+		FlushInterval: opts.FlushInterval,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("[Proxy] %s %s: %v", req.Method, req.URL.Path, err)
+			status := http.StatusBadGateway
+			if err == ErrNoUpstream {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, http.StatusText(status), status)
+		},
+	}
+
+	if opts.HealthCheckPath != "" {
+		p.checkHealth()
+		go p.healthCheckLoop()
+	}
+	return p, nil
+}
+
+// Proxy 和 NewProxy 相同，但是 target 不是合法的 URL 时 panic
+// 使用 p.Handler() 得到 HandlerFunc，不再使用时调用 p.Close() 停止健康检查
+func Proxy(targets []string, opts ProxyOptions) *ReverseProxy {
+	p, err := NewProxy(targets, opts)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Proxy 将 relativePath 下的所有请求转发给 targets，转发时去掉 group 的前缀和 relativePath
+// 返回的 ReverseProxy 用于查看上游的状态，以及在不再使用时调用 Close 停止健康检查
+func (group *RouterGroup) Proxy(relativePath string, targets []string, opts ProxyOptions) *ReverseProxy {
+	prefix := path.Join(group.prefix, relativePath)
+	if opts.StripPrefix == "" {
+		opts.StripPrefix = prefix
+	}
+	p := Proxy(targets, opts)
+	handler := p.Handler()
+	// *proxypath 不匹配前缀本身，例如 /api/*proxypath 不匹配 /api，挂载在 / 时也是一样
+	group.Any(relativePath, handler)
+	group.Any(path.Join(relativePath, "/*proxypath"), handler)
+	return p
+}
+
+// Handler 将代理包装成 HandlerFunc
+func (p *ReverseProxy) Handler() HandlerFunc {
+	return func(c *Context) {
+		p.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.proxy.ServeHTTP(w, req)
+}
+
+// Upstreams 返回所有的上游
+func (p *ReverseProxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Close 停止健康检查
+func (p *ReverseProxy) Close() {
+	p.closeOnce.Do(func() { close(p.done) })
+}
+
+// director 改写请求路径，真正的上游地址在 roundTrip 中选择，这样重试时可以换一个上游
+func (p *ReverseProxy) director(req *http.Request) {
+	reqPath := req.URL.Path
+	if p.opts.StripPrefix != "" {
+		reqPath = strings.TrimPrefix(reqPath, strings.TrimSuffix(p.opts.StripPrefix, "/"))
+		if !strings.HasPrefix(reqPath, "/") {
+			reqPath = "/" + reqPath
+		}
+	}
+	if p.opts.Rewrite != nil {
+		reqPath = p.opts.Rewrite(reqPath)
+	}
+	req.URL.Path, req.URL.RawPath = reqPath, ""
+
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+}
+
+// roundTrip 选择一个上游转发请求，连接失败时幂等请求换一个上游重试
+func (p *ReverseProxy) roundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if retryable(req) {
+		attempts += p.opts.Retries
+	}
+
+	var tried []*Upstream
+	err := ErrNoUpstream
+	for i := 0; i < attempts; i++ {
+		u := p.pick(tried)
+		if u == nil {
+			break
+		}
+		tried = append(tried, u)
+
+		out := req.Clone(req.Context())
+		out.URL.Scheme = u.URL.Scheme
+		out.URL.Host = u.URL.Host
+		out.URL.Path = singleJoiningSlash(u.URL.Path, req.URL.Path)
+		out.URL.RawQuery = joinQuery(u.URL.RawQuery, req.URL.RawQuery)
+
+		atomic.AddInt64(&u.active, 1)
+		var resp *http.Response
+		resp, err = p.opts.Transport.RoundTrip(out)
+		if err != nil {
+			atomic.AddInt64(&u.active, -1)
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		resp.Body = trackBody(resp.Body, func() { atomic.AddInt64(&u.active, -1) })
+		return resp, nil
+	}
+	return nil, err
+}
+
+// pick 从健康并且还没有尝试过的上游中选择一个
+func (p *ReverseProxy) pick(tried []*Upstream) *Upstream {
+	candidates := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if !u.Healthy() {
+			continue
+		}
+		skip := false
+		for _, t := range tried {
+			skip = skip || t == u
+		}
+		if !skip {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return p.opts.Balancer.Next(candidates)
+}
+
+// retryable 只有没有请求体的幂等请求可以安全地重试
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+}
+
+func (p *ReverseProxy) healthCheckLoop() {
+	ticker := time.NewTicker(p.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.checkHealth()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// checkHealth 并发检查所有上游，2xx 和 3xx 认为是健康的
+func (p *ReverseProxy) checkHealth() {
+	client := &http.Client{Timeout: p.opts.HealthCheckTimeout, Transport: p.opts.Transport}
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			healthy := int32(0)
+			resp, err := client.Get(singleJoiningSlash(u.URL.String(), p.opts.HealthCheckPath))
+			if err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode < 400 {
+					healthy = 1
+				}
+			}
+			if old := atomic.SwapInt32(&u.healthy, healthy); old != healthy {
+				log.Printf("[Proxy] upstream %s healthy: %t", u.URL, healthy == 1)
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// trackBody 在响应体关闭时调用 done
+// 101 Switching Protocols 的响应体是 io.ReadWriteCloser，包装之后仍然需要可写，否则 ReverseProxy 无法转发 WebSocket
+func trackBody(body io.ReadCloser, done func()) io.ReadCloser {
+	tb := &trackedBody{ReadCloser: body, done: done}
+	if rw, ok := body.(io.ReadWriteCloser); ok {
+		return &trackedRWBody{trackedBody: tb, w: rw}
+	}
+	return tb
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+type trackedRWBody struct {
+	*trackedBody
+	w io.Writer
+}
+
+func (b *trackedRWBody) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+// joinQuery 合并上游地址和请求中的 query，只有两边都不为空时才需要 &
+func joinQuery(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "&" + b
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,142 @@
+package koo_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"koo"
+	"koo/kootest"
+)
+
+// newUpstream 启动一个返回 name、请求路径和 query 的上游，/healthz 返回 healthy 的值对应的状态码
+func newUpstream(t *testing.T, name string, healthy *int32) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/healthz" {
+			if healthy != nil && atomic.LoadInt32(healthy) == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		fmt.Fprintf(w, "%s %s ?%s", name, req.URL.Path, req.URL.RawQuery)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestGroupProxy(t *testing.T) {
+	up := newUpstream(t, "a", nil)
+	r := koo.New()
+	p := r.Group("/api").Proxy("/", []string{up.URL}, koo.ProxyOptions{})
+	defer p.Close()
+
+	if len(p.Upstreams()) != 1 || p.Upstreams()[0].URL.String() != up.URL {
+		t.Fatalf("Upstreams = %v", p.Upstreams())
+	}
+	kootest.NewRequest(r).GET("/api/_cache/scores/Tom").Do().
+		AssertStatus(t, http.StatusOK).AssertBody(t, "a /_cache/scores/Tom ?")
+	kootest.NewRequest(r).GET("/api").Do().AssertBody(t, "a / ?")
+}
+
+func TestProxyQuery(t *testing.T) {
+	up := newUpstream(t, "a", nil)
+	tests := []struct {
+		target string
+		path   string
+		want   string
+	}{
+		{up.URL, "/x", "a /x ?"},
+		{up.URL, "/x?b=2", "a /x ?b=2"},
+		{up.URL + "/?a=1", "/x", "a /x ?a=1"},
+		{up.URL + "/?a=1", "/x?b=2", "a /x ?a=1&b=2"},
+	}
+	for _, tt := range tests {
+		r := koo.New()
+		p := r.Proxy("/", []string{tt.target}, koo.ProxyOptions{})
+		kootest.NewRequest(r).GET(tt.path).Do().AssertBody(t, tt.want)
+		p.Close()
+	}
+}
+
+func TestProxyBalance(t *testing.T) {
+	a, b := newUpstream(t, "a", nil), newUpstream(t, "b", nil)
+	p := koo.Proxy([]string{a.URL, b.URL}, koo.ProxyOptions{})
+	defer p.Close()
+	r := koo.New()
+	r.Use(p.Handler())
+
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		rec := kootest.NewRequest(r).GET("/").Do().AssertStatus(t, http.StatusOK)
+		seen[rec.Body.String()[:1]]++
+	}
+	if seen["a"] != 2 || seen["b"] != 2 {
+		t.Fatalf("round robin = %v, want 2 requests each", seen)
+	}
+}
+
+func TestProxyRetry(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	up := newUpstream(t, "a", nil)
+
+	// RoundRobin 先选中已经关闭的上游，GET 重试到下一个上游，POST 不重试
+	r := koo.New()
+	p := r.Proxy("/", []string{dead.URL, up.URL}, koo.ProxyOptions{Retries: 1})
+	defer p.Close()
+	kootest.NewRequest(r).GET("/x").Do().AssertStatus(t, http.StatusOK).AssertBody(t, "a /x ?")
+	kootest.NewRequest(r).GET("/x").Do().AssertStatus(t, http.StatusOK)
+	kootest.NewRequest(r).POST("/x").Do().AssertStatus(t, http.StatusBadGateway)
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	healthy := int32(1)
+	a, b := newUpstream(t, "a", &healthy), newUpstream(t, "b", nil)
+	r := koo.New()
+	p := r.Proxy("/", []string{a.URL, b.URL}, koo.ProxyOptions{
+		HealthCheckPath:     "/healthz",
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	defer p.Close()
+
+	atomic.StoreInt32(&healthy, 0)
+	deadline := time.Now().Add(time.Second)
+	for p.Upstreams()[0].Healthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("upstream a is still healthy")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		kootest.NewRequest(r).GET("/").Do().AssertBody(t, "b / ?")
+	}
+
+	// Close 之后健康检查停止，上游的状态不再变化
+	p.Close()
+	p.Close()
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(50 * time.Millisecond)
+	if p.Upstreams()[0].Healthy() {
+		t.Fatal("health check still running after Close")
+	}
+}
+
+func TestProxyNoUpstream(t *testing.T) {
+	healthy := int32(0)
+	a := newUpstream(t, "a", &healthy)
+	r := koo.New()
+	p := r.Proxy("/", []string{a.URL}, koo.ProxyOptions{HealthCheckPath: "/healthz"})
+	defer p.Close()
+	kootest.NewRequest(r).GET("/").Do().AssertStatus(t, http.StatusServiceUnavailable)
+
+	if _, err := koo.NewProxy(nil, koo.ProxyOptions{}); err == nil {
+		t.Error("NewProxy without targets succeeded")
+	}
+	if _, err := koo.NewProxy([]string{"localhost:8001"}, koo.ProxyOptions{}); err == nil {
+		t.Error("NewProxy with a target without scheme succeeded")
+	}
+}
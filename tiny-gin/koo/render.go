@@ -0,0 +1,284 @@
+package koo
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/*
+
+HTML 渲染
+
+HTMLRender 是 c.HTML 使用的渲染接口，默认实现是 HTMLTemplates，它管理多个命名的模板集合：
+
+	""      默认集合，由 LoadHTMLGlob / LoadHTMLFS 加载，c.HTML 的 name 是模板名，例如 "css.tmpl"
+	"home"  命名集合，由 AddFromFiles / AddFromFS 加载，c.HTML 的 name 是集合名
+	        集合中的第一个文件是布局，执行时从布局开始，页面通过 {{define "content"}} 填充布局中的 {{block "content" .}}
+
+每个命名集合单独解析，所以不同页面可以各自定义同名的 block
+debug 模式下，每次渲染前都会检查模板文件是否修改，修改了就重新解析，不需要重启服务
+
+HTMLFuncRender 在渲染时替换一部分模板函数，用来把函数绑定到当前请求，例如 I18n 把 T 绑定到协商出来的语言
+HTMLTemplates 为此保存一份没有执行过的模板，每次绑定时复制一份（html/template 不能复制执行过的模板）
+
+*/
+
+// HTMLRender 根据 name 将 data 渲染为 HTML 写入 w
+type HTMLRender interface {
+	Render(w io.Writer, name string, data any) error
+}
+
+// HTMLFuncRender 是可以在渲染时替换模板函数的 HTMLRender
+// funcs 中的函数需要在解析模板时已经通过 SetFuncMap 注册过同名的函数
+type HTMLFuncRender interface {
+	HTMLRender
+	RenderFuncs(w io.Writer, name string, data any, funcs template.FuncMap) error
+}
+
+// templateFuncsKey 是 c.Keys 中当前请求绑定的模板函数
+const templateFuncsKey = "koo/template-funcs"
+
+// HTMLTemplates 是默认的 HTMLRender，支持多个模板集合，布局继承和热加载
+type HTMLTemplates struct {
+	mu      sync.RWMutex // protects following
+	debug   bool
+	funcMap template.FuncMap
+	sets    map[string]*templateSet
+}
+
+// templateSet 是一组一起解析的模板文件
+// fsys 为 nil 时 patterns 是本地文件系统中的 glob
+// root 为空时执行 Render 传入的模板名，否则总是执行 root（布局）
+type templateSet struct {
+	fsys     fs.FS
+	patterns []string
+	root     string
+	tmpl     *template.Template
+	pristine *template.Template // tmpl 的副本，从来不执行，RenderFuncs 从它复制
+	stamp    string // 所有模板文件修改时间的快照，debug 模式下用来判断是否需要重新解析
+	static   bool   // 通过 Add 直接注册的模板，无法重新解析
+}
+
+// NewHTMLTemplates is the constructor of HTMLTemplates
+func NewHTMLTemplates() *HTMLTemplates {
+	return &HTMLTemplates{
+		funcMap: template.FuncMap{},
+		sets:    make(map[string]*templateSet),
+	}
+}
+
+// SetDebug 打开之后每次渲染都会检查模板文件是否修改
+func (h *HTMLTemplates) SetDebug(debug bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.debug = debug
+}
+
+// SetFuncMap 设置解析模板时使用的 funcMap，只对之后解析的模板生效
+func (h *HTMLTemplates) SetFuncMap(funcMap template.FuncMap) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.funcMap = funcMap
+}
+
+// LoadGlob 使用本地文件 glob 加载默认模板集合
+func (h *HTMLTemplates) LoadGlob(pattern string) error {
+	return h.load("", &templateSet{patterns: []string{pattern}})
+}
+
+// LoadFS 从 fs.FS（例如 embed.FS）加载默认模板集合
+func (h *HTMLTemplates) LoadFS(fsys fs.FS, patterns ...string) error {
+	return h.load("", &templateSet{fsys: fsys, patterns: patterns})
+}
+
+// AddFromFiles 添加一个命名模板集合，files 可以是 glob，第一个 pattern 匹配到的第一个文件作为布局
+func (h *HTMLTemplates) AddFromFiles(name string, files ...string) error {
+	if len(files) == 0 {
+		return fmt.Errorf("koo: no template files for %q", name)
+	}
+	set := &templateSet{patterns: files}
+	matches, err := set.files()
+	if err != nil {
+		return err
+	}
+	set.root = filepath.Base(matches[0])
+	return h.load(name, set)
+}
+
+// AddFromFS 从 fs.FS 添加一个命名模板集合，第一个 pattern 匹配到的第一个文件作为布局
+func (h *HTMLTemplates) AddFromFS(name string, fsys fs.FS, patterns ...string) error {
+	set := &templateSet{fsys: fsys, patterns: patterns}
+	files, err := set.files()
+	if err != nil {
+		return err
+	}
+	set.root = path.Base(files[0])
+	return h.load(name, set)
+}
+
+// Add 添加一个已经解析好的模板集合，执行时从 tmpl 本身开始
+// 这样添加的模板不会被热加载
+func (h *HTMLTemplates) Add(name string, tmpl *template.Template) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pristine, _ := tmpl.Clone() // tmpl 已经执行过时无法复制，RenderFuncs 只能使用原来的函数
+	h.sets[name] = &templateSet{root: tmpl.Name(), tmpl: tmpl, pristine: pristine, static: true}
+}
+
+func (h *HTMLTemplates) load(name string, set *templateSet) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := set.parse(h.funcMap); err != nil {
+		return err
+	}
+	h.sets[name] = set
+	return nil
+}
+
+// Render implements HTMLRender
+// name 是命名集合时执行集合的布局，否则在默认集合中查找名为 name 的模板
+func (h *HTMLTemplates) Render(w io.Writer, name string, data any) error {
+	return h.RenderFuncs(w, name, data, nil)
+}
+
+// RenderFuncs implements HTMLFuncRender，funcs 不为空时在模板的副本上替换这些函数之后执行
+func (h *HTMLTemplates) RenderFuncs(w io.Writer, name string, data any, funcs template.FuncMap) error {
+	h.mu.RLock()
+	set, ok := h.sets[name]
+	tmplName := name
+	if ok && name != "" {
+		tmplName = set.root
+	} else {
+		set, ok = h.sets[""]
+	}
+	debug := h.debug
+	h.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("koo: html template %q is not loaded", name)
+	}
+
+	tmpl, pristine, err := h.template(set, debug)
+	if err != nil {
+		return err
+	}
+	if len(funcs) > 0 && pristine != nil {
+		clone, err := pristine.Clone()
+		if err != nil {
+			return err
+		}
+		tmpl = clone.Funcs(funcs)
+	}
+	return tmpl.ExecuteTemplate(w, tmplName, data)
+}
+
+// template 返回 set 当前的模板和它的副本，debug 模式下文件修改过则先重新解析
+// 检查修改时间只需要读锁，只有需要重新解析的时候才获取写锁
+func (h *HTMLTemplates) template(set *templateSet, debug bool) (tmpl, pristine *template.Template, err error) {
+	h.mu.RLock()
+	tmpl, pristine, stamp := set.tmpl, set.pristine, set.stamp
+	h.mu.RUnlock()
+	if !debug || set.static {
+		return tmpl, pristine, nil
+	}
+
+	current, err := set.snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	if current == stamp {
+		return tmpl, pristine, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if current != set.stamp { // 其他请求可能已经重新解析过了
+		if err := set.parse(h.funcMap); err != nil {
+			return nil, nil, err
+		}
+	}
+	return set.tmpl, set.pristine, nil
+}
+
+// files 展开所有的 pattern，返回去重之后的文件列表
+func (s *templateSet) files() ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		var matches []string
+		var err error
+		if s.fsys != nil {
+			matches, err = fs.Glob(s.fsys, pattern)
+		} else {
+			matches, err = filepath.Glob(pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("koo: html template patterns %v match no files", s.patterns)
+	}
+	return files, nil
+}
+
+// snapshot 记录所有模板文件的名称，大小和修改时间
+func (s *templateSet) snapshot() (string, error) {
+	files, err := s.files()
+	if err != nil {
+		return "", err
+	}
+	var str strings.Builder
+	for _, file := range files {
+		var info fs.FileInfo
+		if s.fsys != nil {
+			info, err = fs.Stat(s.fsys, file)
+		} else {
+			info, err = os.Stat(file)
+		}
+		if err != nil {
+			return "", err
+		}
+		str.WriteString(fmt.Sprintf("%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano()))
+	}
+	return str.String(), nil
+}
+
+// parse 重新解析 set 中所有的模板文件，失败时保留之前的模板
+func (s *templateSet) parse(funcMap template.FuncMap) error {
+	stamp, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	tmpl := template.New(s.root).Funcs(funcMap)
+	if s.fsys != nil {
+		tmpl, err = tmpl.ParseFS(s.fsys, files...)
+	} else {
+		tmpl, err = tmpl.ParseFiles(files...)
+	}
+	if err != nil {
+		return err
+	}
+	pristine, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	s.tmpl, s.pristine, s.stamp = tmpl, pristine, stamp
+	return nil
+}
@@ -0,0 +1,149 @@
+package koo_test
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"koo"
+	"koo/kootest"
+)
+
+var templateFS = fstest.MapFS{
+	"templates/hello.tmpl":  {Data: []byte(`hello {{ .name | upper }}`)},
+	"templates/bye.tmpl":    {Data: []byte(`bye {{ .name }}`)},
+	"layouts/base.tmpl":     {Data: []byte(`<main>{{ block "content" . }}default{{ end }}</main>`)},
+	"pages/home.tmpl":       {Data: []byte(`{{ define "content" }}home {{ .name }}{{ end }}`)},
+	"pages/about.tmpl":      {Data: []byte(`{{ define "content" }}about{{ end }}`)},
+	"templates/broken.tmpl": {Data: []byte(`{{ .name `)},
+}
+
+func TestHTML(t *testing.T) {
+	r := koo.New()
+	r.SetFuncMap(template.FuncMap{"upper": strings.ToUpper})
+	if err := r.LoadHTMLFS(templateFS, "templates/hello.tmpl", "templates/bye.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	// 每个命名集合单独解析，home 和 about 各自定义 content
+	if err := r.HTMLTemplates().AddFromFS("home", templateFS, "layouts/base.tmpl", "pages/home.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.HTMLTemplates().AddFromFS("about", templateFS, "layouts/base.tmpl", "pages/about.tmpl"); err != nil {
+		t.Fatal(err)
+	}
+	r.GET("/:page", func(c *koo.Context) {
+		c.HTML(http.StatusOK, c.Param("page"), koo.H{"name": "koo"})
+	})
+
+	kootest.NewRequest(r).GET("/hello.tmpl").Do().AssertStatus(t, http.StatusOK).
+		AssertHeader(t, "Content-Type", "text/html").AssertBody(t, "hello KOO")
+	kootest.NewRequest(r).GET("/bye.tmpl").Do().AssertBody(t, "bye koo")
+	kootest.NewRequest(r).GET("/home").Do().AssertBody(t, "<main>home koo</main>")
+	kootest.NewRequest(r).GET("/about").Do().AssertBody(t, "<main>about</main>")
+	kootest.NewRequest(r).GET("/missing").Do().AssertStatus(t, http.StatusInternalServerError)
+
+	if err := r.HTMLTemplates().AddFromFS("broken", templateFS, "templates/broken.tmpl"); err == nil {
+		t.Fatal("AddFromFS with a broken template succeeded")
+	}
+	if err := r.LoadHTMLFS(templateFS, "nothing/*.tmpl"); err == nil {
+		t.Fatal("LoadHTMLFS with patterns that match nothing succeeded")
+	}
+}
+
+func TestHTMLWithoutRender(t *testing.T) {
+	r := koo.New()
+	r.GET("/", func(c *koo.Context) { c.HTML(http.StatusOK, "index.tmpl", nil) })
+	kootest.NewRequest(r).GET("/").Do().AssertStatus(t, http.StatusInternalServerError)
+}
+
+func TestHTMLAdd(t *testing.T) {
+	r := koo.New()
+	r.HTMLTemplates().Add("inline", template.Must(template.New("inline").Parse(`inline {{ . }}`)))
+	r.GET("/", func(c *koo.Context) { c.HTML(http.StatusCreated, "inline", "data") })
+	kootest.NewRequest(r).GET("/").Do().AssertStatus(t, http.StatusCreated).AssertBody(t, "inline data")
+}
+
+// fixedRender 是自定义的 HTMLRender
+type fixedRender struct{}
+
+func (fixedRender) Render(w io.Writer, name string, data any) error {
+	_, err := io.WriteString(w, "custom "+name)
+	return err
+}
+
+func TestSetHTMLRender(t *testing.T) {
+	r := koo.New()
+	r.SetHTMLRender(fixedRender{})
+	r.GET("/", func(c *koo.Context) { c.HTML(http.StatusOK, "index", nil) })
+	kootest.NewRequest(r).GET("/").Do().AssertBody(t, "custom index")
+}
+
+func TestHTMLReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.tmpl")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Now().Add(-time.Hour)
+	write("v1", mtime)
+
+	newEngine := func(debug bool) *koo.Engine {
+		r := koo.New()
+		r.SetDebug(debug)
+		if err := r.LoadHTMLGlob(filepath.Join(dir, "*.tmpl")); err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/", func(c *koo.Context) { c.HTML(http.StatusOK, "page.tmpl", nil) })
+		return r
+	}
+	debug, release := newEngine(true), newEngine(false)
+	kootest.NewRequest(debug).GET("/").Do().AssertBody(t, "v1")
+
+	write("v2", mtime.Add(time.Minute))
+	kootest.NewRequest(debug).GET("/").Do().AssertBody(t, "v2")
+	kootest.NewRequest(release).GET("/").Do().AssertBody(t, "v1")
+
+	// 修改之后解析失败时返回错误，修复之后恢复
+	write("{{ broken", mtime.Add(2*time.Minute))
+	kootest.NewRequest(debug).GET("/").Do().AssertStatus(t, http.StatusInternalServerError)
+	write("v3", mtime.Add(3*time.Minute))
+	kootest.NewRequest(debug).GET("/").Do().AssertBody(t, "v3")
+}
+
+func TestHTMLAddFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"layouts/base.tmpl": `<main>{{ block "content" . }}default{{ end }}</main>`,
+		"pages/home.tmpl":   `{{ define "content" }}home{{ end }}`,
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := koo.New()
+	// 布局是第一个 pattern 匹配到的第一个文件，而不是 pattern 本身
+	if err := r.HTMLTemplates().AddFromFiles("home", filepath.Join(dir, "layouts", "*.tmpl"), filepath.Join(dir, "pages", "*.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.HTMLTemplates().AddFromFiles("none", filepath.Join(dir, "none", "*.tmpl")); err == nil {
+		t.Fatal("AddFromFiles with patterns that match nothing succeeded")
+	}
+	r.GET("/", func(c *koo.Context) { c.HTML(http.StatusOK, "home", nil) })
+	kootest.NewRequest(r).GET("/").Do().AssertBody(t, "<main>home</main>")
+}
@@ -40,18 +40,47 @@ func parsePattern(pattern string) []string {
 
 // addRoute 提供接口，method， pattern 和 handler 参数
 // 将信息打印到 log 中，同时，将路由信息保存到 router 的 trie node 对应的 tree 中
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePattern(pattern)
-	key := method + "-" + pattern
+// 含有可选段的 pattern 会被展开成多条路由，共用同一个 handler
+// pattern 中的约束不合法时返回错误，不会注册任何一条路由
+func (r *router) addRoute(method string, pattern string, handler HandlerFunc) error {
+	for _, part := range parsePattern(pattern) {
+		if part[0] == '{' {
+			if _, err := parseParam(part); err != nil {
+				return err
+			}
+		}
+	} // 先检查所有的约束，避免展开之后只注册了一部分路由
 
 	if _, ok := r.roots[method]; ok == false {
 		r.roots[method] = &node{}
 	} // 如果 method 没有根 node，先创建根 node
 
-	r.roots[method].insert(pattern, parts, 0)
-	// 将这个 parts 插入到 method 对应的 trie 中
-	r.handlers[key] = handler
-	// 在 r 中存储具体的 key 对应的 handlerFunc
+	for _, pattern := range expandOptional(pattern) {
+		parts := parsePattern(pattern)
+		key := method + "-" + pattern
+
+		if err := r.roots[method].insert(pattern, parts, 0); err != nil {
+			return err
+		}
+		// 将这个 parts 插入到 method 对应的 trie 中
+		r.handlers[key] = handler
+		// 在 r 中存储具体的 key 对应的 handlerFunc
+	}
+	return nil
+}
+
+// hasRoute 判断 method 是否已经注册了和 pattern 完全相同的路由，/api 和 /api/ 是同一个路由
+func (r *router) hasRoute(method string, pattern string) bool {
+	n, ok := r.roots[method]
+	if !ok {
+		return false
+	}
+	for _, part := range parsePattern(pattern) {
+		if n = n.matchChild(part); n == nil {
+			return false
+		}
+	}
+	return n.pattern != ""
 }
 
 // getRoute 根据路由的方法，以及具体的 routePath 得到对应的 node 以及对应的 map 解析结果
@@ -69,17 +98,19 @@ func (r *router) getRoute(method string, path string) (*node, map[string]string)
 	n := root.search(searchParts, 0)
 	// 使用 search 方法，搜索匹配 parts 的 node
 
-	if n != nil { // 如果存在对应的 node
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchParts[index]
-				// /:lang, /go -> {lang: go}
+	if n != nil { // 如果存在对应的 node，参数名在 insert 时已经记录在 n.params 中
+		for index, name := range n.params {
+			if name == "" {
+				continue
 			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchParts[index:], "/")
+			if index == len(n.params)-1 && n.part[0] == '*' {
+				params[name] = strings.Join(searchParts[index:], "/")
 				// /static/css/background.css 匹配到 static/*filepath
 				// 返回的对应 map key value 是: {filepath: "css/background.css"}
+			} else {
+				params[name] = searchParts[index]
+				// /:lang, /go -> {lang: go}
+				// /{id:int}, /42 -> {id: 42}
 			}
 		}
 		return n, params
@@ -103,7 +134,7 @@ func (r *router) handle(c *Context) {
 	n, params := r.getRoute(c.Method, c.Path)
 
 	if n != nil {
-		key := c.Method + "-" +  n.pattern
+		key := c.Method + "-" + n.pattern
 		c.Params = params
 		c.handlers = append(c.handlers, r.handlers[key]) // 添加到 c.Handlers 后面
 	} else {
@@ -112,4 +143,4 @@ func (r *router) handle(c *Context) {
 		})
 	}
 	c.Next()
-}
\ No newline at end of file
+}
@@ -0,0 +1,326 @@
+package koo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+
+Sessions 中间件在每个请求开始时从 Store 中加载 session，handler 中通过 c.Session() 读写：
+
+	r.Use(koo.Sessions("koo_session", store))
+	r.GET("/login", func(c *koo.Context) {
+		s := c.Session()
+		s.Set("user", "fengwei")
+		if err := s.Save(); err != nil { ... } // Save 会写 Set-Cookie，要在写响应体之前调用
+	})
+
+Store 有三种实现：
+	CookieStore   数据签名 + 加密之后直接放在 cookie 中
+	MemoryStore   cookie 中只放 session id，数据保存在进程内存中
+	KVStore       cookie 中只放 session id，数据 gob 编码之后保存在外部的 KV 中
+
+koo/tinycachestore 和 koo/tinygormstore 分别把 tinyCache 的 Group 和 tinygorm 的一张表包装成 KV，
+它们是单独的 module，koo 本身不依赖 tiny-cache 和 tinygorm
+
+session 中的值使用 encoding/gob 编码，自定义类型需要先 gob.Register
+
+*/
+
+const sessionKey = "koo/session"
+
+// SessionOptions 是 session cookie 的属性
+// MaxAge < 0 表示删除 session，MaxAge == 0 表示浏览器关闭时过期
+type SessionOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// DefaultSessionOptions 是 Store 默认使用的 cookie 属性
+var DefaultSessionOptions = SessionOptions{
+	Path:     "/",
+	MaxAge:   86400 * 7,
+	HttpOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+func (o *SessionOptions) cookie(name string, value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	}
+	if o.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(o.MaxAge) * time.Second)
+	} else if o.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+	return cookie
+}
+
+// Store 负责加载和保存 session
+type Store interface {
+	// Get 返回请求中名为 name 的 session，没有或者无效时返回一个新的 session
+	Get(c *Context, name string) (*Session, error)
+	// Save 保存 session 并写入 cookie
+	Save(c *Context, s *Session) error
+}
+
+// Session 保存一个用户的数据，只在当前请求中使用，不是并发安全的
+type Session struct {
+	ID      string
+	Values  map[string]any
+	Options SessionOptions
+	IsNew   bool
+	name    string
+	store   Store
+	c       *Context
+}
+
+// NewSession 创建一个空的 session，供 Store 的实现使用
+func NewSession(c *Context, store Store, name string, options SessionOptions) *Session {
+	return &Session{
+		Values:  make(map[string]any),
+		Options: options,
+		IsNew:   true,
+		name:    name,
+		store:   store,
+		c:       c,
+	}
+}
+
+// Name 返回 session 的 cookie 名
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Get 返回 key 对应的值，不存在时返回 nil
+func (s *Session) Get(key string) any {
+	return s.Values[key]
+}
+
+// Set 设置 key 对应的值
+func (s *Session) Set(key string, value any) {
+	s.Values[key] = value
+}
+
+// Delete 删除 key
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+}
+
+// Clear 删除所有的值
+func (s *Session) Clear() {
+	s.Values = make(map[string]any)
+}
+
+// Destroy 清空 session 并让 cookie 过期，需要调用 Save 生效
+func (s *Session) Destroy() {
+	s.Clear()
+	s.Options.MaxAge = -1
+}
+
+// Save 将 session 保存到 Store 中，必须在写入响应体之前调用
+func (s *Session) Save() error {
+	return s.store.Save(s.c, s)
+}
+
+// Sessions 中间件，使用 store 加载名为 name 的 session
+// cookie 无效（过期，被篡改，密钥已经轮换掉）时使用一个新的 session
+func Sessions(name string, store Store) HandlerFunc {
+	return func(c *Context) {
+		s, err := store.Get(c, name)
+		if err != nil {
+			log.Printf("[Sessions] load %s: %v", name, err)
+		}
+		c.Set(sessionKey, s)
+		c.Next()
+	}
+}
+
+// Session 返回 Sessions 中间件加载的 session，没有使用 Sessions 中间件时 panic
+func (c *Context) Session() *Session {
+	if s, ok := c.Get(sessionKey); ok {
+		return s.(*Session)
+	}
+	panic("koo: Sessions middleware is not used")
+}
+
+// encodeValues / decodeValues 使用 gob 编码 session 的值
+func encodeValues(values map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeValues(data []byte) (map[string]any, error) {
+	values := make(map[string]any)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// randomToken 返回 n 字节随机数的 base64 编码，用于 session id 和 csrf token
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("koo: read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ErrKVNotFound 由 KV.Get 在 key 不存在时返回
+var ErrKVNotFound = errors.New("koo: kv key not found")
+
+// KV 是 KVStore 使用的存储，key 不存在时 Get 返回 ErrKVNotFound
+// tinycachestore.NewKV 和 tinygormstore.NewKV 分别基于 tinyCache 和 tinygorm 实现了 KV
+type KV interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// KVStore 在 cookie 中保存 session id，数据保存在 KV 中
+type KVStore struct {
+	Options SessionOptions
+	kv      KV
+	prefix  string
+}
+
+var _ Store = (*KVStore)(nil)
+
+// NewKVStore 创建一个 KVStore，prefix 会加在 KV 的 key 前面
+func NewKVStore(kv KV, prefix string) *KVStore {
+	return &KVStore{Options: DefaultSessionOptions, kv: kv, prefix: prefix}
+}
+
+// NewMemoryStore 创建一个数据保存在进程内存中的 Store，重启之后 session 丢失
+func NewMemoryStore() *KVStore {
+	return NewKVStore(newMemoryKV(), "")
+}
+
+// Get implements Store
+func (st *KVStore) Get(c *Context, name string) (*Session, error) {
+	s := NewSession(c, st, name, st.Options)
+	id, err := c.Cookie(name)
+	if err != nil {
+		return s, nil
+	}
+	data, err := st.kv.Get(st.prefix + id)
+	if err == ErrKVNotFound {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	values, err := decodeValues(data)
+	if err != nil {
+		return s, err
+	}
+	s.ID, s.Values, s.IsNew = id, values, false
+	return s, nil
+}
+
+// Save implements Store
+func (st *KVStore) Save(c *Context, s *Session) error {
+	if s.Options.MaxAge < 0 {
+		if s.ID != "" {
+			if err := st.kv.Delete(st.prefix + s.ID); err != nil {
+				return err
+			}
+		}
+		c.SetCookie(s.Options.cookie(s.name, ""))
+		return nil
+	}
+
+	if s.ID == "" {
+		s.ID = randomToken(32)
+	}
+	data, err := encodeValues(s.Values)
+	if err != nil {
+		return err
+	}
+	// MaxAge == 0 的 session 在服务端也需要过期，使用默认的时长
+	ttl := time.Duration(s.Options.MaxAge) * time.Second
+	if ttl == 0 {
+		ttl = time.Duration(DefaultSessionOptions.MaxAge) * time.Second
+	}
+	if err := st.kv.Set(st.prefix+s.ID, data, ttl); err != nil {
+		return err
+	}
+	c.SetCookie(s.Options.cookie(s.name, s.ID))
+	return nil
+}
+
+// memoryKV 是 MemoryStore 使用的 KV，过期的 key 在访问时删除
+type memoryKV struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+	saves int
+}
+
+type memoryItem struct {
+	value  []byte
+	expire time.Time
+}
+
+func newMemoryKV() *memoryKV {
+	return &memoryKV{items: make(map[string]memoryItem)}
+}
+
+func (m *memoryKV) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[key]
+	if !ok {
+		return nil, ErrKVNotFound
+	}
+	if time.Now().After(item.expire) {
+		delete(m.items, key)
+		return nil, ErrKVNotFound
+	}
+	return item.value, nil
+}
+
+func (m *memoryKV) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = memoryItem{value: value, expire: time.Now().Add(ttl)}
+	// 每保存 1000 次清理一次过期的 session，避免没人访问的 session 一直占用内存
+	if m.saves++; m.saves%1000 == 0 {
+		now := time.Now()
+		for k, item := range m.items {
+			if now.After(item.expire) {
+				delete(m.items, k)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+	return nil
+}
@@ -0,0 +1,188 @@
+package koo_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+)
+
+var (
+	hashKey1  = bytes.Repeat([]byte("h"), 32)
+	blockKey1 = bytes.Repeat([]byte("b"), 32)
+	hashKey2  = bytes.Repeat([]byte("H"), 32)
+	blockKey2 = bytes.Repeat([]byte("B"), 16)
+)
+
+// newSessionEngine 返回一个使用 store 的 engine：
+// /login 保存 user，/me 返回 user，/logout 销毁 session
+func newSessionEngine(store koo.Store) *koo.Engine {
+	r := koo.New()
+	r.Use(koo.Sessions("sid", store))
+	r.GET("/login", func(c *koo.Context) {
+		s := c.Session()
+		s.Set("user", c.Query("user"))
+		if err := s.Save(); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/me", func(c *koo.Context) {
+		s := c.Session()
+		user, _ := s.Get("user").(string)
+		c.String(http.StatusOK, "%s new=%t", user, s.IsNew)
+	})
+	r.GET("/logout", func(c *koo.Context) {
+		c.Session().Destroy()
+		if err := c.Session().Save(); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "bye")
+	})
+	return r
+}
+
+func sessionCookie(t *testing.T, rec *kootest.Recorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "sid" {
+			return cookie
+		}
+	}
+	t.Fatalf("no sid cookie in response, headers: %v", rec.Header())
+	return nil
+}
+
+func TestSessionStores(t *testing.T) {
+	cookieStore, err := koo.NewCookieStore(hashKey1, blockKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]koo.Store{
+		"cookie": cookieStore,
+		"memory": koo.NewMemoryStore(),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			r := newSessionEngine(store)
+			kootest.NewRequest(r).GET("/me").Do().AssertBody(t, " new=true")
+
+			cookie := sessionCookie(t, kootest.NewRequest(r).GET("/login?user=fengwei").Do())
+			if !cookie.HttpOnly || cookie.MaxAge != koo.DefaultSessionOptions.MaxAge {
+				t.Errorf("cookie = %+v, want DefaultSessionOptions", cookie)
+			}
+			kootest.NewRequest(r).GET("/me").WithCookie(cookie).Do().AssertBody(t, "fengwei new=false")
+
+			expired := sessionCookie(t, kootest.NewRequest(r).GET("/logout").WithCookie(cookie).Do())
+			if expired.MaxAge >= 0 {
+				t.Errorf("logout cookie MaxAge = %d, want < 0", expired.MaxAge)
+			}
+			kootest.NewRequest(r).GET("/me").WithCookie(&http.Cookie{Name: "sid", Value: "garbage"}).Do().
+				AssertBody(t, " new=true")
+		})
+	}
+}
+
+func TestMemoryStoreDestroy(t *testing.T) {
+	// 销毁之后服务端的数据同样被删除，旧的 cookie 不能再使用
+	r := newSessionEngine(koo.NewMemoryStore())
+	cookie := sessionCookie(t, kootest.NewRequest(r).GET("/login?user=fengwei").Do())
+	kootest.NewRequest(r).GET("/logout").WithCookie(cookie).Do()
+	kootest.NewRequest(r).GET("/me").WithCookie(cookie).Do().AssertBody(t, " new=true")
+}
+
+func TestCookieStoreTamper(t *testing.T) {
+	store, _ := koo.NewCookieStore(hashKey1, blockKey1)
+	r := newSessionEngine(store)
+	cookie := sessionCookie(t, kootest.NewRequest(r).GET("/login?user=fengwei").Do())
+
+	// 修改任意一个字符签名都会失效
+	b := []byte(cookie.Value)
+	if b[10] == 'A' {
+		b[10] = 'B'
+	} else {
+		b[10] = 'A'
+	}
+	tampered := &http.Cookie{Name: "sid", Value: string(b)}
+	kootest.NewRequest(r).GET("/me").WithCookie(tampered).Do().AssertBody(t, " new=true")
+
+	// 签名包含 cookie 名，同样的值换一个名字不能使用
+	r2 := koo.New()
+	r2.Use(koo.Sessions("other", store))
+	r2.GET("/me", func(c *koo.Context) { c.String(http.StatusOK, "new=%t", c.Session().IsNew) })
+	kootest.NewRequest(r2).GET("/me").WithCookie(&http.Cookie{Name: "other", Value: cookie.Value}).Do().
+		AssertBody(t, "new=true")
+}
+
+func TestCookieStoreKeyRotation(t *testing.T) {
+	old, _ := koo.NewCookieStore(hashKey1, blockKey1)
+	cookie := sessionCookie(t, kootest.NewRequest(newSessionEngine(old)).GET("/login?user=fengwei").Do())
+
+	// 新的密钥对放在最前面，旧的密钥对仍然可以解码
+	rotated, err := koo.NewCookieStore(hashKey2, blockKey2, hashKey1, blockKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newSessionEngine(rotated)
+	kootest.NewRequest(r).GET("/me").WithCookie(cookie).Do().AssertBody(t, "fengwei new=false")
+
+	// 新的 cookie 使用新的密钥编码，只有新的密钥对的 store 无法解码旧 cookie
+	fresh := sessionCookie(t, kootest.NewRequest(r).GET("/login?user=koo").Do())
+	onlyNew, _ := koo.NewCookieStore(hashKey2, blockKey2)
+	kootest.NewRequest(newSessionEngine(onlyNew)).GET("/me").WithCookie(fresh).Do().AssertBody(t, "koo new=false")
+	kootest.NewRequest(newSessionEngine(onlyNew)).GET("/me").WithCookie(cookie).Do().AssertBody(t, " new=true")
+}
+
+func TestNewCookieStoreErrors(t *testing.T) {
+	tests := [][][]byte{
+		{},
+		{hashKey1},
+		{nil, blockKey1},
+		{hashKey1, []byte("short")},
+	}
+	for _, keys := range tests {
+		if _, err := koo.NewCookieStore(keys...); err == nil {
+			t.Errorf("NewCookieStore with %d keys succeeded", len(keys))
+		}
+	}
+}
+
+func TestCookieStoreTooLarge(t *testing.T) {
+	store, _ := koo.NewCookieStore(hashKey1, blockKey1)
+	r := newSessionEngine(store)
+	kootest.NewRequest(r).GET("/login").WithQuery("user", strings.Repeat("x", 4096)).Do().
+		AssertStatus(t, http.StatusInternalServerError)
+}
+
+func TestSessionWithoutMiddleware(t *testing.T) {
+	c, _ := kootest.CreateTestContext(httptest.NewRecorder())
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Session without the Sessions middleware did not panic")
+		}
+	}()
+	c.Session()
+}
+
+func TestCookie(t *testing.T) {
+	r := koo.New()
+	r.GET("/", func(c *koo.Context) {
+		value, err := c.Cookie("in")
+		if err != nil {
+			value = "none"
+		}
+		c.SetCookie(&http.Cookie{Name: "out", Value: value})
+		c.String(http.StatusOK, "%s", value)
+	})
+	rec := kootest.NewRequest(r).GET("/").WithCookie(&http.Cookie{Name: "in", Value: "v"}).Do().AssertBody(t, "v")
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "v" {
+		t.Fatalf("Set-Cookie = %v, want out=v", cookies)
+	}
+	kootest.NewRequest(r).GET("/").Do().AssertBody(t, "none")
+}
@@ -0,0 +1,13 @@
+module koo/tinycachestore
+
+go 1.19
+
+require (
+	koo v0.0.0
+	tiny-cache v0.0.0
+)
+
+replace (
+	koo => ../
+	tiny-cache => ../../../tiny-cache
+)
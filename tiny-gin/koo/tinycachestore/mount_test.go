@@ -0,0 +1,45 @@
+package tinycachestore
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"koo"
+	"koo/kootest"
+	"tiny-cache/tinyCache"
+)
+
+// koo 不依赖 tiny-cache，挂载 HTTPPool 的测试放在这个 module 中
+func TestMountHTTPPool(t *testing.T) {
+	tinyCache.NewGroup("koo-mount-scores", 1<<10, tinyCache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "Tom" {
+			return []byte("630"), nil
+		}
+		return nil, ErrNotFound
+	}))
+	peers := tinyCache.NewHTTPPool("http://localhost:8001/peers")
+
+	r := koo.New()
+	r.Mount("/peers", peers)
+	r.GET("/ping", func(c *koo.Context) { c.String(http.StatusOK, "pong") })
+
+	kootest.NewRequest(r).GET("/peers/_cache/koo-mount-scores/Tom").Do().
+		AssertStatus(t, http.StatusOK).AssertBody(t, "630")
+	kootest.NewRequest(r).GET("/peers/_cache/no-such-group/Tom").Do().AssertStatus(t, http.StatusNotFound)
+	kootest.NewRequest(r).GET("/ping").Do().AssertBody(t, "pong")
+
+	// 通过真实的 HTTP 连接访问挂载的 HTTPPool
+	s := httptest.NewServer(r)
+	defer s.Close()
+	resp, err := http.Get(s.URL + "/peers/_cache/koo-mount-scores/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "630" {
+		t.Fatalf("GET = %d %q, want 200 630", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,121 @@
+package tinycachestore
+
+/*
+
+tinycachestore 将 tinyCache 的 Group 包装成 koo 使用的存储
+它是一个单独的 module，只有使用它的程序才会依赖 tiny-cache
+
+KV 用于 koo.KVStore 保存 session：
+
+	group := tinycachestore.NewGroup("sessions", 64<<20)
+	group.RegisterPeers(peers) // 可选，注册节点之后 session 按照 key 分布在各个节点上
+	r.Use(koo.Sessions("koo_session", koo.NewKVStore(tinycachestore.NewKV(group), "session:")))
+
+使用自己的 tinyCache.Group 时，它的 Getter 在 key 不存在时应该返回（或者包装）tinyCache.ErrNotFound，
+KV 据此区分不存在和读取出错
+
+注意 tinyCache 是缓存而不是数据库：内存不足时 session 可能被淘汰，节点下线时上面的 session 会丢失，
+被淘汰的 session 表现为一个新的 session，需要可靠保存的 session 请使用 tinygormstore
+
+ByteCache 用于 koo.NewByteResponseStore，多个实例共享 CacheResponse 缓存的响应：
+
+	store := koo.NewByteResponseStore(tinycachestore.NewByteCache(tinycachestore.NewGroup("responses", 64<<20)))
+	r.Use(koo.CacheResponseWithStore(store, time.Minute, nil))
+
+*/
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"koo"
+	"tiny-cache/tinyCache"
+)
+
+// ErrNotFound 由 group 的 Getter 在 key 不存在时返回
+var ErrNotFound = tinyCache.ErrNotFound
+
+// Group 是 KV 使用的 tinyCache.Group 的方法
+type Group interface {
+	Get(key string) (tinyCache.ByteView, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Remove(key string) error
+}
+
+var _ Group = (*tinyCache.Group)(nil)
+
+// NewGroup 创建一个没有数据源的 Group，它的 Getter 总是返回 ErrNotFound
+// 值只能通过 Set 写入，缓存中没有的 key 就是不存在
+func NewGroup(name string, cacheBytes int64, opts ...tinyCache.GroupOption) *tinyCache.Group {
+	getter := tinyCache.GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	})
+	return tinyCache.NewGroup(name, cacheBytes, getter, opts...)
+}
+
+// KV 将 Group 包装成 koo.KV
+type KV struct {
+	group Group
+}
+
+var _ koo.KV = (*KV)(nil)
+
+// NewKV 创建一个读写 group 的 KV
+func NewKV(group Group) *KV {
+	return &KV{group: group}
+}
+
+// Get implements koo.KV
+func (kv *KV) Get(key string) ([]byte, error) {
+	view, err := kv.group.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, koo.ErrKVNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return view.ByteSlice(), nil
+}
+
+// Set implements koo.KV
+func (kv *KV) Set(key string, value []byte, ttl time.Duration) error {
+	return kv.group.Set(key, value, ttl)
+}
+
+// Delete implements koo.KV
+func (kv *KV) Delete(key string) error {
+	return kv.group.Remove(key)
+}
+
+// ByteCache 将 Group 包装成 koo.ByteCache
+type ByteCache struct {
+	group Group
+}
+
+var _ koo.ByteCache = (*ByteCache)(nil)
+
+// NewByteCache 创建一个读写 group 的 ByteCache
+func NewByteCache(group Group) *ByteCache {
+	return &ByteCache{group: group}
+}
+
+// Get implements koo.ByteCache，key 不存在和读取出错都被当作没有命中
+func (bc *ByteCache) Get(key string) ([]byte, bool) {
+	view, err := bc.group.Get(key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("[tinycachestore] get %s: %v", key, err)
+		}
+		return nil, false
+	}
+	return view.ByteSlice(), true
+}
+
+// Set implements koo.ByteCache，koo.ByteCache 的 Set 没有返回值，写入失败时只记录日志
+func (bc *ByteCache) Set(key string, value []byte, ttl time.Duration) {
+	if err := bc.group.Set(key, value, ttl); err != nil {
+		log.Printf("[tinycachestore] set %s: %v", key, err)
+	}
+}
@@ -0,0 +1,176 @@
+package tinycachestore
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"koo"
+	"koo/kootest"
+	"tiny-cache/tinyCache"
+)
+
+// identity 的 Getter 返回 key 本身，用来构造内容为任意值的 ByteView
+var identity = tinyCache.NewGroup("tinycachestore-identity", 1<<20, tinyCache.GetterFunc(func(key string) ([]byte, error) {
+	return []byte(key), nil
+}))
+
+// fakeGroup 是一个使用 map 保存数据的 Group
+type fakeGroup struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	expire map[string]time.Time
+}
+
+func newFakeGroup() *fakeGroup {
+	return &fakeGroup{values: make(map[string][]byte), expire: make(map[string]time.Time)}
+}
+
+func (g *fakeGroup) Get(key string) (tinyCache.ByteView, error) {
+	g.mu.Lock()
+	value, ok := g.values[key]
+	expired := ok && !time.Now().Before(g.expire[key])
+	g.mu.Unlock()
+	if !ok || expired {
+		return tinyCache.ByteView{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return identity.Get(string(value))
+}
+
+func (g *fakeGroup) Set(key string, value []byte, ttl time.Duration) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[key] = value
+	g.expire[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (g *fakeGroup) Remove(key string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.values, key)
+	return nil
+}
+
+// brokenGroup 的 Get 总是失败
+type brokenGroup struct{ *fakeGroup }
+
+func (brokenGroup) Get(key string) (tinyCache.ByteView, error) {
+	return tinyCache.ByteView{}, fmt.Errorf("peer unavailable")
+}
+
+func TestKV(t *testing.T) {
+	kv := NewKV(newFakeGroup())
+
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get missing key: err = %v, want ErrKVNotFound", err)
+	}
+	if err := kv.Set("k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := kv.Get("k"); err != nil || string(v) != "v" {
+		t.Fatalf("Get = %q, %v, want v", v, err)
+	}
+	if err := kv.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get deleted key: err = %v, want ErrKVNotFound", err)
+	}
+
+	// 读取出错和 key 不存在是不同的
+	if _, err := NewKV(brokenGroup{newFakeGroup()}).Get("k"); err == nil || err == koo.ErrKVNotFound {
+		t.Fatalf("Get from a broken group: err = %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	kv := NewKV(NewGroup("tinycachestore-kv", 1<<20))
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get missing key: err = %v, want ErrKVNotFound", err)
+	}
+	if err := kv.Set("k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := kv.Get("k"); err != nil || string(v) != "v" {
+		t.Fatalf("Get = %q, %v, want v", v, err)
+	}
+	if err := kv.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get deleted key: err = %v, want ErrKVNotFound", err)
+	}
+
+	if err := kv.Set("short", []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := kv.Get("short"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get expired key: err = %v, want ErrKVNotFound", err)
+	}
+
+	cache := NewByteCache(NewGroup("tinycachestore-responses", 1<<20))
+	if _, ok := cache.Get("k"); ok {
+		t.Fatal("Get missing key is a hit")
+	}
+	cache.Set("k", []byte("v"), time.Minute)
+	if v, ok := cache.Get("k"); !ok || string(v) != "v" {
+		t.Fatalf("Get = %q, %t, want v", v, ok)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	store := koo.NewKVStore(NewKV(newFakeGroup()), "session:")
+	r := koo.New()
+	r.Use(koo.Sessions("sid", store))
+	r.GET("/login", func(c *koo.Context) {
+		c.Session().Set("user", "fengwei")
+		if err := c.Session().Save(); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/me", func(c *koo.Context) {
+		user, _ := c.Session().Get("user").(string)
+		c.String(http.StatusOK, "%s", user)
+	})
+
+	rec := kootest.NewRequest(r).GET("/login").Do().AssertStatus(t, http.StatusOK)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "sid" {
+		t.Fatalf("cookies = %v, want one sid cookie", cookies)
+	}
+	kootest.NewRequest(r).GET("/me").WithCookie(cookies[0]).Do().AssertBody(t, "fengwei")
+	kootest.NewRequest(r).GET("/me").WithCookie(&http.Cookie{Name: "sid", Value: "unknown"}).Do().AssertBody(t, "")
+}
+
+func TestByteCache(t *testing.T) {
+	cache := NewByteCache(newFakeGroup())
+	if _, ok := cache.Get("k"); ok {
+		t.Fatal("Get missing key is a hit")
+	}
+	cache.Set("k", []byte("v"), time.Minute)
+	if v, ok := cache.Get("k"); !ok || string(v) != "v" {
+		t.Fatalf("Get = %q, %t, want v", v, ok)
+	}
+	if _, ok := NewByteCache(brokenGroup{newFakeGroup()}).Get("k"); ok {
+		t.Fatal("Get from a broken group is a hit")
+	}
+
+	calls := 0
+	r := koo.New()
+	r.Use(koo.CacheResponseWithStore(koo.NewByteResponseStore(cache), time.Minute, nil))
+	r.GET("/", func(c *koo.Context) {
+		calls++
+		c.String(http.StatusOK, "cached")
+	})
+	kootest.NewRequest(r).GET("/").Do().AssertHeader(t, "X-Koo-Cache", "MISS").AssertBody(t, "cached")
+	kootest.NewRequest(r).GET("/").Do().AssertHeader(t, "X-Koo-Cache", "HIT").AssertBody(t, "cached")
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,14 @@
+module koo/tinygormstore
+
+go 1.19
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.14
+	koo v0.0.0
+	tinygorm v0.0.0
+)
+
+replace (
+	koo => ../
+	tinygorm => ../../../tiny-gorm
+)
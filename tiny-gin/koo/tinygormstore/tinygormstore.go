@@ -0,0 +1,94 @@
+package tinygormstore
+
+/*
+
+tinygormstore 将 session 保存在 tinygorm 的一张表中，进程重启之后 session 仍然有效
+它是一个单独的 module，只有使用它的程序才会依赖 tinygorm 和 go-sqlite3（需要 cgo）
+
+	engine, _ := tinygorm.NewEngine("sqlite3", "koo.db")
+	kv, err := tinygormstore.NewKV(engine)
+	r.Use(koo.Sessions("koo_session", koo.NewKVStore(kv, "")))
+
+表结构由 Record 决定，表名是 koo_sessions，不存在时 NewKV 会创建它
+过期的记录在读取时删除，也可以定期调用 DeleteExpired 清理没人访问的记录
+
+*/
+
+import (
+	"time"
+
+	"koo"
+	"tinygorm"
+	"tinygorm/session"
+)
+
+// Record 是 koo_sessions 表中的一行
+type Record struct {
+	Key      string `tinygorm:"PRIMARY KEY"`
+	Value    []byte
+	ExpireAt int64 // unix 纳秒
+}
+
+// TableName 返回 Record 对应的表名
+func (Record) TableName() string {
+	return "koo_sessions"
+}
+
+// KV 将 tinygorm 的一张表包装成 koo.KV
+type KV struct {
+	engine *tinygorm.Engine
+}
+
+var _ koo.KV = (*KV)(nil)
+
+// NewKV 创建一个 KV，koo_sessions 表不存在时创建它
+func NewKV(engine *tinygorm.Engine) (*KV, error) {
+	s := engine.NewSession().Model(&Record{})
+	if !s.HasTable() {
+		if err := s.CreateTable(); err != nil {
+			return nil, err
+		}
+	}
+	return &KV{engine: engine}, nil
+}
+
+// Get implements koo.KV
+func (kv *KV) Get(key string) ([]byte, error) {
+	// 不使用 First，它在没有记录时返回的 error 无法和查询出错区分
+	var recs []Record
+	if err := kv.engine.NewSession().Model(&Record{}).Where("Key = ?", key).Limit(1).Find(&recs); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, koo.ErrKVNotFound
+	}
+	rec := recs[0]
+	if time.Now().UnixNano() >= rec.ExpireAt {
+		_ = kv.Delete(key)
+		return nil, koo.ErrKVNotFound
+	}
+	return rec.Value, nil
+}
+
+// Set implements koo.KV，同一个 key 的旧记录在同一个事务中被替换
+func (kv *KV) Set(key string, value []byte, ttl time.Duration) error {
+	rec := &Record{Key: key, Value: value, ExpireAt: time.Now().Add(ttl).UnixNano()}
+	_, err := kv.engine.Transaction(func(s *session.Session) (interface{}, error) {
+		if _, err := s.Model(&Record{}).Where("Key = ?", key).Delete(); err != nil {
+			return nil, err
+		}
+		return s.Insert(rec)
+	})
+	return err
+}
+
+// Delete implements koo.KV
+func (kv *KV) Delete(key string) error {
+	_, err := kv.engine.NewSession().Model(&Record{}).Where("Key = ?", key).Delete()
+	return err
+}
+
+// DeleteExpired 删除所有过期的记录，返回删除的行数
+func (kv *KV) DeleteExpired() (int64, error) {
+	return kv.engine.NewSession().Model(&Record{}).Where("ExpireAt <= ?", time.Now().UnixNano()).Delete()
+}
@@ -0,0 +1,99 @@
+package tinygormstore
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"koo"
+	"koo/kootest"
+	"tinygorm"
+)
+
+func newKV(t *testing.T) (*KV, *tinygorm.Engine) {
+	t.Helper()
+	engine, err := tinygorm.NewEngine("sqlite3", filepath.Join(t.TempDir(), "koo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(engine.Close)
+	kv, err := NewKV(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv, engine
+}
+
+func TestKV(t *testing.T) {
+	kv, engine := newKV(t)
+
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get missing key: err = %v, want ErrKVNotFound", err)
+	}
+	if err := kv.Set("k", []byte("v1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Set("k", []byte("v2"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := kv.Get("k"); err != nil || string(v) != "v2" {
+		t.Fatalf("Get = %q, %v, want v2", v, err)
+	}
+	if err := kv.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get("k"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get deleted key: err = %v, want ErrKVNotFound", err)
+	}
+
+	// 重新打开同一个数据库时表已经存在
+	if _, err := NewKV(engine); err != nil {
+		t.Fatalf("NewKV on existing table: %v", err)
+	}
+}
+
+func TestKVExpire(t *testing.T) {
+	kv, _ := newKV(t)
+	if err := kv.Set("a", []byte("v"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Set("b", []byte("v"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Set("c", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Get("a"); err != koo.ErrKVNotFound {
+		t.Fatalf("Get expired key: err = %v, want ErrKVNotFound", err)
+	}
+	if n, err := kv.DeleteExpired(); err != nil || n != 1 {
+		t.Fatalf("DeleteExpired = %d, %v, want 1", n, err)
+	}
+	if _, err := kv.Get("c"); err != nil {
+		t.Fatalf("Get c: %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	kv, _ := newKV(t)
+	r := koo.New()
+	r.Use(koo.Sessions("sid", koo.NewKVStore(kv, "")))
+	r.GET("/count", func(c *koo.Context) {
+		s := c.Session()
+		n, _ := s.Get("n").(int)
+		s.Set("n", n+1)
+		if err := s.Save(); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "%d", n+1)
+	})
+
+	rec := kootest.NewRequest(r).GET("/count").Do().AssertStatus(t, http.StatusOK).AssertBody(t, "1")
+	cookie := rec.Result().Cookies()[0]
+	kootest.NewRequest(r).GET("/count").WithCookie(cookie).Do().AssertBody(t, "2")
+	kootest.NewRequest(r).GET("/count").WithCookie(cookie).Do().AssertBody(t, "3")
+}
@@ -10,12 +10,19 @@ import (
 // /p/:lang/do c只有在第三层节点，即 doc 节点，pattern 才会设置为 /p/:lang/doc。p 和 :lang 节点的 pattern 属性皆为空
 // part: 路由中的一部分，例如 :lang
 // children: 子节点，例如 [doc, tutorial, intro]
-// isWild: 是否精确匹配，part 含有 : 或 * 时为true
+// isWild: 是否精确匹配，part 含有 : * 或 { 时为true
+// match: part 为 {name:constraint} 形式时的约束检查，约束不满足时 search 会继续尝试下一个候选路由
+// typed: match 来自已注册的类型名（int、uuid 等），而不是正则表达式
+// params: pattern 中每一段对应的参数名，不是参数的段为空字符串，只在 pattern 不为空的节点上设置
+// match 和 params 都在 insert 时解析好，匹配请求时不再解析 pattern
 type node struct {
 	pattern  string
 	part     string
 	children []*node
 	isWild   bool
+	match    func(string) bool
+	typed    bool
+	params   []string
 }
 
 // node.String() 方法，将这个 node 的信息进行输出
@@ -23,27 +30,38 @@ func (n *node) String() string {
 	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
 }
 
-
 // insert 函数在 trie 树中插入一个 parts 的对应一系列 node
-func (n *node) insert(pattern string, parts []string, height int) {
+// part 中的约束不是合法的正则表达式时返回错误
+func (n *node) insert(pattern string, parts []string, height int) error {
 	if len(parts) == height {
 		n.pattern = pattern
-		return
-	} // 如果到达了最后一层，则更新 n 节点的 pattern 属性
+		n.params = make([]string, len(parts))
+		for i, part := range parts {
+			n.params[i], _ = paramName(part)
+		}
+		return nil
+	} // 如果到达了最后一层，则更新 n 节点的 pattern 属性，同时记录参数名
 
 	part := parts[height]       // 取出这一层需要匹配的路由部分 a part of route
-	child := n.matchChild(part) // 取出匹配 this part 的第一个 children in n
+	child := n.matchChild(part) // 取出和 this part 完全相同的 children in n
 	if child == nil {
 		// 如果不存在匹配 part 的 child
 		// 创建一个新的 node，包含这个 part 的 isWild 属性， 和这个 part 的具体 value
 		child = &node{
-			part:     part,
-			isWild:   part[0] == ':' || part[0] == '*',
+			part:   part,
+			isWild: part[0] == ':' || part[0] == '*' || part[0] == '{',
+		}
+		if part[0] == '{' {
+			spec, err := parseParam(part)
+			if err != nil {
+				return err
+			}
+			child.match, child.typed = spec.match, spec.typed
 		}
 		// 将创建的新的 node 添加到 n.children 的后面
 		n.children = append(n.children, child)
 	}
-	child.insert(pattern, parts, height+1) // 递归执行，直到所有 part in parts 插入完毕
+	return child.insert(pattern, parts, height+1) // 递归执行，直到所有 part in parts 插入完毕
 	// 也不会覆盖已经存在的路由，只是开辟新的道路，有之前的路就尽量走之前的路了
 }
 
@@ -61,7 +79,7 @@ func (n *node) search(parts []string, height int) *node {
 	children := n.matchChildren(part)
 
 	for _, child := range children {
-		result := child.search(parts, height + 1)
+		result := child.search(parts, height+1)
 		if result != nil {
 			return result
 		}
@@ -80,11 +98,12 @@ func (n *node) travel(list *[]*node) {
 	}
 } // 将 node 中的所有的 children 作为一个 list 返回
 
-// matchChild 遍历 n 的所有 children，找到一个模糊匹配，或者精确匹配的 node 则返回（返回的是第一个匹配的节点）
-// 否则返回空节点，代表 n 的后面不存在可以匹配 part 的路由
+// matchChild 遍历 n 的所有 children，找到 part 完全相同的 node 则返回
+// 否则返回空节点，代表 n 的后面还没有这一段路由
+// 插入时不能复用模糊节点，否则 /user/{id:int} 和 /user/:name 会挤在同一个节点上，约束就失效了
 func (n *node) matchChild(part string) *node {
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
+		if child.part == part {
 			return child
 		}
 	}
@@ -92,12 +111,34 @@ func (n *node) matchChild(part string) *node {
 }
 
 // matchChildren 找出 n 节点中所有可以匹配 part 的路由，拼接为一个 slice 返回
+// 返回顺序决定了匹配优先级：静态节点 > 类型约束 > 正则约束 > 普通参数 > 通配符 *
 func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
+	var static, typed, regex, params, catchAll []*node
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+		switch {
+		case !child.isWild:
+			if child.part == part {
+				static = append(static, child)
+			}
+		case child.part[0] == '*':
+			catchAll = append(catchAll, child)
+		case child.match != nil:
+			if !child.match(part) {
+				continue
+			}
+			if child.typed {
+				typed = append(typed, child)
+			} else {
+				regex = append(regex, child)
+			}
+		default:
+			params = append(params, child)
 		}
 	}
-	return nodes
-}
\ No newline at end of file
+	nodes := make([]*node, 0, len(static)+len(typed)+len(regex)+len(params)+len(catchAll))
+	nodes = append(nodes, static...)
+	nodes = append(nodes, typed...)
+	nodes = append(nodes, regex...)
+	nodes = append(nodes, params...)
+	return append(nodes, catchAll...)
+}
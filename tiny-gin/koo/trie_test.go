@@ -0,0 +1,121 @@
+package koo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestRouter(patterns ...string) *router {
+	r := newRouter()
+	for _, pattern := range patterns {
+		r.addRoute("GET", pattern, nil)
+	}
+	return r
+}
+
+func TestMatchChildrenPriority(t *testing.T) {
+	// 注册顺序和优先级相反，确认顺序由节点类型决定而不是插入顺序
+	n := &node{}
+	for _, part := range []string{"*filepath", ":name", "{id:[0-9]+}", "{id:int}", "42"} {
+		n.insert("/"+part, []string{part}, 0)
+	}
+
+	tests := []struct {
+		part string
+		want []string
+	}{
+		{"42", []string{"42", "{id:int}", "{id:[0-9]+}", ":name", "*filepath"}},
+		{"7", []string{"{id:int}", "{id:[0-9]+}", ":name", "*filepath"}},
+		{"-7", []string{"{id:int}", ":name", "*filepath"}},
+		{"abc", []string{":name", "*filepath"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, child := range n.matchChildren(tt.part) {
+			got = append(got, child.part)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchChildren(%q) = %v, want %v", tt.part, got, tt.want)
+		}
+	}
+}
+
+func TestGetRoute(t *testing.T) {
+	r := newTestRouter(
+		"/user/new",
+		"/user/{id:int}",
+		"/user/{slug:[a-z]+-[a-z]+}",
+		"/user/:name",
+		"/file/{name:[a-z]+\\.txt}",
+		"/file/*path",
+		"/page/{n:int?}",
+		"/item/{id:int}/edit",
+		"/item/:name/view",
+		"/v/{id:int}",
+		"/v/{id:uuid}",
+	)
+
+	tests := []struct {
+		path    string
+		pattern string
+		params  map[string]string
+	}{
+		// 静态 > 类型约束 > 正则约束 > 普通参数
+		{"/user/new", "/user/new", map[string]string{}},
+		{"/user/42", "/user/{id:int}", map[string]string{"id": "42"}},
+		{"/user/john-doe", "/user/{slug:[a-z]+-[a-z]+}", map[string]string{"slug": "john-doe"}},
+		{"/user/john", "/user/:name", map[string]string{"name": "john"}},
+		// 正则约束 > 通配符
+		{"/file/a.txt", "/file/{name:[a-z]+\\.txt}", map[string]string{"name": "a.txt"}},
+		{"/file/a.png", "/file/*path", map[string]string{"path": "a.png"}},
+		{"/file/dir/a.txt", "/file/*path", map[string]string{"path": "dir/a.txt"}},
+		// 可选段
+		{"/page", "/page", map[string]string{}},
+		{"/page/2", "/page/{n:int}", map[string]string{"n": "2"}},
+		// 约束满足但是后续段不匹配时，回退到下一个候选路由
+		{"/item/42/edit", "/item/{id:int}/edit", map[string]string{"id": "42"}},
+		{"/item/42/view", "/item/:name/view", map[string]string{"name": "42"}},
+		// 只有约束不同的两个路由
+		{"/v/42", "/v/{id:int}", map[string]string{"id": "42"}},
+		{"/v/123e4567-e89b-12d3-a456-426614174000", "/v/{id:uuid}", map[string]string{"id": "123e4567-e89b-12d3-a456-426614174000"}},
+	}
+	for _, tt := range tests {
+		n, params := r.getRoute("GET", tt.path)
+		if n == nil {
+			t.Errorf("getRoute(%q) = nil, want %s", tt.path, tt.pattern)
+			continue
+		}
+		if n.pattern != tt.pattern || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("getRoute(%q) = %s %v, want %s %v", tt.path, n.pattern, params, tt.pattern, tt.params)
+		}
+	}
+
+	for _, path := range []string{"/page/x", "/page/2/3", "/v/abc", "/item/42", "/item/42/delete"} {
+		if n, _ := r.getRoute("GET", path); n != nil {
+			t.Errorf("getRoute(%q) = %s, want nil", path, n.pattern)
+		}
+	}
+	if n, _ := r.getRoute("POST", "/user/new"); n != nil {
+		t.Errorf("getRoute(POST /user/new) = %s, want nil", n.pattern)
+	}
+}
+
+func TestConstraintFallthrough(t *testing.T) {
+	// 约束不满足时不会把请求交给这个路由的 handler，而是交给下一个候选
+	r := newRouter()
+	var hit string
+	r.addRoute("GET", "/post/{id:int}", func(c *Context) { hit = "id " + c.Param("id") })
+	r.addRoute("GET", "/post/:slug", func(c *Context) { hit = "slug " + c.Param("slug") })
+
+	for path, want := range map[string]string{"/post/7": "id 7", "/post/hello": "slug hello"} {
+		hit = ""
+		n, params := r.getRoute("GET", path)
+		if n == nil {
+			t.Fatalf("getRoute(%q) = nil", path)
+		}
+		r.handlers["GET-"+n.pattern](&Context{Params: params})
+		if hit != want {
+			t.Errorf("GET %s hit %q, want %q", path, hit, want)
+		}
+	}
+}
@@ -53,6 +53,17 @@ func main() {
 	})
 	// trie 树提供的路由匹配
 
+	r.GET("/user/{id:int}", func(c *koo.Context) {
+		// expect /user/42, /user/abc 不满足约束，返回 404
+		id, err := c.ParamInt("id")
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, koo.H{"id": id})
+	}).Summary("get a user by id").Tags("user").Response(http.StatusOK, koo.H{})
+	// 带约束的路由参数
+
 	v1 := r.Group("/v1")
 	{
 		v1.GET("/", func(c *koo.Context) {
@@ -76,6 +87,17 @@ func main() {
 	}
 	// 在 context 中添加的中间件功能
 
+	r.GET("/slow", func(c *koo.Context) {
+		// koo.Context 实现了 context.Context，客户端断开或者超时之后 c.Done() 会被关闭
+		defer c.WithTimeout(2 * time.Second)()
+		select {
+		case <-time.After(5 * time.Second):
+			c.String(http.StatusOK, "done\n")
+		case <-c.Done():
+			c.Fail(http.StatusGatewayTimeout, c.Err().Error())
+		}
+	})
+
 	// index out of range for testing Recovery()
 	r.GET("/panic", func(c *koo.Context) {
 		names := []string{"fengwei"}
@@ -85,7 +107,13 @@ func main() {
 	r.SetFuncMap(template.FuncMap{
 		"FormatAsDate": FormatAsDate,
 	})
-	r.LoadHTMLGlob("templates/*")
+	r.SetDebug(true) // 修改模板之后不需要重启
+	if err := r.LoadHTMLGlob("templates/*.tmpl"); err != nil {
+		log.Fatal(err)
+	}
+	if err := r.HTMLTemplates().AddFromFiles("home", "templates/layouts/base.tmpl", "templates/pages/home.tmpl"); err != nil {
+		log.Fatal(err)
+	}
 	r.Static("/assets", "./static")
 
 	stu1 := &student{Name: "fengwei", Age: 20}
@@ -105,8 +133,17 @@ func main() {
 			"now":   time.Date(2022, 7, 9, 0, 0, 0, 0, time.UTC),
 		})
 	})
+	r.GET("/home", func(c *koo.Context) {
+		// 命名模板集合，从 layouts/base.tmpl 开始渲染
+		c.HTML(http.StatusOK, "home", koo.H{
+			"title": "koo",
+			"now":   time.Now(),
+		})
+	})
 
 	// 使用 template 功能
 
+	r.Docs("/openapi.json") // 根据注册的路由生成 OpenAPI 文档
+
 	r.Run("localhost:8080")
 }